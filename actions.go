@@ -0,0 +1,332 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EventHandler acts on the event of a rule. Handlers registered with
+// OnEvent and OnSuccess receive the rendered event of a matching rule;
+// OnFailure handlers receive the rule's event as written, since its params
+// are only rendered when it matches.
+type EventHandler func(ctx *ActionContext, event Event) error
+
+// ActionContext gives handlers access to the facts of the current Run and
+// collects their side effects.
+type ActionContext struct {
+	RuleID  string
+	Matched bool
+
+	run *actionRun
+}
+
+// Fact returns the current value of a fact, including facts set by handlers
+// of rules evaluated earlier in the same Run.
+func (c *ActionContext) Fact(name string) (interface{}, bool) {
+	return lookupFact(c.run.facts, name)
+}
+
+// SetFact sets a fact for the rest of the Run. Rules evaluated later see the
+// new value; the facts passed to Run are never modified.
+func (c *ActionContext) SetFact(name string, value interface{}) {
+	c.run.facts[name] = value
+}
+
+// EmitMetric records a metric. Metrics are returned in RunResult.Metrics
+// and passed to the engine's MetricSink, if one is set; in a transaction
+// only once every handler succeeded.
+func (c *ActionContext) EmitMetric(m Metric) {
+	c.run.metrics = append(c.run.metrics, m)
+	if !c.run.transaction {
+		c.run.emit(m)
+	}
+}
+
+// Metric is a named measurement emitted by an action.
+type Metric struct {
+	Name  string            `json:"name"`
+	Value float64           `json:"value"`
+	Tags  map[string]string `json:"tags,omitempty"`
+}
+
+// MetricSink receives the metrics emitted during a Run, e.g. to forward them
+// to a metrics backend.
+type MetricSink interface {
+	Emit(m Metric)
+}
+
+// MetricSinkFunc adapts a function to a MetricSink.
+type MetricSinkFunc func(m Metric)
+
+func (f MetricSinkFunc) Emit(m Metric) { f(m) }
+
+// ActionError reports a handler that failed while handling the event of a
+// rule.
+type ActionError struct {
+	RuleID    string
+	EventType string
+	Err       error
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("rule %s: handling %s event: %v", e.RuleID, e.EventType, e.Err)
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+// RunResult is the outcome of Run: the events of the matching rules, the
+// facts after all handlers ran and the metrics they emitted.
+type RunResult struct {
+	Events  []Event                `json:"events"`
+	Facts   map[string]interface{} `json:"facts"`
+	Metrics []Metric               `json:"metrics,omitempty"`
+}
+
+type handlerRegistry struct {
+	events    map[string][]EventHandler
+	successes map[string][]EventHandler
+	failures  map[string][]EventHandler
+	sink      MetricSink
+}
+
+// clone copies the registry so a Run can read it while handlers are being
+// registered.
+func (h handlerRegistry) clone() handlerRegistry {
+	copyHandlers := func(m map[string][]EventHandler) map[string][]EventHandler {
+		out := make(map[string][]EventHandler, len(m))
+		for key, handlers := range m {
+			out[key] = append([]EventHandler(nil), handlers...)
+		}
+		return out
+	}
+	return handlerRegistry{
+		events:    copyHandlers(h.events),
+		successes: copyHandlers(h.successes),
+		failures:  copyHandlers(h.failures),
+		sink:      h.sink,
+	}
+}
+
+// OnEvent registers handler for the events of the given type. Handlers of
+// one type run in the order they were registered.
+func (e *Engine) OnEvent(eventType string, handler EventHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.handlers.events == nil {
+		e.handlers.events = make(map[string][]EventHandler)
+	}
+	e.handlers.events[eventType] = append(e.handlers.events[eventType], handler)
+}
+
+// OnSuccess registers handler to run when the rule with the given ID
+// matches, before the OnEvent handlers of its event.
+func (e *Engine) OnSuccess(ruleID string, handler EventHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.handlers.successes == nil {
+		e.handlers.successes = make(map[string][]EventHandler)
+	}
+	e.handlers.successes[ruleID] = append(e.handlers.successes[ruleID], handler)
+}
+
+// OnFailure registers handler to run when the rule with the given ID is
+// evaluated and does not match. It does not run for skipped rules or rules
+// whose conditions fail to evaluate.
+func (e *Engine) OnFailure(ruleID string, handler EventHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.handlers.failures == nil {
+		e.handlers.failures = make(map[string][]EventHandler)
+	}
+	e.handlers.failures[ruleID] = append(e.handlers.failures[ruleID], handler)
+}
+
+// SetMetricSink sets where metrics emitted by handlers are sent. A nil sink
+// only collects them in RunResult.Metrics.
+func (e *Engine) SetMetricSink(sink MetricSink) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers.sink = sink
+}
+
+// WithStopOnError stops a Run at the first failing handler; rules of lower
+// priority are not evaluated.
+func WithStopOnError() EvaluateOption {
+	return func(cfg *evaluateConfig) {
+		cfg.stopOnError = true
+	}
+}
+
+// WithTransaction makes the side effects of a Run all-or-nothing: it stops
+// at the first failing handler, and on failure RunResult.Facts holds the
+// original facts and no metrics are sent to the sink. Side effects of
+// handlers outside the engine cannot be rolled back.
+func WithTransaction() EvaluateOption {
+	return func(cfg *evaluateConfig) {
+		cfg.stopOnError = true
+		cfg.transaction = true
+	}
+}
+
+// actionRun is the state shared by the handlers of one Run.
+type actionRun struct {
+	facts       map[string]interface{}
+	metrics     []Metric
+	sink        MetricSink
+	transaction bool
+}
+
+func (r *actionRun) emit(m Metric) {
+	if r.sink != nil {
+		r.sink.Emit(m)
+	}
+}
+
+// Run evaluates rules like Evaluate and executes the registered handlers as
+// each rule is decided, in priority order: for a matching rule its OnSuccess
+// handlers and then the OnEvent handlers of its event type, for a rule that
+// does not match its OnFailure handlers. Because facts set by handlers are
+// visible to the rules evaluated after them, Run considers every rule
+// rather than consulting the rule index.
+//
+// Events covered by a conflict policy are dispatched after every rule has
+// been evaluated and their conflicts resolved, so handlers only see the
+// surviving events: the OnSuccess handlers of the winning rules run, and
+// the OnEvent handlers run once with the resolved event.
+//
+// Handler errors are returned as *ActionError values joined with any
+// evaluation errors; by default the remaining rules and handlers still run.
+// See WithStopOnError and WithTransaction.
+func (e *Engine) Run(rules *Rule, facts map[string]interface{}, opts ...EvaluateOption) (*RunResult, error) {
+	cfg := e.newEvaluateConfig(opts)
+
+	e.mu.RLock()
+	handlers := e.handlers.clone()
+	e.mu.RUnlock()
+
+	run := &actionRun{
+		facts:       make(map[string]interface{}, len(facts)),
+		sink:        handlers.sink,
+		transaction: cfg.transaction,
+	}
+	for name, value := range facts {
+		run.facts[name] = value
+	}
+
+	failed := false
+	cfg.dispatch = func(rules []ruleOption, event Event, matched bool) error {
+		var errs []error
+		call := func(ruleID string, chain []EventHandler) bool {
+			ctx := &ActionContext{RuleID: ruleID, Matched: matched, run: run}
+			for _, handler := range chain {
+				if err := handler(ctx, event); err != nil {
+					failed = true
+					errs = append(errs, &ActionError{RuleID: ruleID, EventType: event.Type, Err: err})
+					if cfg.stopOnError {
+						return false
+					}
+				}
+			}
+			return true
+		}
+
+		if !matched {
+			call(rules[0].ID, handlers.failures[rules[0].ID])
+			return errors.Join(errs...)
+		}
+		for _, rule := range rules {
+			if !call(rule.ID, handlers.successes[rule.ID]) {
+				return errors.Join(errs...)
+			}
+		}
+		call(rules[0].ID, handlers.events[event.Type])
+		return errors.Join(errs...)
+	}
+
+	explanation, err := e.evaluate(rules, run.facts, &cfg)
+	if explanation == nil {
+		return nil, err
+	}
+
+	result := &RunResult{Events: explanation.Events, Facts: run.facts, Metrics: run.metrics}
+	if cfg.transaction {
+		if failed {
+			result.Facts = make(map[string]interface{}, len(facts))
+			for name, value := range facts {
+				result.Facts[name] = value
+			}
+			result.Metrics = nil
+		} else {
+			for _, m := range run.metrics {
+				run.emit(m)
+			}
+		}
+	}
+	return result, err
+}
+
+// SetFactAction returns a handler that sets facts from the event params:
+// either a single "fact" and "value", or a "facts" object of names to
+// values. Params may be templates, so values can be computed from other
+// facts.
+func SetFactAction() EventHandler {
+	return func(ctx *ActionContext, event Event) error {
+		if values, ok := event.Params["facts"].(map[string]interface{}); ok {
+			names := make([]string, 0, len(values))
+			for name := range values {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				ctx.SetFact(name, values[name])
+			}
+			return nil
+		}
+
+		name, ok := event.Params["fact"].(string)
+		if !ok || name == "" {
+			return errors.New("set fact: params need a \"fact\" name or a \"facts\" object")
+		}
+		value, ok := event.Params["value"]
+		if !ok {
+			return fmt.Errorf("set fact %s: missing \"value\"", name)
+		}
+		ctx.SetFact(name, value)
+		return nil
+	}
+}
+
+// EmitMetricAction returns a handler that emits a metric described by the
+// event params: "metric" names it (defaulting to the event type), "value"
+// is a number (defaulting to 1) and "tags" an object of strings.
+func EmitMetricAction() EventHandler {
+	return func(ctx *ActionContext, event Event) error {
+		m := Metric{Name: event.Type, Value: 1}
+		if name, ok := event.Params["metric"]; ok {
+			s, ok := name.(string)
+			if !ok || strings.TrimSpace(s) == "" {
+				return fmt.Errorf("emit metric: invalid name %v", name)
+			}
+			m.Name = s
+		}
+		if value, ok := event.Params["value"]; ok {
+			n, ok := numberValue(value)
+			if !ok {
+				return fmt.Errorf("emit metric %s: value %v is not a number", m.Name, value)
+			}
+			m.Value = n
+		}
+		if tags, ok := event.Params["tags"].(map[string]interface{}); ok {
+			m.Tags = make(map[string]string, len(tags))
+			for key, value := range tags {
+				m.Tags[key] = formatText(value)
+			}
+		}
+		ctx.EmitMetric(m)
+		return nil
+	}
+}
@@ -0,0 +1,47 @@
+package go_json_rules_engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRunWhileRegisteringHandlers(t *testing.T) {
+	var defs []string
+	for i := 0; i < 50; i++ {
+		defs = append(defs, fmt.Sprintf(`{"id": "r%d", "conditions": {"operator": "and", "conditions": [
+			{"fact": "n", "operator": "greaterThan", "value": %d}]}, "event": {"type": "e%d"}}`, i, i%2, i%3))
+	}
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString("[" + strings.Join(defs, ",") + "]"); err != nil {
+		t.Fatal(err)
+	}
+
+	eng := NewEngine()
+	noop := func(*ActionContext, Event) error { return nil }
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			id := fmt.Sprint("r", i%50)
+			eng.OnEvent(fmt.Sprint("e", i%3), noop)
+			eng.OnSuccess(id, noop)
+			eng.OnFailure(id, noop)
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		if _, err := eng.Run(rules, map[string]interface{}{"n": 1}); err != nil {
+			t.Error(err)
+			break
+		}
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,355 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ConflictStrategy decides which of several conflicting events survives.
+type ConflictStrategy string
+
+const (
+	// PreferHighestPriority keeps the event of the rule with the highest
+	// priority, the first loaded one on ties.
+	PreferHighestPriority ConflictStrategy = "highestPriority"
+	// PreferMostSpecific keeps the event of the rule with the most
+	// conditions, falling back to priority on ties.
+	PreferMostSpecific ConflictStrategy = "mostSpecific"
+	// DenyOverrides keeps the first event whose type is one of the policy's
+	// DenyTypes, or the first event if there is none.
+	DenyOverrides ConflictStrategy = "denyOverrides"
+	// MergeParams combines the events into one, merging their params with
+	// the policy's merge strategies.
+	MergeParams ConflictStrategy = "mergeParams"
+)
+
+// MergeStrategy combines the values of a param present in several events
+// merged by MergeParams.
+type MergeStrategy string
+
+const (
+	MergeFirst  MergeStrategy = "first"
+	MergeLast   MergeStrategy = "last"
+	MergeSum    MergeStrategy = "sum"
+	MergeMax    MergeStrategy = "max"
+	MergeMin    MergeStrategy = "min"
+	MergeAppend MergeStrategy = "append"
+)
+
+// ConflictPolicy resolves events that contradict each other, such as
+// "approve" and "deny", or two discounts. If EventTypes is set, all events
+// of those types conflict; otherwise events conflict with the events of the
+// same type.
+type ConflictPolicy struct {
+	Name       string           `json:"name,omitempty"`
+	EventTypes []string         `json:"eventTypes,omitempty"`
+	Strategy   ConflictStrategy `json:"strategy"`
+
+	// DenyTypes are the types that win under DenyOverrides; "deny" if empty.
+	DenyTypes []string `json:"denyTypes,omitempty"`
+
+	// Merge sets the strategy per param under MergeParams, and DefaultMerge
+	// the strategy of the other params, MergeFirst if empty.
+	Merge        map[string]MergeStrategy `json:"merge,omitempty"`
+	DefaultMerge MergeStrategy            `json:"defaultMerge,omitempty"`
+}
+
+// ConflictTrace records a conflict resolved during an evaluation: the rules
+// whose events conflicted, the rules whose events won and the resulting
+// event.
+type ConflictTrace struct {
+	Policy   string           `json:"policy"`
+	Strategy ConflictStrategy `json:"strategy"`
+	Rules    []string         `json:"rules"`
+	Winners  []string         `json:"winners"`
+	Event    Event            `json:"event"`
+}
+
+// SetConflictPolicies replaces the policies used to resolve conflicting
+// events in the results of Evaluate, Explain, Run and networks built by the
+// engine. An event is resolved by the first policy covering its type, so
+// list policies for specific types before catch-all ones.
+func (e *Engine) SetConflictPolicies(policies ...ConflictPolicy) error {
+	checked := make([]ConflictPolicy, len(policies))
+	for i, policy := range policies {
+		if policy.Name == "" {
+			policy.Name = string(policy.Strategy)
+		}
+		if err := policy.check(); err != nil {
+			return fmt.Errorf("conflict policy %q: %w", policy.Name, err)
+		}
+		checked[i] = policy
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conflictPolicies = checked
+	return nil
+}
+
+func (p ConflictPolicy) check() error {
+	switch p.Strategy {
+	case PreferHighestPriority, PreferMostSpecific, DenyOverrides, MergeParams:
+	default:
+		return fmt.Errorf("unknown strategy %q", p.Strategy)
+	}
+
+	strategies := []MergeStrategy{p.DefaultMerge}
+	for _, strategy := range p.Merge {
+		strategies = append(strategies, strategy)
+	}
+	for _, strategy := range strategies {
+		switch strategy {
+		case "", MergeFirst, MergeLast, MergeSum, MergeMax, MergeMin, MergeAppend:
+		default:
+			return fmt.Errorf("unknown merge strategy %q", strategy)
+		}
+	}
+	return nil
+}
+
+func (p ConflictPolicy) covers(eventType string) bool {
+	if len(p.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range p.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve picks the surviving event among events, which belong to rules and
+// are in evaluation order, and returns it with the IDs of the winning rules.
+func (p ConflictPolicy) resolve(rules []ruleOption, events []Event) (Event, []string, error) {
+	winner := 0
+	switch p.Strategy {
+	case PreferMostSpecific:
+		most := -1
+		for i, rule := range rules {
+			if n := conditionCount(rule.Conditions); n > most {
+				winner, most = i, n
+			}
+		}
+
+	case DenyOverrides:
+		denyTypes := p.DenyTypes
+		if len(denyTypes) == 0 {
+			denyTypes = []string{"deny"}
+		}
+	deny:
+		for i, event := range events {
+			for _, t := range denyTypes {
+				if event.Type == t {
+					winner = i
+					break deny
+				}
+			}
+		}
+
+	case MergeParams:
+		event, err := p.merge(events)
+		if err != nil {
+			return Event{}, nil, err
+		}
+		ids := make([]string, len(rules))
+		for i, rule := range rules {
+			ids[i] = rule.ID
+		}
+		return event, ids, nil
+	}
+
+	return events[winner], []string{rules[winner].ID}, nil
+}
+
+func (p ConflictPolicy) merge(events []Event) (Event, error) {
+	merged := Event{Type: events[0].Type}
+	for _, event := range events {
+		for key, value := range event.Params {
+			if merged.Params == nil {
+				merged.Params = make(map[string]interface{})
+			}
+
+			strategy := p.Merge[key]
+			if strategy == "" {
+				strategy = p.DefaultMerge
+			}
+
+			current, exists := merged.Params[key]
+			if strategy == MergeAppend {
+				merged.Params[key] = appendParam(current, value)
+				continue
+			}
+			if !exists {
+				merged.Params[key] = value
+				continue
+			}
+
+			switch strategy {
+			case MergeLast:
+				merged.Params[key] = value
+			case MergeSum, MergeMax, MergeMin:
+				a, okA := numberValue(current)
+				b, okB := numberValue(value)
+				if !okA || !okB {
+					return Event{}, fmt.Errorf("cannot %s param %s: %v and %v are not both numbers", strategy, key, current, value)
+				}
+				switch {
+				case strategy == MergeSum:
+					merged.Params[key] = a + b
+				case strategy == MergeMax && b > a, strategy == MergeMin && b < a:
+					merged.Params[key] = value
+				}
+			}
+		}
+	}
+	return merged, nil
+}
+
+// appendParam adds value to the array collected so far, concatenating
+// arrays.
+func appendParam(collected, value interface{}) interface{} {
+	list, _ := collected.([]interface{})
+	if values, ok := value.([]interface{}); ok {
+		return append(list, values...)
+	}
+	return append(list, value)
+}
+
+func conditionCount(group ConditionGroup) int {
+	n := 0
+	walkConditions(group, "", func(string, Condition) { n++ }, nil)
+	return n
+}
+
+// coveredBy reports whether one of policies resolves events of eventType.
+func coveredBy(policies []ConflictPolicy, eventType string) bool {
+	for _, policy := range policies {
+		if policy.covers(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) currentConflictPolicies() []ConflictPolicy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.conflictPolicies
+}
+
+// firing is an event that survived conflict resolution together with the
+// rules it stands for: one rule, or every rule merged by MergeParams.
+type firing struct {
+	rules []ruleOption
+	event Event
+}
+
+// resolveConflicts applies policies to the events in result.fired, setting
+// result.Events and result.matched to the surviving events and rules and
+// updating the traces of overridden rules when they were recorded. It
+// returns the surviving events in order.
+func resolveConflicts(result *Explanation, policies []ConflictPolicy) ([]firing, error) {
+	// Group the events by policy, and by type for policies without
+	// EventTypes, keeping the groups in order of their first event.
+	type conflict struct {
+		policy ConflictPolicy
+		events []int
+	}
+	var conflicts []*conflict
+	groups := make(map[string]*conflict)
+	owner := make([]*conflict, len(result.fired))
+	for i, event := range result.fired {
+		for p, policy := range policies {
+			if !policy.covers(event.Type) {
+				continue
+			}
+			key := strconv.Itoa(p)
+			if len(policy.EventTypes) == 0 {
+				key += "/" + event.Type
+			}
+			c, ok := groups[key]
+			if !ok {
+				c = &conflict{policy: policy}
+				groups[key] = c
+				conflicts = append(conflicts, c)
+			}
+			c.events = append(c.events, i)
+			owner[i] = c
+			break
+		}
+	}
+
+	traces := make(map[string]*RuleTrace, len(result.Rules))
+	for i := range result.Rules {
+		traces[result.Rules[i].RuleID] = &result.Rules[i]
+	}
+
+	var errs []error
+	resolved := make(map[*conflict]firing)
+	for _, c := range conflicts {
+		if len(c.events) < 2 {
+			continue
+		}
+		rules := make([]ruleOption, len(c.events))
+		events := make([]Event, len(c.events))
+		ids := make([]string, len(c.events))
+		for j, i := range c.events {
+			rules[j], events[j], ids[j] = result.firedBy[i], result.fired[i], result.firedBy[i].ID
+		}
+
+		event, winners, err := c.policy.resolve(rules, events)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("conflict policy %q: %w", c.policy.Name, err))
+			continue
+		}
+		result.Conflicts = append(result.Conflicts, ConflictTrace{
+			Policy:   c.policy.Name,
+			Strategy: c.policy.Strategy,
+			Rules:    ids,
+			Winners:  winners,
+			Event:    event,
+		})
+
+		won := make(map[string]bool, len(winners))
+		for _, id := range winners {
+			won[id] = true
+		}
+		f := firing{event: event}
+		for _, rule := range rules {
+			if won[rule.ID] {
+				f.rules = append(f.rules, rule)
+			}
+		}
+		resolved[c] = f
+
+		for _, id := range ids {
+			trace, ok := traces[id]
+			switch {
+			case !ok:
+			case c.policy.Strategy == MergeParams:
+				trace.Reason = fmt.Sprintf("params merged by conflict policy %q", c.policy.Name)
+			case !won[id]:
+				trace.Status = RuleOverridden
+				trace.Reason = fmt.Sprintf("overridden by %s under conflict policy %q", winners[0], c.policy.Name)
+			}
+		}
+	}
+
+	var firings []firing
+	result.Events, result.matched = nil, nil
+	for i, event := range result.fired {
+		f, ok := resolved[owner[i]]
+		if !ok {
+			f = firing{rules: []ruleOption{result.firedBy[i]}, event: event}
+		} else if owner[i].events[0] != i {
+			continue
+		}
+		firings = append(firings, f)
+		result.Events = append(result.Events, f.event)
+		result.matched = append(result.matched, f.rules...)
+	}
+	return firings, errors.Join(errs...)
+}
@@ -0,0 +1,132 @@
+package go_json_rules_engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+const conflictingRules = `[
+	{"id": "approve", "priority": 2, "score": 10, "conditions": {"operator": "and", "conditions": [
+		{"fact": "age", "operator": "greaterThan", "value": 17}
+	]}, "event": {"type": "approve"}},
+	{"id": "deny", "priority": 1, "score": 1, "conditions": {"operator": "and", "conditions": [
+		{"fact": "country", "operator": "equal", "value": "XX"}
+	]}, "event": {"type": "deny"}},
+	{"id": "notify", "conditions": {"operator": "and", "conditions": []}, "event": {"type": "notify"}}
+]`
+
+func TestRunDispatchesOnlySurvivingEvents(t *testing.T) {
+	eng := NewEngine()
+	if err := eng.SetConflictPolicies(ConflictPolicy{
+		EventTypes: []string{"approve", "deny"},
+		Strategy:   DenyOverrides,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ran []string
+	record := func(name string) EventHandler {
+		return func(ctx *ActionContext, event Event) error {
+			ran = append(ran, name+":"+ctx.RuleID)
+			return nil
+		}
+	}
+	for _, typ := range []string{"approve", "deny", "notify"} {
+		eng.OnEvent(typ, record("event"))
+		eng.OnSuccess(typ, record("success"))
+	}
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(conflictingRules); err != nil {
+		t.Fatal(err)
+	}
+	result, err := eng.Run(rules, map[string]interface{}{"age": 30, "country": "XX"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, event := range result.Events {
+		types = append(types, event.Type)
+	}
+	if want := []string{"deny", "notify"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("events %v, want %v", types, want)
+	}
+	if want := []string{"success:notify", "event:notify", "success:deny", "event:deny"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("handlers ran %v, want %v", ran, want)
+	}
+}
+
+func TestRunDispatchesMergedEventOnce(t *testing.T) {
+	eng := NewEngine()
+	if err := eng.SetConflictPolicies(ConflictPolicy{
+		EventTypes: []string{"discount"},
+		Strategy:   MergeParams,
+		Merge:      map[string]MergeStrategy{"percent": MergeSum},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var successes []string
+	var events []Event
+	eng.OnSuccess("a", func(ctx *ActionContext, event Event) error {
+		successes = append(successes, ctx.RuleID)
+		return nil
+	})
+	eng.OnSuccess("b", func(ctx *ActionContext, event Event) error {
+		successes = append(successes, ctx.RuleID)
+		return nil
+	})
+	eng.OnEvent("discount", func(ctx *ActionContext, event Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(`[
+		{"id": "a", "conditions": {"operator": "and", "conditions": []}, "event": {"type": "discount", "params": {"percent": 5}}},
+		{"id": "b", "conditions": {"operator": "and", "conditions": []}, "event": {"type": "discount", "params": {"percent": 10}}}
+	]`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eng.Run(rules, map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"a", "b"}; !reflect.DeepEqual(successes, want) {
+		t.Errorf("success handlers ran for %v, want %v", successes, want)
+	}
+	if len(events) != 1 {
+		t.Fatalf("event handler ran %d times, want 1", len(events))
+	}
+	if percent, _ := numberValue(events[0].Params["percent"]); percent != 15 {
+		t.Errorf("event handler saw percent %v, want 15", events[0].Params["percent"])
+	}
+}
+
+func TestScoreIgnoresOverriddenRules(t *testing.T) {
+	eng := NewEngine()
+	if err := eng.SetConflictPolicies(ConflictPolicy{
+		EventTypes: []string{"approve", "deny"},
+		Strategy:   DenyOverrides,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(conflictingRules); err != nil {
+		t.Fatal(err)
+	}
+	result, err := eng.Score(rules, Scorecard{}, map[string]interface{}{"age": 30, "country": "XX"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Score != 1 {
+		t.Errorf("score %v, want 1", result.Score)
+	}
+	for _, c := range result.Contributions {
+		if c.RuleID == "approve" {
+			t.Errorf("overridden rule approve contributed %v", c.Contribution)
+		}
+	}
+}
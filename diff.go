@@ -0,0 +1,275 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeKind says how a value differs between two rule sets.
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+// FieldChange is a difference in one field of a rule. Path addresses the
+// field like validation errors do, e.g. "conditions.conditions[1].value" or
+// "event.params.discount".
+type FieldChange struct {
+	Path string      `json:"path"`
+	Kind ChangeKind  `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// RuleChange lists the fields that differ in a rule present in both sets.
+type RuleChange struct {
+	RuleID  string        `json:"ruleId"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// RuleDiff is the structural difference between two rule sets, matched by
+// rule ID. Conditions are compared element by element, so inserting a
+// condition is reported as one added condition rather than a change to all
+// that follow it.
+type RuleDiff struct {
+	Added   []string     `json:"added,omitempty"`
+	Removed []string     `json:"removed,omitempty"`
+	Changed []RuleChange `json:"changed,omitempty"`
+}
+
+// Empty reports whether the rule sets are equal.
+func (d RuleDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String formats the diff one change per line: "+ rule <id>" for added
+// rules, "- rule <id>" for removed ones and "~ rule <id>: <path>: <change>"
+// for each changed field.
+func (d RuleDiff) String() string {
+	var sb strings.Builder
+	for _, id := range d.Added {
+		fmt.Fprintf(&sb, "+ rule %s\n", id)
+	}
+	for _, id := range d.Removed {
+		fmt.Fprintf(&sb, "- rule %s\n", id)
+	}
+	for _, rule := range d.Changed {
+		for _, c := range rule.Changes {
+			switch c.Kind {
+			case ChangeAdded:
+				fmt.Fprintf(&sb, "~ rule %s: %s: added %s\n", rule.RuleID, c.Path, formatValue(c.New))
+			case ChangeRemoved:
+				fmt.Fprintf(&sb, "~ rule %s: %s: removed %s\n", rule.RuleID, c.Path, formatValue(c.Old))
+			default:
+				fmt.Fprintf(&sb, "~ rule %s: %s: %s -> %s\n", rule.RuleID, c.Path, formatValue(c.Old), formatValue(c.New))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// DiffRules compares two rule sets. Either may be nil.
+func DiffRules(from, to *Rule) (RuleDiff, error) {
+	old, err := genericRules(from)
+	if err != nil {
+		return RuleDiff{}, err
+	}
+	updated, err := genericRules(to)
+	if err != nil {
+		return RuleDiff{}, err
+	}
+
+	var d RuleDiff
+	for id := range updated {
+		if _, ok := old[id]; !ok {
+			d.Added = append(d.Added, id)
+		}
+	}
+	for id, rule := range old {
+		next, ok := updated[id]
+		if !ok {
+			d.Removed = append(d.Removed, id)
+			continue
+		}
+		var changes []FieldChange
+		diffValues("", rule, next, &changes)
+		if len(changes) > 0 {
+			d.Changed = append(d.Changed, RuleChange{RuleID: id, Changes: changes})
+		}
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool {
+		return d.Changed[i].RuleID < d.Changed[j].RuleID
+	})
+	return d, nil
+}
+
+// genericRules decodes the canonical JSON of each rule, keyed by ID.
+func genericRules(rules *Rule) (map[string]map[string]interface{}, error) {
+	generic := make(map[string]map[string]interface{})
+	if rules == nil {
+		return generic, nil
+	}
+	for _, rule := range rules.GetRules() {
+		data, err := json.Marshal(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+		delete(obj, "id")
+		generic[rule.ID] = obj
+	}
+	return generic, nil
+}
+
+func diffValues(path string, old, updated interface{}, changes *[]FieldChange) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if u, ok := updated.(map[string]interface{}); ok {
+			diffObjects(path, o, u, changes)
+			return
+		}
+	case []interface{}:
+		if u, ok := updated.([]interface{}); ok {
+			diffArrays(path, o, u, changes)
+			return
+		}
+	}
+	if !reflect.DeepEqual(old, updated) {
+		*changes = append(*changes, FieldChange{Path: path, Kind: ChangeChanged, Old: old, New: updated})
+	}
+}
+
+func diffObjects(path string, old, updated map[string]interface{}, changes *[]FieldChange) {
+	keys := make([]string, 0, len(old)+len(updated))
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range updated {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+		o, inOld := old[key]
+		u, inNew := updated[key]
+		switch {
+		case !inOld:
+			*changes = append(*changes, FieldChange{Path: childPath, Kind: ChangeAdded, New: u})
+		case !inNew:
+			*changes = append(*changes, FieldChange{Path: childPath, Kind: ChangeRemoved, Old: o})
+		default:
+			diffValues(childPath, o, u, changes)
+		}
+	}
+}
+
+// diffArrays matches equal elements by longest common subsequence. Between
+// matches, each unmatched old element is paired with the most similar new
+// one and diffed; the rest are reported as added or removed. Added and
+// changed elements use their index in the new array, removed ones their index
+// in the old array.
+func diffArrays(path string, old, updated []interface{}, changes *[]FieldChange) {
+	n, m := len(old), len(updated)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if reflect.DeepEqual(old[i], updated[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	index := func(i int) string { return fmt.Sprintf("%s[%d]", path, i) }
+	var removed, added []int
+	flush := func() {
+		paired := make(map[int]bool, len(added))
+		for _, i := range removed {
+			best, score := -1, 0
+			for _, j := range added {
+				if s := similarity(old[i], updated[j]); !paired[j] && s > score {
+					best, score = j, s
+				}
+			}
+			if best < 0 {
+				*changes = append(*changes, FieldChange{Path: index(i), Kind: ChangeRemoved, Old: old[i]})
+				continue
+			}
+			paired[best] = true
+			diffValues(index(best), old[i], updated[best], changes)
+		}
+		for _, j := range added {
+			if !paired[j] {
+				*changes = append(*changes, FieldChange{Path: index(j), Kind: ChangeAdded, New: updated[j]})
+			}
+		}
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case reflect.DeepEqual(old[i], updated[j]):
+			flush()
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		removed = append(removed, i)
+	}
+	for ; j < m; j++ {
+		added = append(added, j)
+	}
+	flush()
+}
+
+// similarity counts the fields two objects have in common, so that a
+// condition whose value changed is paired with its old self rather than
+// reported as removed and added.
+func similarity(a, b interface{}) int {
+	x, ok := a.(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	y, ok := b.(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	n := 0
+	for key, value := range x {
+		if other, ok := y[key]; ok && reflect.DeepEqual(value, other) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,136 @@
+package go_json_rules_engine
+
+import (
+	"testing"
+)
+
+const diffBase = `[
+	{"id": "vip", "priority": 10,
+		"conditions": {"operator": "and", "conditions": [
+			{"fact": "spend", "operator": "greaterThan", "value": 1000},
+			{"fact": "country", "operator": "equal", "value": "VN"},
+			{"fact": "age", "operator": "greaterThan", "value": 18}
+		]},
+		"event": {"type": "vip", "params": {"discount": 10}}},
+	{"id": "legacy", "conditions": {"all": []}, "event": {"type": "legacy"}}
+]`
+
+func loadRulesString(t *testing.T, doc string) *Rule {
+	t.Helper()
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(doc); err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+func TestDiffRules(t *testing.T) {
+	tests := []struct {
+		name string
+		to   string
+		want string
+	}{
+		{"unchanged", diffBase, ""},
+		{"rules reordered", `[
+			{"id": "legacy", "conditions": {"all": []}, "event": {"type": "legacy"}},
+			{"id": "vip", "priority": 10,
+				"conditions": {"operator": "and", "conditions": [
+					{"fact": "spend", "operator": "greaterThan", "value": 1000},
+					{"fact": "country", "operator": "equal", "value": "VN"},
+					{"fact": "age", "operator": "greaterThan", "value": 18}
+				]},
+				"event": {"type": "vip", "params": {"discount": 10}}}
+		]`, ""},
+		{"rules added and removed", `[
+			{"id": "vip", "priority": 10,
+				"conditions": {"operator": "and", "conditions": [
+					{"fact": "spend", "operator": "greaterThan", "value": 1000},
+					{"fact": "country", "operator": "equal", "value": "VN"},
+					{"fact": "age", "operator": "greaterThan", "value": 18}
+				]},
+				"event": {"type": "vip", "params": {"discount": 10}}},
+			{"id": "welcome", "conditions": {"all": []}, "event": {"type": "welcome"}},
+			{"id": "another", "conditions": {"all": []}, "event": {"type": "another"}}
+		]`, "+ rule another\n+ rule welcome\n- rule legacy\n"},
+		{"fields changed", `[
+			{"id": "vip", "priority": 20,
+				"conditions": {"operator": "and", "conditions": [
+					{"fact": "spend", "operator": "greaterThan", "value": 2000},
+					{"fact": "country", "operator": "equal", "value": "VN"},
+					{"fact": "age", "operator": "greaterThan", "value": 18}
+				]},
+				"event": {"type": "vip", "params": {"discount": 15, "label": "VIP"}}},
+			{"id": "legacy", "conditions": {"all": []}, "event": {"type": "legacy"}}
+		]`, "~ rule vip: conditions.conditions[0].value: 1000 -> 2000\n" +
+			"~ rule vip: event.params.discount: 10 -> 15\n" +
+			"~ rule vip: event.params.label: added \"VIP\"\n" +
+			"~ rule vip: priority: 10 -> 20\n"},
+		{"condition inserted", `[
+			{"id": "vip", "priority": 10,
+				"conditions": {"operator": "and", "conditions": [
+					{"fact": "spend", "operator": "greaterThan", "value": 1000},
+					{"fact": "plan", "operator": "equal", "value": "pro"},
+					{"fact": "country", "operator": "equal", "value": "VN"},
+					{"fact": "age", "operator": "greaterThan", "value": 18}
+				]},
+				"event": {"type": "vip", "params": {"discount": 10}}},
+			{"id": "legacy", "conditions": {"all": []}, "event": {"type": "legacy"}}
+		]`, "~ rule vip: conditions.conditions[1]: added {\"fact\":\"plan\",\"operator\":\"equal\",\"value\":\"pro\"}\n"},
+		{"condition removed", `[
+			{"id": "vip", "priority": 10,
+				"conditions": {"operator": "and", "conditions": [
+					{"fact": "spend", "operator": "greaterThan", "value": 1000},
+					{"fact": "age", "operator": "greaterThan", "value": 18}
+				]},
+				"event": {"type": "vip", "params": {"discount": 10}}},
+			{"id": "legacy", "conditions": {"all": []}, "event": {"type": "legacy"}}
+		]`, "~ rule vip: conditions.conditions[1]: removed {\"fact\":\"country\",\"operator\":\"equal\",\"value\":\"VN\"}\n"},
+		// A moved condition is removed from its old index and added at its new one.
+		{"conditions reordered", `[
+			{"id": "vip", "priority": 10,
+				"conditions": {"operator": "and", "conditions": [
+					{"fact": "country", "operator": "equal", "value": "VN"},
+					{"fact": "age", "operator": "greaterThan", "value": 18},
+					{"fact": "spend", "operator": "greaterThan", "value": 1000}
+				]},
+				"event": {"type": "vip", "params": {"discount": 10}}},
+			{"id": "legacy", "conditions": {"all": []}, "event": {"type": "legacy"}}
+		]`, "~ rule vip: conditions.conditions[0]: removed {\"fact\":\"spend\",\"operator\":\"greaterThan\",\"value\":1000}\n" +
+			"~ rule vip: conditions.conditions[2]: added {\"fact\":\"spend\",\"operator\":\"greaterThan\",\"value\":1000}\n"},
+	}
+
+	from := loadRulesString(t, diffBase)
+	for _, tt := range tests {
+		diff, err := DiffRules(from, loadRulesString(t, tt.to))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := diff.String(); got != tt.want {
+			t.Errorf("%s: diff\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+		if diff.Empty() != (tt.want == "") {
+			t.Errorf("%s: Empty() = %v", tt.name, diff.Empty())
+		}
+	}
+}
+
+func TestDiffRulesNil(t *testing.T) {
+	rules := loadRulesString(t, diffBase)
+
+	diff, err := DiffRules(nil, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := diff.String(); got != "+ rule legacy\n+ rule vip\n" {
+		t.Errorf("diff from nil:\n%s", got)
+	}
+
+	diff, err = DiffRules(rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := diff.String(); got != "- rule legacy\n- rule vip\n" {
+		t.Errorf("diff to nil:\n%s", got)
+	}
+}
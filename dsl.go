@@ -0,0 +1,537 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The expression language is a compact textual form of a ConditionGroup:
+//
+//	age >= 21 && (yearlyPurchases > 1000 || membershipLevel in ["gold", "platinum"])
+//
+// Comparisons are written as "fact operator value":
+//
+//	==  !=  >  <  >=  <=      equal, notEqual, greaterThan, lessThan,
+//	                          greaterThanInclusive, lessThanInclusive
+//	in [...]  not in [...]    in, notIn
+//	=~ "pattern"              regex
+//	is null  is not null      isNull, isNotNull (also == null, != null)
+//	fact divisibleBy 5        any other name is used as a custom operator
+//
+// Comparisons are combined with && (and) and || (or), where && binds tighter,
+// grouped with parentheses and negated with !(...) or not (...); negated
+// groups are rewritten with De Morgan's laws, since only comparisons carry a
+// Not flag. The empty group, which always matches, is written true. Values
+// are JSON literals; strings may also be single-quoted. Fact names that are
+// not plain identifiers are written in backticks.
+//
+// Either side of a comparison may also be computed (see expr.go):
+//
+//	orderTotal > 0.3 * monthlyIncome
+//	len(items) > 5
+
+var dslOperators = map[string]Operator{
+	"==": Equal,
+	"!=": NotEqual,
+	">":  GreaterThan,
+	"<":  LessThan,
+	">=": GreaterThanInc,
+	"<=": LessThanInc,
+	"=~": Regex,
+}
+
+// ParseConditions compiles an expression into a ConditionGroup. Errors are
+// *SyntaxError values carrying the line and column of the problem.
+func ParseConditions(expr string) (ConditionGroup, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return ConditionGroup{}, err
+	}
+
+	p := &dslParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return ConditionGroup{}, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return ConditionGroup{}, p.errorf(tok, "unexpected %s", tok)
+	}
+
+	if group, ok := node.(ConditionGroup); ok {
+		return group, nil
+	}
+	return ConditionGroup{Operator: And, Conditions: []interface{}{node}}, nil
+}
+
+type dslParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *dslParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *dslParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *dslParser) errorf(tok token, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *dslParser) isPunct(text string) bool {
+	tok := p.peek()
+	return tok.kind == tokenPunct && tok.text == text
+}
+
+func (p *dslParser) isKeyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokenIdent && !tok.quoted && tok.text == word
+}
+
+func (p *dslParser) expectPunct(text string) error {
+	if !p.isPunct(text) {
+		tok := p.peek()
+		return p.errorf(tok, "expected %q, found %s", text, tok)
+	}
+	p.next()
+	return nil
+}
+
+func (p *dslParser) parseOr() (interface{}, error) {
+	return p.parseChain(Or, "||", "or", p.parseAnd)
+}
+
+func (p *dslParser) parseAnd() (interface{}, error) {
+	return p.parseChain(And, "&&", "and", p.parsePrimary)
+}
+
+// parseChain parses operands joined by one logical operator, flattening
+// directly nested groups that use the same operator.
+func (p *dslParser) parseChain(op LogicalOperator, symbol, word string, operand func() (interface{}, error)) (interface{}, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []interface{}
+	add := func(node interface{}) {
+		if group, ok := node.(ConditionGroup); ok && group.Operator == op {
+			conditions = append(conditions, group.Conditions...)
+			return
+		}
+		conditions = append(conditions, node)
+	}
+	add(first)
+
+	for p.isPunct(symbol) || p.isKeyword(word) {
+		p.next()
+		node, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		add(node)
+	}
+
+	if len(conditions) == 1 {
+		return first, nil
+	}
+	return ConditionGroup{Operator: op, Conditions: conditions}, nil
+}
+
+func (p *dslParser) parsePrimary() (interface{}, error) {
+	if p.isPunct("!") || p.isKeyword("not") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokenPunct && p.tokens[p.pos+1].text == "(" {
+		tok := p.next()
+		node, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		negated, ok := negateNode(node)
+		if !ok {
+			return nil, p.errorf(tok, "%s cannot negate true", tok)
+		}
+		return negated, nil
+	}
+
+	// A bare true is the empty group; "true == x" is a comparison.
+	if p.isKeyword("true") && p.pos+1 < len(p.tokens) {
+		switch after := p.tokens[p.pos+1]; {
+		case after.kind == tokenEOF,
+			after.kind == tokenPunct && (after.text == "&&" || after.text == "||" || after.text == ")"),
+			after.kind == tokenIdent && !after.quoted && (after.text == "and" || after.text == "or"):
+			p.next()
+			return ConditionGroup{Operator: And, Conditions: []interface{}{}}, nil
+		}
+	}
+
+	if p.isPunct("(") {
+		start := p.pos
+		p.next()
+		node, err := p.parseOr()
+		if err == nil {
+			err = p.expectPunct(")")
+		}
+		if err == nil {
+			return node, nil
+		}
+
+		// The parenthesis may instead open a computed operand, as in
+		// "(a + b) > 10".
+		p.pos = start
+		if cond, condErr := p.parseComparison(); condErr == nil {
+			return cond, nil
+		}
+		return nil, err
+	}
+
+	return p.parseComparison()
+}
+
+// negateNode negates a condition or, by De Morgan's laws, a group. The empty
+// group always matches and cannot be negated.
+func negateNode(node interface{}) (interface{}, bool) {
+	switch n := node.(type) {
+	case Condition:
+		n.Not = !n.Not
+		return n, true
+	case ConditionGroup:
+		if len(n.Conditions) == 0 {
+			return nil, false
+		}
+		negated := ConditionGroup{Operator: Or, Conditions: make([]interface{}, len(n.Conditions))}
+		if n.Operator == Or {
+			negated.Operator = And
+		}
+		for i, child := range n.Conditions {
+			c, ok := negateNode(child)
+			if !ok {
+				return nil, false
+			}
+			negated.Conditions[i] = c
+		}
+		return negated, true
+	}
+	return nil, false
+}
+
+func (p *dslParser) parseComparison() (interface{}, error) {
+	left, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	var cond Condition
+	if fact, ok := left.(exprFact); ok {
+		cond.Fact = string(fact)
+	} else {
+		cond.Expr = formatExpression(left)
+	}
+
+	opTok := p.peek()
+	switch {
+	case opTok.kind == tokenPunct:
+		op, ok := dslOperators[opTok.text]
+		if !ok {
+			return nil, p.errorf(opTok, "expected an operator, found %s", opTok)
+		}
+		p.next()
+		value, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		cond.Operator, cond.Value = op, value
+
+		if value == nil && op == Equal {
+			cond.Operator = IsNull
+		} else if value == nil && op == NotEqual {
+			cond.Operator = IsNotNull
+		}
+
+	case p.isKeyword("in"):
+		p.next()
+		value, err := p.parseArray()
+		if err != nil {
+			return nil, err
+		}
+		cond.Operator, cond.Value = In, value
+
+	case p.isKeyword("not"):
+		p.next()
+		if !p.isKeyword("in") {
+			return nil, p.errorf(p.peek(), "expected \"in\" after \"not\", found %s", p.peek())
+		}
+		p.next()
+		value, err := p.parseArray()
+		if err != nil {
+			return nil, err
+		}
+		cond.Operator, cond.Value = NotIn, value
+
+	case p.isKeyword("is"):
+		p.next()
+		cond.Operator = IsNull
+		if p.isKeyword("not") {
+			p.next()
+			cond.Operator = IsNotNull
+		}
+		if !p.isKeyword("null") {
+			return nil, p.errorf(p.peek(), "expected \"null\", found %s", p.peek())
+		}
+		p.next()
+
+	case opTok.kind == tokenIdent && !opTok.quoted:
+		p.next()
+		value, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		cond.Operator, cond.Value = Operator(opTok.text), value
+
+	default:
+		return nil, p.errorf(opTok, "expected an operator after %q, found %s", cond.Fact+cond.Expr, opTok)
+	}
+
+	return cond, nil
+}
+
+// parseOperand parses the right-hand side of a comparison: a literal value,
+// or an expression returned as an {"expr": "..."} value.
+func (p *dslParser) parseOperand() (interface{}, error) {
+	if p.isPunct("[") || p.isPunct("{") {
+		return p.parseValue()
+	}
+
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if lit, ok := x.(exprLiteral); ok {
+		return lit.value, nil
+	}
+	return map[string]interface{}{"expr": formatExpression(x)}, nil
+}
+
+func (p *dslParser) parseValue() (interface{}, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokenNumber, tok.kind == tokenString:
+		p.next()
+		return tok.value, nil
+
+	case tok.kind == tokenPunct && tok.text == "-":
+		p.next()
+		num := p.next()
+		if num.kind != tokenNumber {
+			return nil, p.errorf(num, "expected a number after \"-\", found %s", num)
+		}
+		return -num.value.(float64), nil
+
+	case tok.kind == tokenPunct && tok.text == "[":
+		return p.parseArray()
+
+	case tok.kind == tokenPunct && tok.text == "{":
+		return p.parseObject()
+
+	case p.isKeyword("true"):
+		p.next()
+		return true, nil
+
+	case p.isKeyword("false"):
+		p.next()
+		return false, nil
+
+	case p.isKeyword("null"):
+		p.next()
+		return nil, nil
+	}
+
+	return nil, p.errorf(tok, "expected a value, found %s", tok)
+}
+
+func (p *dslParser) parseArray() ([]interface{}, error) {
+	if err := p.expectPunct("["); err != nil {
+		return nil, err
+	}
+
+	items := []interface{}{}
+	for !p.isPunct("]") {
+		item, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expectPunct("]"); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (p *dslParser) parseObject() (map[string]interface{}, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+
+	obj := map[string]interface{}{}
+	for !p.isPunct("}") {
+		keyTok := p.next()
+		var key string
+		switch keyTok.kind {
+		case tokenString:
+			key = keyTok.value.(string)
+		case tokenIdent:
+			key = keyTok.text
+		default:
+			return nil, p.errorf(keyTok, "expected an object key, found %s", keyTok)
+		}
+
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = value
+
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expectPunct("}"); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// FormatConditions renders group in the expression language. The result
+// parses back into an equivalent group.
+func FormatConditions(group ConditionGroup) string {
+	var sb strings.Builder
+	formatGroup(&sb, group, false)
+	return sb.String()
+}
+
+// String renders the group in the expression language.
+func (cg ConditionGroup) String() string {
+	return FormatConditions(cg)
+}
+
+func formatGroup(sb *strings.Builder, group ConditionGroup, nested bool) {
+	if len(group.Conditions) == 0 {
+		sb.WriteString("true")
+		return
+	}
+	if len(group.Conditions) == 1 {
+		formatNode(sb, group.Conditions[0], nested)
+		return
+	}
+
+	symbol := " && "
+	if group.Operator == Or {
+		symbol = " || "
+	}
+
+	if nested {
+		sb.WriteString("(")
+	}
+	for i, condition := range group.Conditions {
+		if i > 0 {
+			sb.WriteString(symbol)
+		}
+		formatNode(sb, condition, true)
+	}
+	if nested {
+		sb.WriteString(")")
+	}
+}
+
+func formatNode(sb *strings.Builder, node interface{}, nested bool) {
+	switch cond := node.(type) {
+	case Condition:
+		formatCondition(sb, cond)
+	case ConditionGroup:
+		formatGroup(sb, cond, nested)
+	}
+}
+
+func formatCondition(sb *strings.Builder, cond Condition) {
+	if cond.Not {
+		sb.WriteString("!(")
+		cond.Not = false
+		formatCondition(sb, cond)
+		sb.WriteString(")")
+		return
+	}
+
+	if cond.Expr != "" {
+		sb.WriteString(cond.Expr)
+	} else {
+		sb.WriteString(formatFact(cond.Fact))
+	}
+
+	switch cond.Operator {
+	case IsNull:
+		sb.WriteString(" is null")
+		return
+	case IsNotNull:
+		sb.WriteString(" is not null")
+		return
+	case In:
+		sb.WriteString(" in ")
+	case NotIn:
+		sb.WriteString(" not in ")
+	default:
+		symbol := string(cond.Operator)
+		for text, op := range dslOperators {
+			if op == cond.Operator {
+				symbol = text
+				break
+			}
+		}
+		sb.WriteString(" " + symbol + " ")
+	}
+
+	if src, ok := valueExpression(cond.Value); ok {
+		sb.WriteString(src)
+		return
+	}
+	sb.WriteString(formatValue(cond.Value))
+}
+
+func formatFact(fact string) string {
+	if fact == "" {
+		return "``"
+	}
+	for i, r := range fact {
+		if (i == 0 && !isIdentStart(r)) || !isIdentPart(r) {
+			return "`" + fact + "`"
+		}
+	}
+	switch fact {
+	case "and", "or", "in", "not", "is", "null", "true", "false":
+		return "`" + fact + "`"
+	}
+	return fact
+}
+
+func formatValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%q", fmt.Sprint(v))
+	}
+	return string(data)
+}
@@ -0,0 +1,128 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSyntaxErrorPositions(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Position
+	}{
+		{`age >= `, Position{1, 8}},
+		{`age # 1`, Position{1, 5}},
+		{`name == "unterminated`, Position{1, 9}},
+		{"`quoted", Position{1, 1}},
+		{"age > 1 &&\n  country ~ \"VN\"", Position{2, 11}},
+		{"age > 1 &&\n  country is 5", Position{2, 14}},
+		{`age > 1 && (country == "VN"`, Position{1, 28}},
+		{`country not ["VN"]`, Position{1, 13}},
+		{`country in "VN"`, Position{1, 12}},
+		{`ä > 1 && ö ? 2`, Position{1, 12}},
+		{`!(a > 1 || true)`, Position{1, 1}},
+	}
+	for _, tt := range tests {
+		_, err := ParseConditions(tt.src)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: got %v, want a syntax error", tt.src, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.want {
+			t.Errorf("%q: error at %s, want %s (%v)", tt.src, syntaxErr.Pos, tt.want, err)
+		}
+	}
+}
+
+func TestNegatedGroups(t *testing.T) {
+	eng := NewEngine()
+	tests := []struct {
+		src   string
+		facts map[string]interface{}
+		want  bool
+	}{
+		{`!(a == 1 && b == 2)`, map[string]interface{}{"a": 1, "b": 2}, false},
+		{`!(a == 1 && b == 2)`, map[string]interface{}{"a": 1, "b": 3}, true},
+		{`!(a == 1 && b == 2)`, map[string]interface{}{}, true},
+		{`not (a == 1 || b == 2)`, map[string]interface{}{"a": 2, "b": 3}, true},
+		{`not (a == 1 || b == 2)`, map[string]interface{}{"a": 2, "b": 2}, false},
+		{`!(a == 1 && !(b == 2 || c == 3)) && d == 4`, map[string]interface{}{"a": 1, "c": 3, "d": 4}, true},
+		{`!(a == 1 && !(b == 2 || c == 3)) && d == 4`, map[string]interface{}{"a": 1, "d": 4}, false},
+		{`!!(a == 1 && b == 2)`, map[string]interface{}{"a": 1, "b": 2}, true},
+		{`true`, map[string]interface{}{}, true},
+		{`a == 1 || true`, map[string]interface{}{}, true},
+	}
+	for _, tt := range tests {
+		group, err := ParseConditions(tt.src)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		got, err := eng.evaluateConditionGroup(group, &exprEnv{facts: tt.facts})
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q with %v = %v, want %v", tt.src, tt.facts, got, tt.want)
+		}
+	}
+}
+
+func TestFormatConditionsRoundTrip(t *testing.T) {
+	sources := []string{
+		`true`,
+		`age >= 21`,
+		`age >= 21 && (yearlyPurchases > 1000 || membershipLevel in ["gold", "platinum"])`,
+		`!(country == "VN") || tier is not null`,
+		`!(a == 1 && b == 2)`,
+		"`user.first-name` =~ \"^A\" && `in` != 'x'",
+		`orderTotal > 0.3 * monthlyIncome && len(items) > 5`,
+		`score divisibleBy 5 && tags not in [1, null, {"a": [true]}]`,
+		`(a + b) * 2 >= c`,
+	}
+	for _, src := range sources {
+		group, err := ParseConditions(src)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		formatted := FormatConditions(group)
+		again, err := ParseConditions(formatted)
+		if err != nil {
+			t.Errorf("%q formatted as %q: %v", src, formatted, err)
+			continue
+		}
+		if !reflect.DeepEqual(again, group) {
+			t.Errorf("%q formatted as %q parses to %#v, want %#v", src, formatted, again, group)
+		}
+	}
+
+	groups := []ConditionGroup{
+		{Operator: And, Conditions: []interface{}{}},
+		{Operator: Or, Conditions: []interface{}{
+			Condition{Fact: "a", Operator: Equal, Value: 1.0},
+			ConditionGroup{Operator: And, Conditions: []interface{}{}},
+		}},
+		{Operator: And, Conditions: []interface{}{
+			Condition{Expr: "a * 2", Operator: GreaterThan, Value: map[string]interface{}{"expr": "b + 1"}, Not: true},
+			ConditionGroup{Operator: Or, Conditions: []interface{}{
+				Condition{Fact: "c", Operator: IsNull},
+				Condition{Fact: "d", Operator: NotIn, Value: []interface{}{"x"}},
+			}},
+		}},
+	}
+	for _, group := range groups {
+		formatted := FormatConditions(group)
+		got, err := ParseConditions(formatted)
+		if err != nil {
+			t.Errorf("%#v formatted as %q: %v", group, formatted, err)
+			continue
+		}
+		if FormatConditions(got) != formatted {
+			t.Errorf("%q parses back as %q", formatted, FormatConditions(got))
+		}
+	}
+}
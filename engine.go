@@ -1,15 +1,24 @@
 package go_json_rules_engine
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"regexp"
 	"sync"
+	"time"
 )
 
 type Engine struct {
-	customOperators map[Operator]CustomOperatorFunc
-	mu              sync.RWMutex
+	customOperators  map[Operator]CustomOperatorFunc
+	operatorSpecs    map[Operator]OperatorSpec
+	facts            map[string]FactDefinition
+	clock            Clock
+	handlers         handlerRegistry
+	conflictPolicies []ConflictPolicy
+	ruleSets         map[string]*namedRuleSet
+	shadow           shadowState
+	mu               sync.RWMutex
 }
 
 type CustomOperatorFunc func(a, b interface{}) bool
@@ -17,10 +26,15 @@ type CustomOperatorFunc func(a, b interface{}) bool
 func NewEngine() *Engine {
 	return &Engine{
 		customOperators: make(map[Operator]CustomOperatorFunc),
+		operatorSpecs:   make(map[Operator]OperatorSpec),
+		facts:           make(map[string]FactDefinition),
 	}
 }
 
-func (e *Engine) RegisterCustomOperator(op Operator, fn CustomOperatorFunc) error {
+// RegisterCustomOperator registers fn under op. Options declare the operands
+// the operator accepts; see WithOperandTypes, WithValueValidator and
+// WithValueCoercion.
+func (e *Engine) RegisterCustomOperator(op Operator, fn CustomOperatorFunc, opts ...OperatorOption) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
@@ -28,7 +42,13 @@ func (e *Engine) RegisterCustomOperator(op Operator, fn CustomOperatorFunc) erro
 		return fmt.Errorf("operator %s is already registered", op)
 	}
 
+	spec := OperatorSpec{FactTypes: TypeAny, ValueTypes: TypeAny}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+
 	e.customOperators[op] = fn
+	e.operatorSpecs[op] = spec
 	return nil
 }
 
@@ -36,105 +56,408 @@ func (e *Engine) UnregisterCustomOperator(op Operator) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	delete(e.customOperators, op)
+	delete(e.operatorSpecs, op)
+}
+
+// EvaluateOption configures a single evaluation.
+type EvaluateOption func(*evaluateConfig)
+
+type evaluateConfig struct {
+	validateFacts bool
+	selector      *TagSelector
+	escape        func(string) string
+	explain       bool
+	now           time.Time
+
+	// dispatch is called by Run for each rule that did not match and each
+	// event that fired, with the rules whose event it is.
+	dispatch    func(rules []ruleOption, event Event, matched bool) error
+	stopOnError bool
+	transaction bool
+
+	// setVersion and operators are used when evaluating a rule set;
+	// operatorSet names the set whose operators a tree sees.
+	setVersion  *string
+	operators   map[Operator]customOperator
+	operatorSet string
+}
+
+func (e *Engine) newEvaluateConfig(opts []EvaluateOption) evaluateConfig {
+	cfg := evaluateConfig{now: e.now()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithFactValidation checks the supplied facts against the facts declared on
+// the engine before evaluating, returning the mismatches as *FactError
+// values instead of silently not matching.
+func WithFactValidation() EvaluateOption {
+	return func(cfg *evaluateConfig) {
+		cfg.validateFacts = true
+	}
+}
+
+// WithTagSelector restricts evaluation to the rules whose tags match sel.
+func WithTagSelector(sel *TagSelector) EvaluateOption {
+	return func(cfg *evaluateConfig) {
+		cfg.selector = sel
+	}
+}
+
+// WithParamEscaper replaces html.EscapeString as the escaper of the strings
+// that templates insert into event params, e.g. with a JSON or SQL escaper.
+// Pass a function returning its argument to insert strings unchanged.
+func WithParamEscaper(escape func(string) string) EvaluateOption {
+	return func(cfg *evaluateConfig) {
+		cfg.escape = escape
+	}
+}
+
+// SetClock replaces the clock used to decide whether rules are within their
+// activation window. A nil clock restores the system clock.
+func (e *Engine) SetClock(clock Clock) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clock = clock
 }
 
-func (e *Engine) Evaluate(rules *Rule, facts map[string]interface{}) ([]Event, error) {
-	var events []Event
+func (e *Engine) now() time.Time {
+	e.mu.RLock()
+	clock := e.clock
+	e.mu.RUnlock()
 
-	for _, rule := range rules.GetRules() {
-		if e.evaluateConditionGroup(rule.Conditions, facts) {
-			events = append(events, rule.Event)
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
+
+// skipReason explains why a rule does not take part in an evaluation, or
+// returns "" if it does.
+func (cfg *evaluateConfig) skipReason(rule ruleOption) string {
+	if !rule.IsEnabled() {
+		return "disabled"
+	}
+	if cfg.selector != nil && !cfg.selector.Matches(rule.Tags) {
+		return fmt.Sprintf("not selected by tags %q", cfg.selector)
+	}
+	if rule.EffectiveFrom != nil && cfg.now.Before(*rule.EffectiveFrom) {
+		return fmt.Sprintf("inactive: effective from %s", rule.EffectiveFrom.Format(time.RFC3339))
+	}
+	if rule.EffectiveUntil != nil && !cfg.now.Before(*rule.EffectiveUntil) {
+		return fmt.Sprintf("inactive: expired at %s", rule.EffectiveUntil.Format(time.RFC3339))
+	}
+	if rule.Schedule != nil && !rule.Schedule.Active(cfg.now) {
+		return fmt.Sprintf("inactive: outside schedule %q", rule.Schedule.Cron)
+	}
+	return ""
+}
+
+// Evaluate returns the events of the rules matching facts. Rules whose
+// conditions fail to evaluate, e.g. because an expression divides by zero,
+// do not match; they are reported as *EvaluationError values in the
+// returned error, alongside the events of the other rules.
+func (e *Engine) Evaluate(rules *Rule, facts map[string]interface{}, opts ...EvaluateOption) ([]Event, error) {
+	cfg := e.newEvaluateConfig(opts)
+
+	result, err := e.evaluate(rules, facts, &cfg)
+	if result == nil {
+		return nil, err
+	}
+	return result.Events, err
+}
+
+// evaluate runs rules against facts. Traces of every rule are only recorded
+// when cfg.explain is set; otherwise, unless handlers are dispatched, the
+// rule index may skip rules that cannot match. The result is nil only if the
+// facts are invalid.
+func (e *Engine) evaluate(rules *Rule, facts map[string]interface{}, cfg *evaluateConfig) (*Explanation, error) {
+	if cfg.validateFacts {
+		if err := e.ValidateFacts(facts); err != nil {
+			return nil, err
 		}
 	}
 
-	return events, nil
+	candidates := rules.GetRules()
+	if !cfg.explain && cfg.dispatch == nil {
+		candidates = e.candidateRules(rules, facts, cfg.operators)
+	}
+
+	result := &Explanation{}
+	env := &exprEnv{facts: facts, now: cfg.now, operators: cfg.operators}
+	policies := e.currentConflictPolicies()
+	fired := make(activations)
+	var errs []error
+	stopped := false
+	for _, rule := range candidates {
+		trace := RuleTrace{RuleID: rule.ID, Name: rule.Name, Priority: rule.Priority}
+
+		var event Event
+		var matched bool
+		var err error
+		if reason := cfg.skipReason(rule); reason != "" {
+			trace.Status, trace.Reason = RuleSkipped, reason
+		} else if reason := fired.skipReason(rule); reason != "" {
+			trace.Status, trace.Reason = RuleSkipped, reason
+		} else if reason := rule.Rollout.skipReason(rule, facts); reason != "" {
+			trace.Status, trace.Reason = RuleSkipped, reason
+		} else if event, matched, err = e.fire(rule, env, cfg); err != nil {
+			trace.Status, trace.Reason = RuleFailed, err.Error()
+			errs = append(errs, &EvaluationError{RuleID: rule.ID, Err: err})
+		} else if matched {
+			trace.Status = RuleMatched
+			fired.record(rule)
+			result.firedBy = append(result.firedBy, rule)
+			result.fired = append(result.fired, event)
+		} else {
+			trace.Status = RuleNotMatched
+		}
+
+		if cfg.explain {
+			result.Rules = append(result.Rules, trace)
+		}
+
+		// Events that may conflict are dispatched once conflicts are
+		// resolved.
+		if cfg.dispatch != nil && (trace.Status == RuleMatched || trace.Status == RuleNotMatched) && !(matched && coveredBy(policies, event.Type)) {
+			if !matched {
+				event = rule.Event
+			}
+			if err := cfg.dispatch([]ruleOption{rule}, event, matched); err != nil {
+				errs = append(errs, err)
+				if cfg.stopOnError {
+					stopped = true
+					break
+				}
+			}
+		}
+	}
+
+	firings, err := resolveConflicts(result, policies)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.dispatch != nil && !stopped {
+		for _, f := range firings {
+			if !coveredBy(policies, f.event.Type) {
+				continue
+			}
+			if err := cfg.dispatch(f.rules, f.event, true); err != nil {
+				errs = append(errs, err)
+				if cfg.stopOnError {
+					break
+				}
+			}
+		}
+	}
+	return result, errors.Join(errs...)
 }
 
-func (e *Engine) evaluateConditionGroup(group ConditionGroup, facts map[string]interface{}) bool {
+// fire evaluates the conditions of rule and, if they match, renders its
+// event.
+func (e *Engine) fire(rule ruleOption, env *exprEnv, cfg *evaluateConfig) (Event, bool, error) {
+	matched, err := e.evaluateConditionGroup(rule.Conditions, env)
+	if err != nil || !matched {
+		return Event{}, false, err
+	}
+	event, err := renderEvent(rule.Event, env, cfg.escape)
+	if err != nil {
+		return Event{}, false, err
+	}
+	return event, true, nil
+}
+
+// activations maps each activation group that has fired to the rule that
+// fired it.
+type activations map[string]string
+
+func (a activations) skipReason(rule ruleOption) string {
+	if winner, ok := a[rule.ActivationGroup]; ok && rule.ActivationGroup != "" {
+		return fmt.Sprintf("activation group %q already fired by %s", rule.ActivationGroup, winner)
+	}
+	return ""
+}
+
+func (a activations) record(rule ruleOption) {
+	if rule.ActivationGroup != "" {
+		a[rule.ActivationGroup] = rule.ID
+	}
+}
+
+// candidateRules returns the rules that can match facts, using the rule
+// set's index when the operators allow it.
+func (e *Engine) candidateRules(rules *Rule, facts map[string]interface{}, operators map[Operator]customOperator) []ruleOption {
+	all := rules.GetRules()
+	if rules.index == nil {
+		return all
+	}
+
+	// The index assumes built-in equality semantics.
+	env := &exprEnv{operators: operators}
+	_, _, customEqual := e.customOperator(Equal, env)
+	_, _, customIn := e.customOperator(In, env)
+	if customEqual || customIn {
+		return all
+	}
+
+	positions, ok := rules.index.candidates(facts)
+	if !ok {
+		return all
+	}
+
+	candidates := make([]ruleOption, len(positions))
+	for i, pos := range positions {
+		candidates[i] = all[pos]
+	}
+	return candidates
+}
+
+func (e *Engine) evaluateConditionGroup(group ConditionGroup, env *exprEnv) (bool, error) {
 	if len(group.Conditions) == 0 {
-		return true
+		return true, nil
 	}
 
 	switch group.Operator {
 	case And:
 		for _, condition := range group.Conditions {
-			switch cond := condition.(type) {
-			case Condition:
-				if !e.evaluateCondition(cond, facts) {
-					return false
-				}
-			case ConditionGroup:
-				if !e.evaluateConditionGroup(cond, facts) {
-					return false
-				}
+			matched, err := e.evaluateNode(condition, env)
+			if err != nil || !matched {
+				return false, err
 			}
 		}
-		return true
+		return true, nil
 
 	case Or:
 		for _, condition := range group.Conditions {
-			switch cond := condition.(type) {
-			case Condition:
-				if e.evaluateCondition(cond, facts) {
-					return true
-				}
-			case ConditionGroup:
-				if e.evaluateConditionGroup(cond, facts) {
-					return true
-				}
+			matched, err := e.evaluateNode(condition, env)
+			if err != nil || matched {
+				return matched, err
 			}
 		}
-		return false
+		return false, nil
 
 	default:
-		return false
+		return false, nil
 	}
 }
 
-func (e *Engine) evaluateCondition(condition Condition, facts map[string]interface{}) bool {
-	factValue, exists := facts[condition.Fact]
-	if !exists {
-		return false
+func (e *Engine) evaluateNode(node interface{}, env *exprEnv) (bool, error) {
+	switch cond := node.(type) {
+	case Condition:
+		return e.evaluateCondition(cond, env)
+	case ConditionGroup:
+		return e.evaluateConditionGroup(cond, env)
+	default:
+		return false, nil
+	}
+}
+
+func (e *Engine) evaluateCondition(condition Condition, env *exprEnv) (bool, error) {
+	if condition.Not {
+		condition.Not = false
+		matched, err := e.evaluateCondition(condition, env)
+		return !matched && err == nil, err
 	}
 
-	// Check for custom operator first
-	e.mu.RLock()
-	customFn, isCustom := e.customOperators[condition.Operator]
-	e.mu.RUnlock()
+	var factValue interface{}
+	if condition.Expr != "" {
+		value, err := evaluateExpression(condition.Expr, env)
+		if err != nil {
+			return false, ignoreMissingFact(err)
+		}
+		factValue = value
+	} else {
+		value, exists := lookupFact(env.facts, condition.Fact)
+		if !exists {
+			return false, nil
+		}
+		factValue = value
+	}
 
-	if isCustom {
-		return customFn(factValue, condition.Value)
+	value := condition.Value
+	if src, ok := valueExpression(value); ok {
+		computed, err := evaluateExpression(src, env)
+		if err != nil {
+			return false, ignoreMissingFact(err)
+		}
+		value = computed
+	}
+
+	// Check for custom operator first
+	if customFn, spec, isCustom := e.customOperator(condition.Operator, env); isCustom {
+		if spec.Coerce != nil {
+			coerced, err := spec.Coerce(value)
+			if err != nil {
+				return false, nil
+			}
+			value = coerced
+		}
+		return customFn(factValue, value), nil
 	}
 
 	// Handle built-in operators
 	switch condition.Operator {
 	case Equal:
-		return e.compareEqual(factValue, condition.Value)
+		return e.compareEqual(factValue, value), nil
 	case NotEqual:
-		return !e.compareEqual(factValue, condition.Value)
+		return !e.compareEqual(factValue, value), nil
 	case GreaterThan:
-		return e.compareGreaterThan(factValue, condition.Value)
+		return e.compareGreaterThan(factValue, value), nil
 	case LessThan:
-		return e.compareLessThan(factValue, condition.Value)
+		return e.compareLessThan(factValue, value), nil
 	case GreaterThanInc:
-		return e.compareGreaterThanOrEqual(factValue, condition.Value)
+		return e.compareGreaterThanOrEqual(factValue, value), nil
 	case LessThanInc:
-		return e.compareLessThanOrEqual(factValue, condition.Value)
+		return e.compareLessThanOrEqual(factValue, value), nil
 	case In:
-		return e.evaluateIn(factValue, condition.Value)
+		return e.evaluateIn(factValue, value), nil
 	case NotIn:
-		return !e.evaluateIn(factValue, condition.Value)
+		return !e.evaluateIn(factValue, value), nil
 	case Regex:
-		return e.evaluateRegex(factValue, condition.Value)
+		return e.evaluateRegex(factValue, value), nil
 	case IsNull:
-		return factValue == nil
+		return factValue == nil, nil
 	case IsNotNull:
-		return factValue != nil
+		return factValue != nil, nil
+	case InBucket:
+		return e.evaluateInBucket(factValue, value), nil
 	default:
-		return false
+		return false, nil
 	}
 }
 
+// customOperator returns the custom operator op, preferring one registered
+// on the rule set being evaluated.
+func (e *Engine) customOperator(op Operator, env *exprEnv) (CustomOperatorFunc, OperatorSpec, bool) {
+	if custom, ok := env.operators[op]; ok {
+		return custom.fn, custom.spec, true
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	fn, ok := e.customOperators[op]
+	return fn, e.operatorSpecs[op], ok
+}
+
+func evaluateExpression(src string, env *exprEnv) (interface{}, error) {
+	expr, err := compileExpression(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src, err)
+	}
+	return expr.eval(env)
+}
+
+// ignoreMissingFact drops errMissingFact: like plain facts, conditions on
+// computed operands that reference missing facts just do not match.
+func ignoreMissingFact(err error) error {
+	if errors.Is(err, errMissingFact) {
+		return nil
+	}
+	return err
+}
+
 func (e *Engine) compareEqual(a, b interface{}) bool {
 	if a == nil && b == nil {
 		return true
@@ -243,6 +566,10 @@ func (e *Engine) IsNumeric(v reflect.Value) bool {
 
 // ToFloat64 converts any numeric type to float64
 func (e *Engine) ToFloat64(v reflect.Value) float64 {
+	return toFloat64(v)
+}
+
+func toFloat64(v reflect.Value) float64 {
 	switch v.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return float64(v.Int())
@@ -18,7 +18,7 @@ func main() {
 			return false
 		}
 		return aFloat != 0 && bFloat != 0 && int(aFloat)%int(bFloat) == 0
-	})
+	}, go_json_rules_engine.WithOperandTypes(go_json_rules_engine.TypeNumber, go_json_rules_engine.TypeNumber))
 	if err != nil {
 		panic(err)
 	}
@@ -31,7 +31,7 @@ func main() {
 			return false
 		}
 		return len(bStr) > 0 && len(aStr) >= len(bStr) && aStr != "" && bStr != ""
-	})
+	}, go_json_rules_engine.WithOperandTypes(go_json_rules_engine.TypeString, go_json_rules_engine.TypeString))
 	if err != nil {
 		panic(err)
 	}
@@ -89,6 +89,11 @@ func main() {
 		panic(err)
 	}
 
+	// Type-check the rules against the registered operators
+	if err := eng.Validate(rules); err != nil {
+		panic(err)
+	}
+
 	// Test cases
 	testCases := []map[string]interface{}{
 		{
@@ -0,0 +1,49 @@
+package go_json_rules_engine
+
+// RuleStatus is the outcome of a single rule in an evaluation.
+type RuleStatus string
+
+const (
+	RuleMatched    RuleStatus = "matched"
+	RuleNotMatched RuleStatus = "notMatched"
+	RuleSkipped    RuleStatus = "skipped"
+	RuleFailed     RuleStatus = "error"
+	RuleOverridden RuleStatus = "overridden"
+)
+
+// RuleTrace records what happened to one rule during an evaluation. Reason
+// explains why a skipped rule did not take part, e.g. because it is disabled
+// or outside its activation window, why a rule failed, or which conflict
+// policy overrode its event.
+type RuleTrace struct {
+	RuleID   string     `json:"ruleId"`
+	Name     string     `json:"name,omitempty"`
+	Priority int        `json:"priority"`
+	Status   RuleStatus `json:"status"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+// Explanation is the result of Engine.Explain: the events Evaluate would
+// return together with a trace of every rule in evaluation order and the
+// conflicts resolved between their events.
+type Explanation struct {
+	Events    []Event         `json:"events"`
+	Rules     []RuleTrace     `json:"rules"`
+	Conflicts []ConflictTrace `json:"conflicts,omitempty"`
+
+	// fired lists the events of the rules that matched, firedBy those
+	// rules, before conflicts were resolved. matched lists the rules whose
+	// events survived conflict resolution.
+	fired   []Event
+	firedBy []ruleOption
+	matched []ruleOption
+}
+
+// Explain evaluates rules like Evaluate but also reports, for every rule,
+// whether it matched, did not match, failed to evaluate, or was skipped and
+// why.
+func (e *Engine) Explain(rules *Rule, facts map[string]interface{}, opts ...EvaluateOption) (*Explanation, error) {
+	cfg := e.newEvaluateConfig(opts)
+	cfg.explain = true
+	return e.evaluate(rules, facts, &cfg)
+}
@@ -0,0 +1,786 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Computed operands are written in a small expression language sharing the
+// lexer of ParseConditions:
+//
+//	0.3 * monthlyIncome
+//	len(items)
+//	daysSince(signupDate) / 7
+//
+// Expressions combine numbers, strings, true, false, null and fact names
+// with + - * / % and unary minus, all of which work on numbers, and call the
+// functions listed in exprFuncs. A condition uses an expression instead of a
+// fact through its Expr field and as a value through {"expr": "..."}.
+
+var (
+	// ErrDivisionByZero is reported when an expression divides by zero.
+	ErrDivisionByZero = errors.New("division by zero")
+	// ErrOverflow is reported when an expression's result is too large to
+	// be represented.
+	ErrOverflow = errors.New("numeric overflow")
+
+	// errMissingFact stops the evaluation of an expression that references
+	// a fact that was not supplied; the condition then does not match.
+	errMissingFact = errors.New("missing fact")
+)
+
+// EvaluationError reports a rule whose conditions could not be evaluated,
+// for example because an expression divided by zero.
+type EvaluationError struct {
+	RuleID string
+	Err    error
+}
+
+func (e *EvaluationError) Error() string {
+	return fmt.Sprintf("rule %s: %v", e.RuleID, e.Err)
+}
+
+func (e *EvaluationError) Unwrap() error {
+	return e.Err
+}
+
+type expression struct {
+	src  string
+	root exprNode
+}
+
+// maxCachedSources bounds the compiled expressions and templates kept in
+// memory, so that sources generated at run time cannot grow the caches
+// without limit.
+const maxCachedSources = 4096
+
+// boundedCache maps sources to their compiled form and holds at most max
+// entries. Once full, storing an entry evicts an arbitrary one; compiling
+// again is the only cost of a miss.
+type boundedCache struct {
+	mu      sync.RWMutex
+	max     int
+	entries map[string]interface{}
+}
+
+func newBoundedCache(max int) *boundedCache {
+	return &boundedCache{max: max, entries: make(map[string]interface{})}
+}
+
+func (c *boundedCache) Load(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok := c.entries[key]
+	return value, ok
+}
+
+func (c *boundedCache) Store(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.max {
+		for evicted := range c.entries {
+			delete(c.entries, evicted)
+			break
+		}
+	}
+	c.entries[key] = value
+}
+
+func (c *boundedCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// expressionCache holds compiled expressions by source so that conditions
+// only parse them once.
+var expressionCache = newBoundedCache(maxCachedSources)
+
+// compileExpression parses src, reusing earlier results.
+func compileExpression(src string) (*expression, error) {
+	if cached, ok := expressionCache.Load(src); ok {
+		return cached.(*expression), nil
+	}
+
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &dslParser{tokens: tokens}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	if _, err := root.typ(anyFactType); err != nil {
+		return nil, err
+	}
+
+	expr := &expression{src: src, root: root}
+	expressionCache.Store(src, expr)
+	return expr, nil
+}
+
+// valueExpression returns the source of a {"expr": "..."} value.
+func valueExpression(value interface{}) (string, bool) {
+	obj, ok := value.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		return "", false
+	}
+	src, ok := obj["expr"].(string)
+	return src, ok
+}
+
+func (x *expression) eval(env *exprEnv) (interface{}, error) {
+	value, err := x.root.eval(env)
+	if err != nil && !errors.Is(err, errMissingFact) {
+		return nil, fmt.Errorf("%s: %w", x.src, err)
+	}
+	return value, err
+}
+
+// facts lists the facts the expression references.
+func (x *expression) facts() []string {
+	seen := make(map[string]bool)
+	x.root.walk(func(node exprNode) {
+		if ref, ok := node.(exprFact); ok {
+			seen[string(ref)] = true
+		}
+	})
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type exprEnv struct {
+	facts map[string]interface{}
+	now   time.Time
+	// operators are the custom operators of the rule set being evaluated.
+	operators map[Operator]customOperator
+}
+
+func anyFactType(string) ValueType { return TypeAny }
+
+type exprNode interface {
+	eval(env *exprEnv) (interface{}, error)
+	// typ infers the type of the node given the types of facts.
+	typ(factType func(string) ValueType) (ValueType, error)
+	walk(visit func(exprNode))
+	format(sb *strings.Builder)
+	precedence() int
+}
+
+const (
+	precAdditive = iota + 1
+	precMultiplicative
+	precUnary
+	precPrimary
+)
+
+type exprLiteral struct{ value interface{} }
+
+func (n exprLiteral) eval(*exprEnv) (interface{}, error) { return n.value, nil }
+
+func (n exprLiteral) typ(func(string) ValueType) (ValueType, error) {
+	return TypeOf(n.value), nil
+}
+
+func (n exprLiteral) walk(visit func(exprNode)) { visit(n) }
+
+func (n exprLiteral) format(sb *strings.Builder) {
+	if v, ok := n.value.(float64); ok {
+		sb.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		return
+	}
+	sb.WriteString(formatValue(n.value))
+}
+
+func (n exprLiteral) precedence() int { return precPrimary }
+
+type exprFact string
+
+func (n exprFact) eval(env *exprEnv) (interface{}, error) {
+	value, ok := lookupFact(env.facts, string(n))
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errMissingFact, string(n))
+	}
+	return value, nil
+}
+
+func (n exprFact) typ(factType func(string) ValueType) (ValueType, error) {
+	return factType(string(n)), nil
+}
+
+func (n exprFact) walk(visit func(exprNode)) { visit(n) }
+
+func (n exprFact) format(sb *strings.Builder) { sb.WriteString(formatFact(string(n))) }
+
+func (n exprFact) precedence() int { return precPrimary }
+
+type exprUnary struct{ x exprNode }
+
+func (n exprUnary) eval(env *exprEnv) (interface{}, error) {
+	v, err := evalNumber(env, n.x, "-")
+	if err != nil {
+		return nil, err
+	}
+	return -v, nil
+}
+
+func (n exprUnary) typ(factType func(string) ValueType) (ValueType, error) {
+	return TypeNumber, expectType(n.x, factType, TypeNumber, `operand of "-"`)
+}
+
+func (n exprUnary) walk(visit func(exprNode)) {
+	visit(n)
+	n.x.walk(visit)
+}
+
+func (n exprUnary) format(sb *strings.Builder) {
+	sb.WriteString("-")
+	formatOperand(sb, n.x, precUnary, false)
+}
+
+func (n exprUnary) precedence() int { return precUnary }
+
+type exprBinary struct {
+	op   string
+	x, y exprNode
+}
+
+func (n exprBinary) eval(env *exprEnv) (interface{}, error) {
+	x, err := evalNumber(env, n.x, n.op)
+	if err != nil {
+		return nil, err
+	}
+	y, err := evalNumber(env, n.y, n.op)
+	if err != nil {
+		return nil, err
+	}
+
+	var result float64
+	switch n.op {
+	case "+":
+		result = x + y
+	case "-":
+		result = x - y
+	case "*":
+		result = x * y
+	case "/":
+		if y == 0 {
+			return nil, ErrDivisionByZero
+		}
+		result = x / y
+	case "%":
+		if y == 0 {
+			return nil, ErrDivisionByZero
+		}
+		result = math.Mod(x, y)
+	}
+	return checkNumber(result, x, y)
+}
+
+func (n exprBinary) typ(factType func(string) ValueType) (ValueType, error) {
+	context := fmt.Sprintf("operand of %q", n.op)
+	if err := expectType(n.x, factType, TypeNumber, context); err != nil {
+		return 0, err
+	}
+	return TypeNumber, expectType(n.y, factType, TypeNumber, context)
+}
+
+func (n exprBinary) walk(visit func(exprNode)) {
+	visit(n)
+	n.x.walk(visit)
+	n.y.walk(visit)
+}
+
+func (n exprBinary) format(sb *strings.Builder) {
+	prec := n.precedence()
+	formatOperand(sb, n.x, prec, false)
+	sb.WriteString(" " + n.op + " ")
+	formatOperand(sb, n.y, prec, n.op == "-" || n.op == "/" || n.op == "%")
+}
+
+func (n exprBinary) precedence() int {
+	if n.op == "+" || n.op == "-" {
+		return precAdditive
+	}
+	return precMultiplicative
+}
+
+type exprCall struct {
+	name string
+	fn   exprFunc
+	args []exprNode
+}
+
+func (n exprCall) eval(env *exprEnv) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if typ := n.fn.argType(i); !typ.Accepts(TypeOf(value)) {
+			return nil, fmt.Errorf("%s expects argument %d of type %s, got %s", n.name, i+1, typ, TypeOf(value))
+		}
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.String && rv.Type() != reflect.TypeOf("") {
+			// Functions may assert string arguments; unwrap named string types.
+			value = rv.String()
+		}
+		args[i] = value
+	}
+
+	result, err := n.fn.call(env, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	if v, ok := result.(float64); ok && (math.IsInf(v, 0) || math.IsNaN(v)) {
+		return nil, ErrOverflow
+	}
+	return result, nil
+}
+
+func (n exprCall) typ(factType func(string) ValueType) (ValueType, error) {
+	for i, arg := range n.args {
+		if err := expectType(arg, factType, n.fn.argType(i), fmt.Sprintf("argument %d of %s", i+1, n.name)); err != nil {
+			return 0, err
+		}
+	}
+	return n.fn.result, nil
+}
+
+func (n exprCall) walk(visit func(exprNode)) {
+	visit(n)
+	for _, arg := range n.args {
+		arg.walk(visit)
+	}
+}
+
+func (n exprCall) format(sb *strings.Builder) {
+	sb.WriteString(n.name + "(")
+	for i, arg := range n.args {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		arg.format(sb)
+	}
+	sb.WriteString(")")
+}
+
+func (n exprCall) precedence() int { return precPrimary }
+
+func formatOperand(sb *strings.Builder, node exprNode, prec int, right bool) {
+	if node.precedence() < prec || right && node.precedence() == prec {
+		sb.WriteString("(")
+		node.format(sb)
+		sb.WriteString(")")
+		return
+	}
+	node.format(sb)
+}
+
+func formatExpression(node exprNode) string {
+	var sb strings.Builder
+	node.format(&sb)
+	return sb.String()
+}
+
+func expectType(node exprNode, factType func(string) ValueType, want ValueType, context string) error {
+	typ, err := node.typ(factType)
+	if err != nil {
+		return err
+	}
+	if typ&want == 0 {
+		return fmt.Errorf("%s must be of type %s, got %s", context, want, typ)
+	}
+	return nil
+}
+
+func evalNumber(env *exprEnv, node exprNode, op string) (float64, error) {
+	value, err := node.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := numberValue(value)
+	if !ok {
+		return 0, fmt.Errorf("operand of %q must be of type number, got %s", op, TypeOf(value))
+	}
+	return n, nil
+}
+
+// checkNumber reports results that overflowed from finite operands.
+func checkNumber(result float64, operands ...float64) (interface{}, error) {
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		for _, operand := range operands {
+			if math.IsInf(operand, 0) || math.IsNaN(operand) {
+				return result, nil
+			}
+		}
+		return nil, ErrOverflow
+	}
+	return result, nil
+}
+
+func numberValue(v interface{}) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return toFloat64(rv), true
+	}
+	return 0, false
+}
+
+// parseExpr parses an arithmetic expression.
+func (p *dslParser) parseExpr() (exprNode, error) {
+	return p.parseBinary(precAdditive)
+}
+
+func (p *dslParser) parseBinary(prec int) (exprNode, error) {
+	if prec == precUnary {
+		return p.parseUnary()
+	}
+
+	ops := []string{"+", "-"}
+	if prec == precMultiplicative {
+		ops = []string{"*", "/", "%"}
+	}
+
+	x, err := p.parseBinary(prec + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		for _, candidate := range ops {
+			if p.isPunct(candidate) {
+				op = candidate
+			}
+		}
+		if op == "" {
+			return x, nil
+		}
+
+		p.next()
+		y, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = exprBinary{op: op, x: x, y: y}
+	}
+}
+
+func (p *dslParser) parseUnary() (exprNode, error) {
+	if !p.isPunct("-") {
+		return p.parseTerm()
+	}
+
+	p.next()
+	if tok := p.peek(); tok.kind == tokenNumber {
+		p.next()
+		return exprLiteral{-tok.value.(float64)}, nil
+	}
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return exprUnary{x}, nil
+}
+
+func (p *dslParser) parseTerm() (exprNode, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokenNumber, tok.kind == tokenString:
+		p.next()
+		return exprLiteral{tok.value}, nil
+
+	case p.isKeyword("true"):
+		p.next()
+		return exprLiteral{true}, nil
+
+	case p.isKeyword("false"):
+		p.next()
+		return exprLiteral{false}, nil
+
+	case p.isKeyword("null"):
+		p.next()
+		return exprLiteral{nil}, nil
+
+	case p.isPunct("("):
+		p.next()
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+
+	case tok.kind == tokenIdent:
+		p.next()
+		if tok.quoted || !p.isPunct("(") {
+			return exprFact(tok.text), nil
+		}
+		return p.parseCall(tok)
+	}
+
+	return nil, p.errorf(tok, "expected an operand, found %s", tok)
+}
+
+func (p *dslParser) parseCall(name token) (exprNode, error) {
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	p.next()
+
+	var args []exprNode
+	for !p.isPunct(")") {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+
+	if len(args) < fn.minArgs || fn.maxArgs >= 0 && len(args) > fn.maxArgs {
+		return nil, p.errorf(name, "%s expects %s, got %d", name.text, fn.arity(), len(args))
+	}
+	return exprCall{name: name.text, fn: fn, args: args}, nil
+}
+
+// exprFunc describes a function callable from expressions. maxArgs is -1
+// for variadic functions, whose last argument type repeats.
+type exprFunc struct {
+	minArgs, maxArgs int
+	args             []ValueType
+	result           ValueType
+	call             func(env *exprEnv, args []interface{}) (interface{}, error)
+}
+
+func (f exprFunc) argType(i int) ValueType {
+	if i >= len(f.args) {
+		return f.args[len(f.args)-1]
+	}
+	return f.args[i]
+}
+
+func (f exprFunc) arity() string {
+	switch {
+	case f.maxArgs < 0:
+		return fmt.Sprintf("at least %d arguments", f.minArgs)
+	case f.minArgs == f.maxArgs && f.minArgs == 1:
+		return "1 argument"
+	case f.minArgs == f.maxArgs:
+		return fmt.Sprintf("%d arguments", f.minArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", f.minArgs, f.maxArgs)
+	}
+}
+
+// exprDate is the type of date arguments: RFC 3339 or YYYY-MM-DD strings,
+// Unix timestamps in seconds and time.Time facts, which TypeOf reports as
+// objects.
+const exprDate = TypeString | TypeNumber | TypeObject
+
+var exprFuncs map[string]exprFunc
+
+func init() {
+	number := func(f func(float64) float64) exprFunc {
+		return exprFunc{minArgs: 1, maxArgs: 1, args: []ValueType{TypeNumber}, result: TypeNumber,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				n, _ := numberValue(args[0])
+				return f(n), nil
+			}}
+	}
+	text := func(f func(string) string) exprFunc {
+		return exprFunc{minArgs: 1, maxArgs: 1, args: []ValueType{TypeString}, result: TypeString,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				return f(args[0].(string)), nil
+			}}
+	}
+	predicate := func(f func(s, sub string) bool) exprFunc {
+		return exprFunc{minArgs: 2, maxArgs: 2, args: []ValueType{TypeString}, result: TypeBool,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				return f(args[0].(string), args[1].(string)), nil
+			}}
+	}
+	extreme := func(better func(a, b float64) bool) exprFunc {
+		return exprFunc{minArgs: 1, maxArgs: -1, args: []ValueType{TypeNumber}, result: TypeNumber,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				best, _ := numberValue(args[0])
+				for _, arg := range args[1:] {
+					if n, _ := numberValue(arg); better(n, best) {
+						best = n
+					}
+				}
+				return best, nil
+			}}
+	}
+
+	exprFuncs = map[string]exprFunc{
+		"abs":   number(math.Abs),
+		"floor": number(math.Floor),
+		"ceil":  number(math.Ceil),
+		"min":   extreme(func(a, b float64) bool { return a < b }),
+		"max":   extreme(func(a, b float64) bool { return a > b }),
+		"round": {minArgs: 1, maxArgs: 2, args: []ValueType{TypeNumber}, result: TypeNumber,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				n, _ := numberValue(args[0])
+				digits := 0.0
+				if len(args) > 1 {
+					digits, _ = numberValue(args[1])
+				}
+				scale := math.Pow(10, math.Trunc(digits))
+				return math.Round(n*scale) / scale, nil
+			}},
+
+		"len": {minArgs: 1, maxArgs: 1, args: []ValueType{TypeString | TypeArray | TypeObject}, result: TypeNumber,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				if s, ok := args[0].(string); ok {
+					return float64(utf8.RuneCountInString(s)), nil
+				}
+				// TypeOf reports structs, pointers and time.Time as objects
+				// too, but only collections have a length.
+				switch v := reflect.ValueOf(args[0]); v.Kind() {
+				case reflect.Slice, reflect.Array, reflect.Map:
+					return float64(v.Len()), nil
+				default:
+					return nil, fmt.Errorf("cannot take the length of %T", args[0])
+				}
+			}},
+		"lower": text(strings.ToLower),
+		"upper": text(strings.ToUpper),
+		"trim":  text(strings.TrimSpace),
+		"concat": {minArgs: 1, maxArgs: -1, args: []ValueType{TypeAny}, result: TypeString,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				var sb strings.Builder
+				for _, arg := range args {
+					sb.WriteString(formatText(arg))
+				}
+				return sb.String(), nil
+			}},
+		"substr": {minArgs: 2, maxArgs: 3, args: []ValueType{TypeString, TypeNumber, TypeNumber}, result: TypeString,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				runes := []rune(args[0].(string))
+				start, _ := numberValue(args[1])
+				from := clampIndex(int(start), len(runes))
+				to := len(runes)
+				if len(args) > 2 {
+					length, _ := numberValue(args[2])
+					to = clampIndex(from+int(length), len(runes))
+				}
+				if to < from {
+					to = from
+				}
+				return string(runes[from:to]), nil
+			}},
+		"contains":   predicate(strings.Contains),
+		"startsWith": predicate(strings.HasPrefix),
+		"endsWith":   predicate(strings.HasSuffix),
+
+		"now": {minArgs: 0, maxArgs: 0, result: TypeNumber,
+			call: func(env *exprEnv, _ []interface{}) (interface{}, error) {
+				return unixSeconds(env.now), nil
+			}},
+		"date": {minArgs: 1, maxArgs: 1, args: []ValueType{exprDate}, result: TypeNumber,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				return dateValue(args[0])
+			}},
+		"days": number(func(n float64) float64 { return n * 86400 }),
+		"daysSince": {minArgs: 1, maxArgs: 1, args: []ValueType{exprDate}, result: TypeNumber,
+			call: func(env *exprEnv, args []interface{}) (interface{}, error) {
+				d, err := dateValue(args[0])
+				if err != nil {
+					return nil, err
+				}
+				return (unixSeconds(env.now) - d) / 86400, nil
+			}},
+		"daysBetween": {minArgs: 2, maxArgs: 2, args: []ValueType{exprDate}, result: TypeNumber,
+			call: func(_ *exprEnv, args []interface{}) (interface{}, error) {
+				from, err := dateValue(args[0])
+				if err != nil {
+					return nil, err
+				}
+				to, err := dateValue(args[1])
+				if err != nil {
+					return nil, err
+				}
+				return (to - from) / 86400, nil
+			}},
+	}
+}
+
+func clampIndex(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+func formatText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	if n, ok := numberValue(v); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return formatValue(v)
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// dateValue converts a date argument to a Unix timestamp in seconds.
+func dateValue(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return unixSeconds(v), nil
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return unixSeconds(t), nil
+			}
+		}
+		return 0, fmt.Errorf("invalid date %q", v)
+	}
+	if n, ok := numberValue(v); ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("invalid date %v", v)
+}
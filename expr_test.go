@@ -0,0 +1,48 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type code string
+
+func TestLenOfNonCollectionFails(t *testing.T) {
+	eng := NewEngine()
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(`[{"id": "long", "when": "len(x) > 1", "event": {"type": "long"}}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 3
+	for _, x := range []interface{}{time.Now(), &n, struct{ A, B int }{}} {
+		events, err := eng.Evaluate(rules, map[string]interface{}{"x": x})
+		var evalErr *EvaluationError
+		if !errors.As(err, &evalErr) || evalErr.RuleID != "long" {
+			t.Errorf("len(%T): error %v, want an evaluation error", x, err)
+		}
+		if len(events) != 0 {
+			t.Errorf("len(%T): events %v, want none", x, events)
+		}
+	}
+
+	for _, x := range []interface{}{"abc", []interface{}{1, 2}, map[string]interface{}{"a": 1, "b": 2}, [2]int{}, code("ab")} {
+		events, err := eng.Evaluate(rules, map[string]interface{}{"x": x})
+		if err != nil || len(events) != 1 {
+			t.Errorf("len(%v) = %v, %v; want a match", x, events, err)
+		}
+	}
+}
+
+func TestStringFunctionsAcceptNamedStrings(t *testing.T) {
+	eng := NewEngine()
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(`[{"id": "vn", "when": "lower(country) == \"vn\" && startsWith(country, \"V\") == true", "event": {"type": "vn"}}]`); err != nil {
+		t.Fatal(err)
+	}
+	events, err := eng.Evaluate(rules, map[string]interface{}{"country": code("VN")})
+	if err != nil || len(events) != 1 {
+		t.Errorf("Evaluate = %v, %v; want a match", events, err)
+	}
+}
@@ -0,0 +1,307 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FactDefinition declares a fact the application supplies to the engine.
+// A zero Type accepts any value. Enum, if set, lists the only values the
+// fact can take. Fields of object facts are addressed as "customer.name"
+// without being declared themselves.
+type FactDefinition struct {
+	Name     string
+	Type     ValueType
+	Enum     []interface{}
+	Nullable bool
+}
+
+// FactError reports a supplied fact that does not match its declaration.
+type FactError struct {
+	Fact   string
+	Reason string
+}
+
+func (e *FactError) Error() string {
+	return fmt.Sprintf("fact %q: %s", e.Fact, e.Reason)
+}
+
+// DeclareFacts adds fact declarations to e. Once any fact is declared,
+// Validate rejects rules that reference undeclared facts or use operators
+// that cannot apply to a fact's type.
+func (e *Engine) DeclareFacts(defs ...FactDefinition) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, def := range defs {
+		if def.Name == "" {
+			return errors.New("fact definition is missing a name")
+		}
+		if _, exists := e.facts[def.Name]; exists {
+			return fmt.Errorf("fact %s is already declared", def.Name)
+		}
+	}
+
+	for _, def := range defs {
+		if def.Type == 0 {
+			def.Type = TypeAny
+		}
+		e.facts[def.Name] = def
+	}
+	return nil
+}
+
+// FactDefinitions returns the declared facts sorted by name.
+func (e *Engine) FactDefinitions() []FactDefinition {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	defs := make([]FactDefinition, 0, len(e.facts))
+	for _, def := range e.facts {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+	return defs
+}
+
+// ValidateFacts checks the supplied facts against their declarations and
+// returns a *FactError for every mismatch, joined together. Declared facts
+// that are absent and facts that were never declared are not reported.
+func (e *Engine) ValidateFacts(facts map[string]interface{}) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	names := make([]string, 0, len(facts))
+	for name := range facts {
+		if _, declared := e.facts[name]; declared {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := e.checkFact(e.facts[name], facts[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Engine) checkFact(def FactDefinition, value interface{}) error {
+	if value == nil {
+		if !def.Nullable {
+			return &FactError{Fact: def.Name, Reason: "must not be null"}
+		}
+		return nil
+	}
+
+	if typ := TypeOf(value); !def.Type.Accepts(typ) {
+		return &FactError{Fact: def.Name, Reason: fmt.Sprintf("expected %s, got %s", def.Type, typ)}
+	}
+
+	if len(def.Enum) > 0 && !e.inEnum(def, value) {
+		return &FactError{Fact: def.Name, Reason: fmt.Sprintf("%v is not an allowed value", value)}
+	}
+	return nil
+}
+
+func (e *Engine) inEnum(def FactDefinition, value interface{}) bool {
+	for _, allowed := range def.Enum {
+		if e.compareEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupFact returns the fact called name. A name containing dots that is
+// not a fact itself addresses the fields of nested objects, so
+// "customer.name" reads the "name" field of the "customer" fact.
+func lookupFact(facts map[string]interface{}, name string) (interface{}, bool) {
+	if value, ok := facts[name]; ok {
+		return value, true
+	}
+	if !strings.Contains(name, ".") {
+		return nil, false
+	}
+	return lookupNested(func(key string) (interface{}, bool) {
+		value, ok := facts[key]
+		return value, ok
+	}, name)
+}
+
+// lookupNested resolves name as a path below the shortest of its dotted
+// prefixes that get, which reads one key of an object, finds.
+func lookupNested(get func(key string) (interface{}, bool), name string) (interface{}, bool) {
+	for i := 0; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+		if value, ok := get(name[:i]); ok {
+			if field, ok := lookupField(value, name[i+1:]); ok {
+				return field, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// lookupField resolves path within value, which may be any map with string
+// keys. Other maps are read through reflection rather than copied.
+func lookupField(value interface{}, path string) (interface{}, bool) {
+	if obj, ok := value.(map[string]interface{}); ok {
+		return lookupFact(obj, path)
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	keyType := rv.Type().Key()
+	get := func(key string) (interface{}, bool) {
+		field := rv.MapIndex(reflect.ValueOf(key).Convert(keyType))
+		if !field.IsValid() {
+			return nil, false
+		}
+		return field.Interface(), true
+	}
+	if field, ok := get(path); ok {
+		return field, true
+	}
+	return lookupNested(get, path)
+}
+
+// checkExpressionFacts checks the facts referenced by the condition's
+// expressions and reports whether the condition's left side is computed.
+func (e *Engine) checkExpressionFacts(cond Condition, lookup func(Operator) (OperatorSpec, bool), report func(string, ...interface{})) bool {
+	var sources []string
+	if cond.Expr != "" {
+		sources = append(sources, cond.Expr)
+	}
+	if src, ok := valueExpression(cond.Value); ok {
+		sources = append(sources, src)
+	}
+
+	for i, src := range sources {
+		expr, err := compileExpression(src)
+		if err != nil {
+			// Syntax errors are reported by checkOperands.
+			continue
+		}
+		for _, fact := range expr.facts() {
+			if _, _, err := e.declaredFact(fact); err != nil {
+				report("%v", err)
+			}
+		}
+
+		typ, err := expr.root.typ(e.declaredFactType)
+		if err != nil {
+			report("%v", err)
+			continue
+		}
+		if i == 0 && cond.Expr != "" {
+			if spec, ok := lookup(cond.Operator); ok && spec.FactTypes&typ == 0 {
+				report("operator %s cannot be applied to a value of type %s", cond.Operator, typ)
+			}
+		}
+	}
+	return cond.Expr != ""
+}
+
+// declaredFact returns the declaration of the fact called name. A dotted
+// name that is not declared itself resolves to the object fact it is a
+// field of, like lookupFact, and nested is set since the field's type is
+// not declared.
+func (e *Engine) declaredFact(name string) (def FactDefinition, nested bool, err error) {
+	if def, ok := e.facts[name]; ok {
+		return def, false, nil
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+		if def, ok := e.facts[name[:i]]; ok {
+			if def.Type&TypeObject == 0 {
+				return def, true, fmt.Errorf("fact %q of type %s has no field %q", def.Name, def.Type, name[i+1:])
+			}
+			return def, true, nil
+		}
+	}
+	return FactDefinition{}, false, fmt.Errorf("unknown fact %q", name)
+}
+
+func (e *Engine) declaredFactType(name string) ValueType {
+	def, nested, err := e.declaredFact(name)
+	if err != nil || nested {
+		return TypeAny
+	}
+	if def.Nullable {
+		return def.Type | TypeNull
+	}
+	return def.Type
+}
+
+// checkFactUsage reports conditions that reference undeclared facts, apply
+// operators to facts of the wrong type, or compare enum facts with values
+// outside the enum, looking operators up with lookup. It is a no-op until
+// facts are declared. e.mu must be held.
+func (e *Engine) checkFactUsage(rule ruleOption, lookup func(Operator) (OperatorSpec, bool)) []error {
+	if len(e.facts) == 0 {
+		return nil
+	}
+
+	var errs []error
+	walkConditions(rule.Conditions, "conditions", func(path string, cond Condition) {
+		report := func(format string, args ...interface{}) {
+			errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: path, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if e.checkExpressionFacts(cond, lookup, report) {
+			return
+		}
+
+		def, nested, err := e.declaredFact(cond.Fact)
+		if err != nil {
+			report("%v", err)
+			return
+		}
+		if nested {
+			return
+		}
+
+		factType := def.Type
+		if def.Nullable {
+			factType |= TypeNull
+		}
+		if spec, ok := lookup(cond.Operator); ok && spec.FactTypes&factType == 0 {
+			report("operator %s cannot be applied to fact %q of type %s", cond.Operator, cond.Fact, def.Type)
+			return
+		}
+
+		if _, computed := valueExpression(cond.Value); computed || len(def.Enum) == 0 {
+			return
+		}
+		var values []interface{}
+		switch cond.Operator {
+		case Equal, NotEqual:
+			values = []interface{}{cond.Value}
+		case In, NotIn:
+			values, _ = cond.Value.([]interface{})
+		}
+		for _, value := range values {
+			if value == nil && def.Nullable {
+				continue
+			}
+			if !e.inEnum(def, value) {
+				report("%v is not an allowed value of fact %q", value, cond.Fact)
+			}
+		}
+	}, nil)
+	return errs
+}
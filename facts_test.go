@@ -0,0 +1,135 @@
+package go_json_rules_engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const undeclaredFactRules = `[{"id": "r", "conditions": {"operator": "and", "conditions": [
+	{"fact": "age", "operator": "greaterThan", "value": 18},
+	{"fact": "country", "operator": "equal", "value": "VN"}
+]}, "event": {"type": "x"}}]`
+
+func declaredEngine(t *testing.T) *Engine {
+	t.Helper()
+	eng := NewEngine()
+	if err := eng.DeclareFacts(FactDefinition{Name: "age", Type: TypeNumber}); err != nil {
+		t.Fatal(err)
+	}
+	return eng
+}
+
+func TestRegisterRuleSetChecksFacts(t *testing.T) {
+	eng := declaredEngine(t)
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(undeclaredFactRules); err != nil {
+		t.Fatal(err)
+	}
+
+	err := eng.RegisterRuleSet("checkout", "v1", rules)
+	if err == nil || !strings.Contains(err.Error(), `unknown fact "country"`) {
+		t.Fatalf("RegisterRuleSet error = %v, want unknown fact", err)
+	}
+	if len(eng.RuleSets()) != 0 {
+		t.Error("rule set was registered despite the error")
+	}
+}
+
+func TestRuleSetOperatorsAreTypeChecked(t *testing.T) {
+	eng := NewEngine()
+	if err := eng.DeclareFacts(FactDefinition{Name: "name", Type: TypeString}); err != nil {
+		t.Fatal(err)
+	}
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(`[{"id": "r", "conditions": {"operator": "and", "conditions": [
+		{"fact": "name", "operator": "even", "value": true}
+	]}, "event": {"type": "x"}}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	even := WithSetOperator("even", func(a, b interface{}) bool { return true }, WithOperandTypes(TypeNumber, TypeBool))
+	err := eng.RegisterRuleSet("numbers", "v1", rules, even)
+	if err == nil || !strings.Contains(err.Error(), "cannot be applied") {
+		t.Fatalf("RegisterRuleSet error = %v, want a type error", err)
+	}
+}
+
+func TestLoadRulesChecksFacts(t *testing.T) {
+	eng := declaredEngine(t)
+	filename := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(filename, []byte(undeclaredFactRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := eng.LoadRules(filename); err == nil || !strings.Contains(err.Error(), `unknown fact "country"`) {
+		t.Fatalf("LoadRules error = %v, want unknown fact", err)
+	}
+	if err := eng.DeclareFacts(FactDefinition{Name: "country", Type: TypeString}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eng.LoadRules(filename); err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+}
+
+func TestZeroFactTypeAcceptsAnyValue(t *testing.T) {
+	eng := NewEngine()
+	if err := eng.DeclareFacts(FactDefinition{Name: "payload"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []interface{}{1, "a", true, []interface{}{1}, map[string]interface{}{"a": 1}} {
+		if err := eng.ValidateFacts(map[string]interface{}{"payload": value}); err != nil {
+			t.Errorf("%v: %v", value, err)
+		}
+	}
+	if defs := eng.FactDefinitions(); defs[0].Type != TypeAny {
+		t.Errorf("declared type %s, want any", defs[0].Type)
+	}
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(`[{"id": "r", "conditions": {"operator": "and", "conditions": [
+		{"fact": "payload", "operator": "greaterThan", "value": 1}
+	]}, "event": {"type": "x"}}]`); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Validate(rules); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestNestedFactsResolveToTheirRoot(t *testing.T) {
+	eng := NewEngine()
+	if err := eng.DeclareFacts(
+		FactDefinition{Name: "customer", Type: TypeObject},
+		FactDefinition{Name: "age", Type: TypeNumber},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		condition string
+		want      string // empty if the condition is valid
+	}{
+		{`{"fact": "customer.name", "operator": "equal", "value": "Ann"}`, ""},
+		{`{"fact": "customer.address.city", "operator": "in", "value": ["HN"]}`, ""},
+		{`{"expr": "len(customer.tags)", "operator": "greaterThan", "value": 1}`, ""},
+		{`{"fact": "age.years", "operator": "equal", "value": 1}`, `fact "age" of type number has no field "years"`},
+		{`{"fact": "account.id", "operator": "equal", "value": 1}`, `unknown fact "account.id"`},
+		{`{"expr": "upper(account.name)", "operator": "equal", "value": "A"}`, `unknown fact "account.name"`},
+	}
+	for _, tt := range tests {
+		rules := NewRules()
+		if err := rules.LoadRulesFromJSONString(conditionRules(tt.condition)); err != nil {
+			t.Fatal(err)
+		}
+		err := eng.Validate(rules)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: %v", tt.condition, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: error %v, want %q", tt.condition, err, tt.want)
+		}
+	}
+}
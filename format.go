@@ -0,0 +1,334 @@
+package go_json_rules_engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Rules can be written in YAML or TOML as well as JSON. Both are mapped onto
+// the same JSON model, so every field and nesting rule of the JSON format
+// applies unchanged; JSON stays the canonical serialization.
+//
+// A YAML document is a sequence of rules, or a mapping with "rules",
+// "fragments", "templates" and "instances" like a JSON document object. A
+// TOML document declares each rule as a [[rules]] table, fragments and
+// templates as [fragments.<name>] and [templates.<name>] tables and
+// instances as [[instances]]:
+//
+//	[[rules]]
+//	id = "adult"
+//	priority = 10
+//
+//	[rules.conditions]
+//	operator = "and"
+//
+//	[[rules.conditions.conditions]]
+//	fact = "age"
+//	operator = "greaterThanInclusive"
+//	value = 18
+//
+//	[rules.event]
+//	type = "adult"
+
+func (r *Rule) LoadRulesFromYAML(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	return r.replaceRules(decodeYAMLRules(data, filename))
+}
+
+func (r *Rule) LoadRulesFromYAMLString(yamlStr string) error {
+	return r.replaceRules(decodeYAMLRules([]byte(yamlStr), ""))
+}
+
+func (r *Rule) LoadRulesFromTOML(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	return r.replaceRules(decodeTOMLRules(data, filename))
+}
+
+func (r *Rule) LoadRulesFromTOMLString(tomlStr string) error {
+	return r.replaceRules(decodeTOMLRules([]byte(tomlStr), ""))
+}
+
+// LoadRulesFromFile loads a rules file, choosing the format from its
+// extension: .yaml and .yml are YAML, .toml is TOML and anything else is
+// JSON.
+func (r *Rule) LoadRulesFromFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	return r.replaceRules(decodeRulesFile(data, filename))
+}
+
+// decodeRulesFile decodes data in the format implied by the file name.
+func decodeRulesFile(data []byte, file string) ([]ruleOption, error) {
+	return resolveDocument(decodeDocumentFile(data, file))
+}
+
+// decodeDocumentFile decodes data in the format implied by the file name
+// without resolving its references.
+func decodeDocumentFile(data []byte, file string) (*ruleDocument, error) {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".yaml", ".yml":
+		return decodeYAMLDocument(data, file)
+	case ".toml":
+		return decodeTOMLDocument(data, file)
+	default:
+		return decodeRuleDocument(data, file)
+	}
+}
+
+func decodeYAMLRules(data []byte, file string) ([]ruleOption, error) {
+	return resolveDocument(decodeYAMLDocument(data, file))
+}
+
+func decodeTOMLRules(data []byte, file string) ([]ruleOption, error) {
+	return resolveDocument(decodeTOMLDocument(data, file))
+}
+
+var yamlLineError = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func decodeYAMLDocument(data []byte, file string) (*ruleDocument, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		if m := yamlLineError.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return nil, fmt.Errorf("failed to parse rules: %s: %s", Source{File: file, Line: line}, m[2])
+		}
+		return nil, fmt.Errorf("failed to parse rules: %s: %w", Source{File: file}, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("failed to parse rules: %s: empty document", Source{File: file})
+	}
+
+	root := doc.Content[0]
+	var rdoc ruleDocument
+	if root.Kind == yaml.MappingNode {
+		var seq *yaml.Node
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			key, value := root.Content[i], root.Content[i+1]
+			source := Source{File: file, Line: value.Line}
+			switch key.Value {
+			case "rules":
+				seq = value
+			case "fragments", "templates":
+				var raw map[string]interface{}
+				if err := value.Decode(&raw); err != nil {
+					return nil, fmt.Errorf("failed to parse rules: %s: %s: %w", source, key.Value, err)
+				}
+				objects, err := genericObjects(raw)
+				if err == nil && key.Value == "fragments" {
+					rdoc.fragments = objects
+				} else if err == nil {
+					rdoc.templates, err = parseTemplates(objects, file)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse rules: %s: %w", source, err)
+				}
+			case "instances":
+				if value.Kind != yaml.SequenceNode {
+					return nil, fmt.Errorf("failed to parse rules: %s: \"instances\" must be a sequence", source)
+				}
+				for _, item := range value.Content {
+					var raw interface{}
+					if err := item.Decode(&raw); err != nil {
+						return nil, fmt.Errorf("failed to parse rules: %s: %w", Source{File: file, Line: item.Line}, err)
+					}
+					inst, err := instanceFromGeneric(raw, Source{File: file, Line: item.Line})
+					if err != nil {
+						return nil, err
+					}
+					rdoc.instances = append(rdoc.instances, inst)
+				}
+			default:
+				return nil, fmt.Errorf("failed to parse rules: %s: unknown key %q", Source{File: file, Line: key.Line}, key.Value)
+			}
+		}
+		if seq == nil {
+			return &rdoc, nil
+		}
+		root = seq
+	}
+	if root.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("failed to parse rules: %s: expected a sequence of rules", Source{File: file, Line: root.Line})
+	}
+
+	rdoc.rules = make([]ruleOption, 0, len(root.Content))
+	for _, item := range root.Content {
+		source := Source{File: file, Line: item.Line}
+
+		var raw interface{}
+		if err := item.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("failed to parse rules: %s: %w", source, err)
+		}
+
+		rule, err := ruleFromGeneric(raw, source)
+		if err != nil {
+			return nil, err
+		}
+		rdoc.rules = append(rdoc.rules, rule)
+	}
+
+	return &rdoc, nil
+}
+
+var tomlRuleHeader = regexp.MustCompile(`^\s*\[\[\s*rules\s*\]\]`)
+
+func decodeTOMLDocument(data []byte, file string) (*ruleDocument, error) {
+	var doc struct {
+		Rules     []map[string]interface{} `toml:"rules"`
+		Fragments map[string]interface{}   `toml:"fragments"`
+		Templates map[string]interface{}   `toml:"templates"`
+		Instances []map[string]interface{} `toml:"instances"`
+	}
+	meta, err := toml.Decode(string(data), &doc)
+	if err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			source := Source{File: file, Line: parseErr.Position.Line}
+			return nil, fmt.Errorf("failed to parse rules: %s: %s", source, parseErr.Message)
+		}
+		return nil, fmt.Errorf("failed to parse rules: %s: %w", Source{File: file}, err)
+	}
+	if len(meta.Keys()) == 0 {
+		return nil, fmt.Errorf("failed to parse rules: %s: empty document", Source{File: file})
+	}
+
+	// TOML decoding does not expose positions, so rules are matched to the
+	// [[rules]] headers in the order they appear.
+	var lines []int
+	for i, line := range bytes.Split(data, []byte{'\n'}) {
+		if tomlRuleHeader.Match(line) {
+			lines = append(lines, i+1)
+		}
+	}
+
+	var rdoc ruleDocument
+	rdoc.rules = make([]ruleOption, 0, len(doc.Rules))
+	for i, raw := range doc.Rules {
+		source := Source{File: file}
+		if i < len(lines) {
+			source.Line = lines[i]
+		}
+
+		rule, err := ruleFromGeneric(raw, source)
+		if err != nil {
+			return nil, err
+		}
+		rdoc.rules = append(rdoc.rules, rule)
+	}
+
+	if rdoc.fragments, err = genericObjects(doc.Fragments); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %s: %w", Source{File: file}, err)
+	}
+	templates, err := genericObjects(doc.Templates)
+	if err == nil {
+		rdoc.templates, err = parseTemplates(templates, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %s: %w", Source{File: file}, err)
+	}
+	for _, raw := range doc.Instances {
+		inst, err := instanceFromGeneric(raw, Source{File: file})
+		if err != nil {
+			return nil, err
+		}
+		rdoc.instances = append(rdoc.instances, inst)
+	}
+	return &rdoc, nil
+}
+
+// genericObjects converts decoded YAML or TOML fragments or templates into
+// JSON.
+func genericObjects(raw map[string]interface{}) (map[string]json.RawMessage, error) {
+	objects := make(map[string]json.RawMessage, len(raw))
+	for name, object := range raw {
+		data, err := json.Marshal(normalizeGeneric(object))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", name, err)
+		}
+		objects[name] = data
+	}
+	return objects, nil
+}
+
+// instanceFromGeneric converts a decoded YAML or TOML template instance into
+// the JSON model.
+func instanceFromGeneric(raw interface{}, source Source) (TemplateInstance, error) {
+	var inst TemplateInstance
+	data, err := json.Marshal(normalizeGeneric(raw))
+	if err == nil {
+		err = json.Unmarshal(data, &inst)
+	}
+	if err != nil {
+		return TemplateInstance{}, fmt.Errorf("failed to parse rules: %s: %w", source, err)
+	}
+	inst.source = source
+	return inst, nil
+}
+
+// ruleFromGeneric converts a decoded YAML or TOML rule into the JSON model.
+func ruleFromGeneric(raw interface{}, source Source) (ruleOption, error) {
+	data, err := json.Marshal(normalizeGeneric(raw))
+	if err != nil {
+		return ruleOption{}, fmt.Errorf("failed to parse rules: %s: %w", source, err)
+	}
+
+	var rule ruleOption
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return ruleOption{}, fmt.Errorf("failed to parse rules: %s: %w", source, err)
+	}
+	rule.Source = source
+	return rule, nil
+}
+
+// normalizeGeneric converts maps with non-string keys, as produced by YAML,
+// into values encoding/json can marshal.
+func normalizeGeneric(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = normalizeGeneric(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[fmt.Sprint(k)] = normalizeGeneric(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalizeGeneric(item)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalizeGeneric(item)
+		}
+		return out
+	default:
+		return val
+	}
+}
@@ -0,0 +1,135 @@
+package go_json_rules_engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const yamlRules = `# rules
+- id: adult
+  priority: 10
+  conditions:
+    operator: and
+    conditions:
+      - {fact: age, operator: greaterThanInclusive, value: 18}
+  event: {type: adult}
+
+- id: vip
+  when: tier == "gold"
+  event:
+    type: vip
+    params: {discount: 5}
+`
+
+const tomlRules = `# rules
+[[rules]]
+id = "adult"
+priority = 10
+
+[rules.conditions]
+operator = "and"
+
+[[rules.conditions.conditions]]
+fact = "age"
+operator = "greaterThanInclusive"
+value = 18
+
+[rules.event]
+type = "adult"
+
+[[rules]]
+id = "vip"
+when = 'tier == "gold"'
+
+[rules.event]
+type = "vip"
+params = { discount = 5 }
+`
+
+const jsonRules = `[
+	{"id": "adult", "priority": 10, "conditions": {"operator": "and", "conditions": [
+		{"fact": "age", "operator": "greaterThanInclusive", "value": 18}
+	]}, "event": {"type": "adult"}},
+	{"id": "vip", "when": "tier == \"gold\"", "event": {"type": "vip", "params": {"discount": 5}}}
+]`
+
+func TestYAMLAndTOMLMatchJSON(t *testing.T) {
+	want := NewRules()
+	if err := want.LoadRulesFromJSONString(jsonRules); err != nil {
+		t.Fatal(err)
+	}
+	fromYAML := NewRules()
+	if err := fromYAML.LoadRulesFromYAMLString(yamlRules); err != nil {
+		t.Fatal(err)
+	}
+	fromTOML := NewRules()
+	if err := fromTOML.LoadRulesFromTOMLString(tomlRules); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, got := range map[string]*Rule{"yaml": fromYAML, "toml": fromTOML} {
+		diff, err := DiffRules(want, got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !diff.Empty() {
+			t.Errorf("%s rules differ from JSON:\n%s", name, diff)
+		}
+	}
+
+	lines := map[string][]int{"yaml": {2, 10}, "toml": {2, 17}}
+	for name, rules := range map[string]*Rule{"yaml": fromYAML, "toml": fromTOML} {
+		for i, rule := range rules.GetRules() {
+			if rule.Source.Line != lines[name][i] {
+				t.Errorf("%s rule %s on line %d, want %d", name, rule.ID, rule.Source.Line, lines[name][i])
+			}
+		}
+	}
+}
+
+func TestFormatErrorPositions(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		file, content, want string
+	}{
+		{"bad.yaml", "- id: a\n  a: b: c\n", "bad.yaml:2: mapping values are not allowed"},
+		{"tabs.yml", "- id: a\n\tevent: x\n", "tabs.yml:2"},
+		{"key.yaml", "rules: []\nextra: 1\n", `key.yaml:2: unknown key "extra"`},
+		{"scalar.yaml", "rules\n", "expected a sequence of rules"},
+		{"empty.yaml", "", "empty.yaml: empty document"},
+		{"comments.yaml", "# nothing here\n# yet\n", "comments.yaml: empty document"},
+		{"bad.toml", "[[rules]]\nid = \"a\"\npriority = \n", "bad.toml:3"},
+		{"empty.toml", "# nothing here\n", "empty.toml: empty document"},
+		{"rule.toml", "[[rules]]\nid = \"a\"\n\n[[rules]]\nid = \"b\"\nenabled = \"yes\"\n", "rule.toml:4"},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(dir, tt.file)
+		if err := os.WriteFile(filename, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		rules := NewRules()
+		err := rules.LoadRulesFromFile(filename)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want it to contain %q", tt.file, err, tt.want)
+		}
+	}
+}
+
+func TestEmptyYAMLKeepsRules(t *testing.T) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromYAMLString(yamlRules); err != nil {
+		t.Fatal(err)
+	}
+	if err := rules.LoadRulesFromYAMLString("# all rules commented out\n"); err == nil {
+		t.Fatal("comment-only document was accepted")
+	}
+	if len(rules.GetRules()) != 2 {
+		t.Errorf("rules were replaced by a failed load: %d left", len(rules.GetRules()))
+	}
+
+	if err := rules.LoadRulesFromYAMLString("[]"); err != nil || len(rules.GetRules()) != 0 {
+		t.Errorf("explicit empty sequence: %v, %d rules", err, len(rules.GetRules()))
+	}
+}
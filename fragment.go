@@ -0,0 +1,337 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A rule document may be an object instead of an array, declaring named
+// condition fragments next to its rules, as well as rule templates and their
+// instances (see RuleTemplate):
+//
+//	{
+//	  "fragments": {
+//	    "activeCustomer": {"operator": "and", "conditions": [
+//	      {"fact": "accountStatus", "operator": "equal", "value": "active"},
+//	      {"$use": "supportedCountry"}
+//	    ]},
+//	    "supportedCountry": {"fact": "country", "operator": "in", "value": ["VN", "TH"]}
+//	  },
+//	  "rules": [
+//	    {"id": "vip", "conditions": {"operator": "and", "conditions": [
+//	      {"$use": "activeCustomer"},
+//	      {"fact": "spend", "operator": "greaterThan", "value": 1000}
+//	    ]}, "event": {"type": "vip", "params": {"discount": 10}}},
+//	    {"id": "vip-vn", "extends": "vip", "conditions": {"operator": "and", "conditions": [
+//	      {"fact": "country", "operator": "equal", "value": "VN"}
+//	    ]}, "event": {"params": {"discount": 15}}}
+//	  ]
+//	}
+//
+// {"$use": name} stands for the fragment anywhere a condition or group may
+// appear, including as a rule's whole "conditions". A rule that extends
+// another requires the parent's conditions as well as its own, and inherits
+// the parent's event type and params unless it overrides them. Nothing else
+// is inherited: the priority, tags, schedule, rollout and other fields are
+// the child's own. Both are resolved when the document is loaded, across all
+// the files of LoadRulesFromFS; rules are exported in their resolved form.
+
+// ruleDocument holds a decoded rule document until its references are
+// resolved.
+type ruleDocument struct {
+	rules     []ruleOption
+	fragments map[string]json.RawMessage
+	templates map[string]*RuleTemplate
+	instances []TemplateInstance
+
+	// fragmentFiles records the file of each fragment of merged documents.
+	fragmentFiles map[string]string
+}
+
+func resolveDocument(doc *ruleDocument, err error) ([]ruleOption, error) {
+	if err != nil {
+		return nil, err
+	}
+	return doc.resolve()
+}
+
+// merge adds the rules, fragments, templates and instances of other, read
+// from file, to d. Fragments and templates must not be defined twice.
+func (d *ruleDocument) merge(other *ruleDocument, file string) error {
+	if d.fragments == nil {
+		d.fragments = make(map[string]json.RawMessage)
+		d.fragmentFiles = make(map[string]string)
+		d.templates = make(map[string]*RuleTemplate)
+	}
+
+	var errs []error
+	for name, raw := range other.fragments {
+		if first, ok := d.fragmentFiles[name]; ok {
+			errs = append(errs, fmt.Errorf("fragment %q is defined in %s and %s", name, first, file))
+			continue
+		}
+		d.fragments[name] = raw
+		d.fragmentFiles[name] = file
+	}
+	for name, t := range other.templates {
+		if first, ok := d.templates[name]; ok {
+			errs = append(errs, fmt.Errorf("template %q is defined in %s and %s", name, first.source, file))
+			continue
+		}
+		d.templates[name] = t
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return fmt.Errorf("failed to load rules: %w", errors.Join(errs...))
+	}
+
+	d.rules = append(d.rules, other.rules...)
+	d.instances = append(d.instances, other.instances...)
+	return nil
+}
+
+// resolve expands the template instances of the document, then resolves
+// fragments and extends clauses across all of its rules.
+func (d *ruleDocument) resolve() ([]ruleOption, error) {
+	rules := d.rules
+	var errs []error
+	seen := make(map[string]Source, len(d.rules)+len(d.instances))
+	for _, rule := range d.rules {
+		seen[rule.ID] = rule.Source
+	}
+	for _, inst := range d.instances {
+		t, ok := d.templates[inst.Template]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: undefined template %q", inst.source, inst.Template))
+			continue
+		}
+		rule, err := t.instantiate(inst)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule template %s: %w", t.Name, err))
+			continue
+		}
+		if first, ok := seen[rule.ID]; ok {
+			errs = append(errs, &DuplicateRuleError{ID: rule.ID, First: first, Second: rule.Source})
+			continue
+		}
+		seen[rule.ID] = rule.Source
+		rules = append(rules, rule)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to load rules: %w", errors.Join(errs...))
+	}
+
+	return resolveReferences(rules, d.fragments)
+}
+
+// fragmentRef is a {"$use": name} reference awaiting resolution.
+type fragmentRef struct {
+	name string
+}
+
+// fragmentResolver resolves references to the fragments of one document.
+type fragmentResolver struct {
+	raw      map[string]json.RawMessage
+	resolved map[string]interface{}
+	failed   map[string]error
+	stack    []string
+}
+
+// resolveReferences replaces the fragment references in rules and applies
+// their extends clauses, reporting undefined names and cycles.
+func resolveReferences(rules []ruleOption, fragments map[string]json.RawMessage) ([]ruleOption, error) {
+	f := &fragmentResolver{
+		raw:      fragments,
+		resolved: make(map[string]interface{}),
+		failed:   make(map[string]error),
+	}
+
+	var errs []error
+	for i := range rules {
+		rule := &rules[i]
+		report := func(path string, err error) {
+			errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: path, Message: err.Error()})
+		}
+		resolved, _ := f.resolveNode(rule.Conditions, "conditions", report)
+		rule.Conditions = resolved.(ConditionGroup)
+	}
+	if len(errs) == 0 {
+		errs = append(errs, extendRules(rules)...)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to load rules: %w", errors.Join(errs...))
+	}
+	return rules, nil
+}
+
+func (f *fragmentResolver) fragment(name string) (interface{}, error) {
+	if node, ok := f.resolved[name]; ok {
+		return node, nil
+	}
+	if err, ok := f.failed[name]; ok {
+		return nil, err
+	}
+	for i, active := range f.stack {
+		if active == name {
+			return nil, fmt.Errorf("fragment cycle %s", strings.Join(append(f.stack[i:len(f.stack):len(f.stack)], name), " -> "))
+		}
+	}
+	raw, ok := f.raw[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined fragment %q", name)
+	}
+
+	node, err := parseFragment(raw)
+	if err == nil {
+		f.stack = append(f.stack, name)
+		var errs []error
+		node, _ = f.resolveNode(node, "", func(path string, err error) {
+			if path != "" {
+				err = fmt.Errorf("%s: %w", path, err)
+			}
+			errs = append(errs, err)
+		})
+		f.stack = f.stack[:len(f.stack)-1]
+		err = errors.Join(errs...)
+	}
+	if err != nil {
+		err = fmt.Errorf("fragment %q: %w", name, err)
+		f.failed[name] = err
+		return nil, err
+	}
+
+	f.resolved[name] = node
+	return node, nil
+}
+
+// parseFragment decodes a fragment like an entry of a group's conditions.
+func parseFragment(raw json.RawMessage) (interface{}, error) {
+	var group ConditionGroup
+	data := []byte(`{"operator":"and","conditions":[` + string(raw) + `]}`)
+	if err := json.Unmarshal(data, &group); err != nil {
+		return nil, err
+	}
+	return group.Conditions[0], nil
+}
+
+// resolveNode returns node with its fragment references replaced. It
+// reports every reference that cannot be resolved, and the second result is
+// false if node itself is one.
+func (f *fragmentResolver) resolveNode(node interface{}, path string, report func(path string, err error)) (interface{}, bool) {
+	switch n := node.(type) {
+	case fragmentRef:
+		resolved, err := f.fragment(n.name)
+		if err != nil {
+			report(path, err)
+			return nil, false
+		}
+		return resolved, true
+
+	case ConditionGroup:
+		conditions := make([]interface{}, 0, len(n.Conditions))
+		for i, condition := range n.Conditions {
+			childPath := fmt.Sprintf("conditions[%d]", i)
+			if path != "" {
+				childPath = path + "." + childPath
+			}
+			if resolved, ok := f.resolveNode(condition, childPath, report); ok {
+				conditions = append(conditions, resolved)
+			}
+		}
+		if n.Conditions != nil {
+			n.Conditions = conditions
+		}
+		return n, true
+
+	default:
+		return node, true
+	}
+}
+
+// extendRules applies the extends clauses of rules, parents first.
+func extendRules(rules []ruleOption) []error {
+	byID := make(map[string]int, len(rules))
+	for i, rule := range rules {
+		byID[rule.ID] = i
+	}
+
+	var errs []error
+	done := make([]bool, len(rules))
+	var extend func(i int, chain []string) error
+	extend = func(i int, chain []string) error {
+		rule := &rules[i]
+		if done[i] || rule.extends == "" {
+			done[i] = true
+			return nil
+		}
+		for j, id := range chain {
+			if id == rule.ID {
+				return fmt.Errorf("extends cycle %s", strings.Join(append(chain[j:len(chain):len(chain)], rule.ID), " -> "))
+			}
+		}
+		p, ok := byID[rule.extends]
+		if !ok {
+			return fmt.Errorf("undefined rule %q", rule.extends)
+		}
+		if err := extend(p, append(chain, rule.ID)); err != nil {
+			return err
+		}
+
+		*rule = inherit(rules[p], *rule)
+		done[i] = true
+		return nil
+	}
+
+	for i := range rules {
+		if err := extend(i, nil); err != nil {
+			errs = append(errs, &ValidationError{RuleID: rules[i].ID, Source: rules[i].Source, Path: "extends", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// inherit returns child with the conditions and event of parent merged in.
+func inherit(parent, child ruleOption) ruleOption {
+	child.extends = ""
+	child.Conditions = joinConditions(parent.Conditions, child.Conditions)
+
+	if child.Event.Type == "" {
+		child.Event.Type = parent.Event.Type
+	}
+	if len(parent.Event.Params) > 0 {
+		params := make(map[string]interface{}, len(parent.Event.Params)+len(child.Event.Params))
+		for key, value := range parent.Event.Params {
+			params[key] = value
+		}
+		for key, value := range child.Event.Params {
+			params[key] = value
+		}
+		child.Event.Params = params
+	}
+	return child
+}
+
+// joinConditions returns a group requiring both a and b, flattening them
+// into one "and" group when possible.
+func joinConditions(a, b ConditionGroup) ConditionGroup {
+	switch {
+	case len(a.Conditions) == 0:
+		return b
+	case len(b.Conditions) == 0:
+		return a
+	}
+
+	var conditions []interface{}
+	for _, group := range []ConditionGroup{a, b} {
+		if group.Operator == And || len(group.Conditions) == 1 {
+			conditions = append(conditions, group.Conditions...)
+		} else {
+			conditions = append(conditions, group)
+		}
+	}
+	return ConditionGroup{Operator: And, Conditions: conditions}
+}
@@ -0,0 +1,183 @@
+package go_json_rules_engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const fragmentDocument = `{
+	"fragments": {
+		"activeCustomer": {"operator": "and", "conditions": [
+			{"fact": "accountStatus", "operator": "equal", "value": "active"},
+			{"$use": "supportedCountry"}
+		]},
+		"supportedCountry": {"fact": "country", "operator": "in", "value": ["VN", "TH"]}
+	},
+	"rules": [
+		{"id": "vip", "priority": 5, "tags": ["vip"], "enabled": false,
+			"schedule": {"cron": "* 9-17 * * *"},
+			"rollout": {"fact": "userId", "percentage": 10},
+			"conditions": {"operator": "and", "conditions": [
+				{"$use": "activeCustomer"},
+				{"fact": "spend", "operator": "greaterThan", "value": 1000}
+			]},
+			"event": {"type": "vip", "params": {"discount": 10, "label": "VIP"}}},
+		{"id": "vip-vn", "extends": "vip",
+			"conditions": {"operator": "and", "conditions": [
+				{"fact": "country", "operator": "equal", "value": "VN"}
+			]},
+			"event": {"params": {"discount": 15}}},
+		{"id": "whole", "conditions": {"$use": "supportedCountry"}, "event": {"type": "supported"}}
+	]
+}`
+
+func ruleByID(t *testing.T, rules *Rule, id string) ruleOption {
+	t.Helper()
+	for _, rule := range rules.GetRules() {
+		if rule.ID == id {
+			return rule
+		}
+	}
+	t.Fatalf("rule %s not loaded", id)
+	return ruleOption{}
+}
+
+func TestFragmentsAndExtends(t *testing.T) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(fragmentDocument); err != nil {
+		t.Fatal(err)
+	}
+
+	facts := map[string]interface{}{"accountStatus": "active", "country": "VN", "spend": 2000}
+	events, err := NewEngine().Evaluate(rules, facts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// vip itself is disabled; its child is not.
+	want := []Event{
+		{Type: "vip", Params: map[string]interface{}{"discount": 15.0, "label": "VIP"}},
+		{Type: "supported"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	facts["country"] = "TH"
+	events, err = NewEngine().Evaluate(rules, facts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventTypes(events); !reflect.DeepEqual(got, []string{"supported"}) {
+		t.Errorf("events for TH = %v, want [supported]", got)
+	}
+
+	if got := FormatConditions(ruleByID(t, rules, "vip-vn").Conditions); got != `(accountStatus == "active" && country in ["VN","TH"]) && spend > 1000 && country == "VN"` {
+		t.Errorf("vip-vn conditions = %s", got)
+	}
+}
+
+func TestExtendsInheritsOnlyConditionsAndEvent(t *testing.T) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(fragmentDocument); err != nil {
+		t.Fatal(err)
+	}
+
+	child := ruleByID(t, rules, "vip-vn")
+	if child.Priority != 0 || child.Tags != nil || child.Schedule != nil || child.Rollout != nil || !child.IsEnabled() {
+		t.Errorf("vip-vn inherited fields other than conditions and event: %+v", child)
+	}
+	if child.Event.Type != "vip" {
+		t.Errorf("vip-vn event type = %q, want vip", child.Event.Type)
+	}
+
+	// The parent's params are not shared with the child.
+	parent := ruleByID(t, rules, "vip")
+	if parent.Event.Params["discount"] != 10.0 {
+		t.Errorf("vip params were modified: %v", parent.Event.Params)
+	}
+}
+
+func TestFragmentErrors(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want []string
+	}{
+		{`{"rules": [{"id": "r", "conditions": {"$use": "missing"}, "event": {"type": "x"}}]}`,
+			[]string{`rule "r": conditions.conditions[0]: undefined fragment "missing"`}},
+		{`{"fragments": {"a": {"$use": "b"}, "b": {"operator": "or", "conditions": [{"$use": "a"}]}},
+			"rules": [{"id": "r", "conditions": {"operator": "and", "conditions": [{"$use": "a"}]}, "event": {"type": "x"}}]}`,
+			[]string{`rule "r": conditions.conditions[0]: fragment "a": fragment "b": conditions[0]: fragment cycle a -> b -> a`}},
+		{`{"fragments": {"bad": {"fact": 1}}, "rules": [{"id": "r", "conditions": {"$use": "bad"}, "event": {"type": "x"}}]}`,
+			[]string{`rule "r": conditions.conditions[0]: fragment "bad": `}},
+		{`[{"id": "r", "extends": "missing", "conditions": {"all": []}, "event": {"type": "x"}}]`,
+			[]string{`rule "r": extends: undefined rule "missing"`}},
+		{`[{"id": "a", "extends": "b", "conditions": {"all": []}, "event": {"type": "x"}},
+			{"id": "b", "extends": "a", "conditions": {"all": []}, "event": {"type": "x"}}]`,
+			[]string{`rule "a": extends: extends cycle a -> b -> a`, `rule "b": extends: extends cycle b -> a -> b`}},
+	}
+	for _, tt := range tests {
+		err := NewRules().LoadRulesFromJSONString(tt.doc)
+		if err == nil {
+			t.Errorf("%s: loaded", tt.doc)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %v, want %q", tt.doc, err, want)
+			}
+		}
+	}
+}
+
+func TestFragmentsAcrossFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a_rules.yaml": {Data: []byte(`rules:
+  - id: vip-vn
+    extends: vip
+    conditions:
+      $use: vietnam
+    event:
+      params:
+        discount: 15
+`)},
+		"b_base.json": {Data: []byte(`{
+	"fragments": {"active": {"fact": "accountStatus", "operator": "equal", "value": "active"}},
+	"rules": [{"id": "vip", "enabled": false, "conditions": {"$use": "active"}, "event": {"type": "vip", "params": {"discount": 10}}}]
+}`)},
+		"c_more.toml": {Data: []byte(`[fragments.vietnam]
+fact = "country"
+operator = "equal"
+value = "VN"
+`)},
+	}
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromFS(fsys, "*"); err != nil {
+		t.Fatal(err)
+	}
+	events, err := NewEngine().Evaluate(rules, map[string]interface{}{"accountStatus": "active", "country": "VN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != "vip" || fmt.Sprint(events[0].Params["discount"]) != "15" {
+		t.Errorf("events = %v, want one vip event with discount 15", events)
+	}
+	if got := ruleByID(t, rules, "vip-vn").Source.File; got != "a_rules.yaml" {
+		t.Errorf("vip-vn source = %q", got)
+	}
+
+	// A single file still only sees its own fragments.
+	err = NewRules().LoadRulesFromFS(fsys, "a_rules.yaml")
+	if err == nil || !strings.Contains(err.Error(), `undefined fragment "vietnam"`) {
+		t.Errorf("single file: error %v", err)
+	}
+
+	fsys["d_dup.json"] = &fstest.MapFile{Data: []byte(`{"fragments": {"active": {"fact": "x", "operator": "equal", "value": 1}}, "rules": []}`)}
+	err = NewRules().LoadRulesFromFS(fsys, "*")
+	if err == nil || !strings.Contains(err.Error(), `fragment "active" is defined in b_base.json and d_dup.json`) {
+		t.Errorf("duplicate fragment: error %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package go_json_rules_engine
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// ruleIndex narrows the rules that have to be evaluated for a set of facts.
+// Every rule whose top-level "and" group contains an equal or in condition on
+// a scalar value is filed under that fact and value; a rule can only match if
+// the supplied fact equals one of the values it was filed under. Rules
+// without such a condition are always candidates.
+type ruleIndex struct {
+	facts     []string
+	buckets   map[string]map[string][]int
+	unindexed []int
+}
+
+func newRuleIndex() *ruleIndex {
+	return &ruleIndex{
+		buckets: make(map[string]map[string][]int),
+	}
+}
+
+func buildRuleIndex(rules []ruleOption) *ruleIndex {
+	idx := newRuleIndex()
+	for i, rule := range rules {
+		idx.add(i, rule)
+	}
+	return idx
+}
+
+func (idx *ruleIndex) add(pos int, rule ruleOption) {
+	fact, keys, ok := discriminator(rule.Conditions)
+	if !ok {
+		idx.unindexed = append(idx.unindexed, pos)
+		return
+	}
+
+	bucket, exists := idx.buckets[fact]
+	if !exists {
+		bucket = make(map[string][]int)
+		idx.buckets[fact] = bucket
+		idx.facts = append(idx.facts, fact)
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		bucket[key] = append(bucket[key], pos)
+	}
+}
+
+// candidates returns the positions of the rules that may match facts, in
+// ascending order. The second result is false when the facts cannot be
+// looked up safely and every rule has to be evaluated.
+func (idx *ruleIndex) candidates(facts map[string]interface{}) ([]int, bool) {
+	positions := append([]int(nil), idx.unindexed...)
+
+	for _, fact := range idx.facts {
+		value, exists := lookupFact(facts, fact)
+		if !exists {
+			// Conditions on missing facts never match.
+			continue
+		}
+
+		key, ok := indexKey(value)
+		if !ok {
+			if isNaN(value) {
+				return nil, false
+			}
+			// Non-scalar facts never equal the scalar values rules are
+			// filed under.
+			continue
+		}
+
+		positions = append(positions, idx.buckets[fact][key]...)
+	}
+
+	sort.Ints(positions)
+	return positions, true
+}
+
+// discriminator picks the condition a rule is filed under and returns its
+// fact together with the index keys of the values it accepts.
+func discriminator(group ConditionGroup) (string, []string, bool) {
+	if group.Operator != And && len(group.Conditions) != 1 {
+		return "", nil, false
+	}
+
+	for _, condition := range group.Conditions {
+		cond, ok := condition.(Condition)
+		if !ok || cond.Not || cond.Expr != "" {
+			continue
+		}
+
+		switch cond.Operator {
+		case Equal:
+			if key, ok := indexKey(cond.Value); ok {
+				return cond.Fact, []string{key}, true
+			}
+		case In:
+			items, ok := cond.Value.([]interface{})
+			if !ok {
+				continue
+			}
+			keys := make([]string, 0, len(items))
+			for _, item := range items {
+				key, ok := indexKey(item)
+				if !ok {
+					keys = nil
+					break
+				}
+				keys = append(keys, key)
+			}
+			if keys != nil {
+				return cond.Fact, keys, true
+			}
+		}
+	}
+
+	return "", nil, false
+}
+
+// indexKey normalizes a scalar so that values considered equal by
+// compareEqual share the same key.
+func indexKey(v interface{}) (string, bool) {
+	if v == nil {
+		return "nil", true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		f := toFloat64(rv)
+		if math.IsNaN(f) {
+			return "", false
+		}
+		if f == 0 {
+			// Fold negative zero.
+			f = 0
+		}
+		return "n:" + strconv.FormatFloat(f, 'g', -1, 64), true
+	case reflect.String:
+		return "s:" + rv.String(), true
+	case reflect.Bool:
+		return "b:" + strconv.FormatBool(rv.Bool()), true
+	default:
+		return "", false
+	}
+}
+
+func isNaN(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Float32 && rv.Kind() != reflect.Float64 {
+		return false
+	}
+	return math.IsNaN(rv.Float())
+}
+
+// IndexedFacts returns the facts the rule set is indexed on.
+func (r *Rule) IndexedFacts() []string {
+	if r.index == nil {
+		return nil
+	}
+	return append([]string(nil), r.index.facts...)
+}
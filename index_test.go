@@ -0,0 +1,131 @@
+package go_json_rules_engine
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const indexedRules = `[
+	{"id": "vn", "priority": 3, "conditions": {"operator": "and", "conditions": [
+		{"fact": "country", "operator": "equal", "value": "VN"},
+		{"fact": "age", "operator": "greaterThan", "value": 17}
+	]}, "event": {"type": "vn"}},
+	{"id": "sea", "priority": 2, "conditions": {"operator": "and", "conditions": [
+		{"fact": "country", "operator": "in", "value": ["VN", "TH", "SG"]}
+	]}, "event": {"type": "sea"}},
+	{"id": "plan-1", "conditions": {"operator": "and", "conditions": [
+		{"fact": "plan", "operator": "equal", "value": 1}
+	]}, "event": {"type": "plan-1"}},
+	{"id": "flag", "conditions": {"operator": "and", "conditions": [
+		{"fact": "beta", "operator": "in", "value": [true, null]}
+	]}, "event": {"type": "flag"}},
+	{"id": "not-vn", "conditions": {"operator": "and", "conditions": [
+		{"fact": "country", "operator": "notEqual", "value": "VN"}
+	]}, "event": {"type": "not-vn"}},
+	{"id": "negated", "conditions": {"operator": "and", "conditions": [
+		{"fact": "country", "operator": "equal", "value": "VN", "not": true}
+	]}, "event": {"type": "negated"}},
+	{"id": "either", "conditions": {"operator": "or", "conditions": [
+		{"fact": "country", "operator": "equal", "value": "TH"},
+		{"fact": "plan", "operator": "equal", "value": 2}
+	]}, "event": {"type": "either"}},
+	{"id": "domain", "conditions": {"operator": "and", "conditions": [
+		{"fact": "email", "operator": "endsWith", "value": "@example.com"}
+	]}, "event": {"type": "domain"}},
+	{"id": "nested", "conditions": {"operator": "and", "conditions": [
+		{"fact": "user.tier", "operator": "equal", "value": "gold"}
+	]}, "event": {"type": "nested"}}
+]`
+
+var indexedFacts = []map[string]interface{}{
+	{},
+	{"country": "VN", "age": 30},
+	{"country": "VN", "age": 10},
+	{"country": "TH"},
+	{"country": "US", "plan": 2},
+	{"plan": 1},
+	{"plan": 1.0},
+	{"plan": int64(1)},
+	{"plan": math.NaN()},
+	{"plan": "1"},
+	{"beta": true},
+	{"beta": nil},
+	{"beta": false},
+	{"country": []interface{}{"VN"}},
+	{"email": "x@example.com", "country": "SG"},
+	{"user": map[string]interface{}{"tier": "gold"}},
+}
+
+func endsWith(a, b interface{}) bool {
+	s, ok := a.(string)
+	suffix, _ := b.(string)
+	return ok && strings.HasSuffix(s, suffix)
+}
+
+// checkIndexEquivalence compares indexed evaluation with Explain, which
+// always evaluates every rule.
+func checkIndexEquivalence(t *testing.T, eng *Engine) {
+	t.Helper()
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(indexedRules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.IndexedFacts()) == 0 {
+		t.Fatal("rules are not indexed")
+	}
+
+	for _, facts := range indexedFacts {
+		got, err := eng.Evaluate(rules, facts)
+		if err != nil {
+			t.Fatalf("facts %v: %v", facts, err)
+		}
+		full, err := eng.Explain(rules, facts)
+		if err != nil {
+			t.Fatalf("facts %v: %v", facts, err)
+		}
+		if !reflect.DeepEqual(got, full.Events) {
+			t.Errorf("facts %v: indexed events %v, full evaluation %v", facts, got, full.Events)
+		}
+	}
+}
+
+func TestIndexMatchesFullEvaluation(t *testing.T) {
+	eng := NewEngine()
+	if err := eng.RegisterCustomOperator("endsWith", endsWith); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexEquivalence(t, eng)
+}
+
+func TestIndexBypassedForCustomEqual(t *testing.T) {
+	eng := NewEngine()
+	if err := eng.RegisterCustomOperator("endsWith", endsWith); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.RegisterCustomOperator(Equal, func(a, b interface{}) bool {
+		x, ok1 := a.(string)
+		y, ok2 := b.(string)
+		if ok1 && ok2 {
+			return strings.EqualFold(x, y)
+		}
+		return reflect.DeepEqual(a, b)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexEquivalence(t, eng)
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(indexedRules); err != nil {
+		t.Fatal(err)
+	}
+	events, err := eng.Evaluate(rules, map[string]interface{}{"country": "vn", "age": 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || events[0].Type != "vn" {
+		t.Errorf("custom equal was not used: %v", events)
+	}
+}
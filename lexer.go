@@ -0,0 +1,260 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenPunct
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of input"
+	case tokenIdent:
+		return "identifier"
+	case tokenNumber:
+		return "number"
+	case tokenString:
+		return "string"
+	default:
+		return "symbol"
+	}
+}
+
+// Position is a 1-based line and column (counted in characters) within an
+// expression.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	// value holds the decoded literal of number and string tokens.
+	value interface{}
+	// quoted marks identifiers written in backticks, which are never
+	// keywords.
+	quoted bool
+	pos    Position
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenString:
+		return strconv.Quote(t.value.(string))
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// SyntaxError reports a malformed expression and where it went wrong.
+type SyntaxError struct {
+	Pos Position
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %s: %s", e.Pos, e.Msg)
+}
+
+// punctuation lists the multi-character symbols before their prefixes.
+var punctuation = []string{
+	"&&", "||", "==", "!=", ">=", "<=", "=~",
+	"(", ")", "[", "]", "{", "}", ",", ":", "!", ">", "<",
+	"+", "-", "*", "/", "%",
+}
+
+type lexer struct {
+	src  string
+	off  int
+	line int
+	col  int
+}
+
+// tokenize splits src into tokens, ending with a tokenEOF token.
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1, col: 1}
+
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) pos() Position {
+	return Position{Line: l.line, Column: l.col}
+}
+
+func (l *lexer) peek() rune {
+	if l.off >= len(l.src) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.off:])
+	return r
+}
+
+func (l *lexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(l.src[l.off:])
+	l.off += size
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func (l *lexer) next() (token, error) {
+	for unicode.IsSpace(l.peek()) {
+		l.advance()
+	}
+
+	start := l.pos()
+	r := l.peek()
+
+	switch {
+	case r == -1:
+		return token{kind: tokenEOF, pos: start}, nil
+
+	case isIdentStart(r):
+		begin := l.off
+		for isIdentPart(l.peek()) {
+			l.advance()
+		}
+		return token{kind: tokenIdent, text: l.src[begin:l.off], pos: start}, nil
+
+	case r == '`':
+		l.advance()
+		begin := l.off
+		for l.peek() != '`' {
+			if l.peek() == -1 {
+				return token{}, &SyntaxError{Pos: start, Msg: "unterminated quoted identifier"}
+			}
+			l.advance()
+		}
+		name := l.src[begin:l.off]
+		l.advance()
+		return token{kind: tokenIdent, text: name, quoted: true, pos: start}, nil
+
+	case unicode.IsDigit(r):
+		return l.number(start)
+
+	case r == '"' || r == '\'':
+		return l.string(start, r)
+	}
+
+	for _, p := range punctuation {
+		if strings.HasPrefix(l.src[l.off:], p) {
+			for range p {
+				l.advance()
+			}
+			return token{kind: tokenPunct, text: p, pos: start}, nil
+		}
+	}
+
+	return token{}, &SyntaxError{Pos: start, Msg: fmt.Sprintf("unexpected character %q", r)}
+}
+
+func (l *lexer) number(start Position) (token, error) {
+	begin := l.off
+	for unicode.IsDigit(l.peek()) {
+		l.advance()
+	}
+	if l.peek() == '.' {
+		l.advance()
+		for unicode.IsDigit(l.peek()) {
+			l.advance()
+		}
+	}
+	if r := l.peek(); r == 'e' || r == 'E' {
+		l.advance()
+		if r := l.peek(); r == '+' || r == '-' {
+			l.advance()
+		}
+		for unicode.IsDigit(l.peek()) {
+			l.advance()
+		}
+	}
+
+	text := l.src[begin:l.off]
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return token{}, &SyntaxError{Pos: start, Msg: fmt.Sprintf("invalid number %q", text)}
+	}
+	return token{kind: tokenNumber, text: text, value: value, pos: start}, nil
+}
+
+// string reads a quoted string. Double-quoted strings follow JSON escaping;
+// single-quoted strings only support \' and \\.
+func (l *lexer) string(start Position, quote rune) (token, error) {
+	begin := l.off
+	l.advance()
+
+	var sb strings.Builder
+	for {
+		r := l.peek()
+		switch r {
+		case -1, '\n':
+			return token{}, &SyntaxError{Pos: start, Msg: "unterminated string"}
+		case quote:
+			l.advance()
+			text := l.src[begin:l.off]
+			if quote == '\'' {
+				return token{kind: tokenString, text: text, value: sb.String(), pos: start}, nil
+			}
+			var value string
+			if err := json.Unmarshal([]byte(text), &value); err != nil {
+				return token{}, &SyntaxError{Pos: start, Msg: fmt.Sprintf("invalid string %s", text)}
+			}
+			return token{kind: tokenString, text: text, value: value, pos: start}, nil
+		case '\\':
+			l.advance()
+			escaped := l.peek()
+			if escaped == -1 {
+				return token{}, &SyntaxError{Pos: start, Msg: "unterminated string"}
+			}
+			if quote == '\'' && escaped != '\'' && escaped != '\\' {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(l.advance())
+		default:
+			sb.WriteRune(l.advance())
+		}
+	}
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || r == '.' || unicode.IsDigit(r)
+}
@@ -0,0 +1,53 @@
+package go_json_rules_engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// MarshalJSON encodes the rule set as the JSON array accepted by
+// LoadRulesFromJSONString. Rules keep their evaluation order and object keys
+// are written in a fixed order, so equal rule sets always produce identical
+// output. Rules written with a "when" expression are exported in their
+// compiled "conditions" form.
+func (r *Rule) MarshalJSON() ([]byte, error) {
+	rules := r.GetRules()
+	if rules == nil {
+		rules = []ruleOption{}
+	}
+	return json.Marshal(rules)
+}
+
+// UnmarshalJSON replaces the rules in r, like LoadRulesFromJSONString.
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	return r.replaceRules(decodeRules(data, ""))
+}
+
+// WriteJSON writes the rule set to w as indented canonical JSON.
+func (r *Rule) WriteJSON(w io.Writer) error {
+	data, err := r.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// MarshalJSON writes an empty group as an empty conditions array rather than
+// null.
+func (cg ConditionGroup) MarshalJSON() ([]byte, error) {
+	type Alias ConditionGroup
+	alias := Alias(cg)
+	if alias.Conditions == nil {
+		alias.Conditions = []interface{}{}
+	}
+	return json.Marshal(alias)
+}
@@ -0,0 +1,83 @@
+package go_json_rules_engine
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const exportedRules = `[
+	{"id": "full", "name": "Full", "priority": 7, "description": "every field",
+		"tags": ["checkout", "vip"], "owner": "growth", "version": "3",
+		"metadata": {"ticket": "OPS-1", "limits": {"max": 5, "codes": ["a", "b"]}},
+		"enabled": false,
+		"effectiveFrom": "2026-01-01T00:00:00Z", "effectiveUntil": "2027-01-01T00:00:00+07:00",
+		"schedule": {"cron": "0 9-17 * * 1-5", "timezone": "Asia/Ho_Chi_Minh"},
+		"activationGroup": "discounts",
+		"rollout": {"fact": "userId", "percentage": 12.5, "salt": "full-v2"},
+		"score": 2.5, "weight": 0,
+		"conditions": {"operator": "and", "conditions": [
+			{"fact": "age", "operator": "greaterThanInclusive", "value": 18, "not": true},
+			{"expr": "orderTotal * 2", "operator": "greaterThan", "value": {"expr": "monthlyIncome + 1"}},
+			{"operator": "or", "conditions": [
+				{"fact": "user.tier", "operator": "in", "value": ["gold", null, 1.5]},
+				{"fact": "email", "operator": "isNull", "value": null}
+			]}
+		]},
+		"event": {"type": "discount", "params": {"percent": 10, "message": "Hi {{name}}", "nested": {"a": [1, true]}}}},
+	{"id": "when", "when": "!(country == \"VN\" && age < 18) || vip == true", "event": {"type": "x"}},
+	{"id": "empty", "conditions": {"operator": "and", "conditions": []}, "event": {"type": "always"}, "enabled": true}
+]`
+
+func TestExportRoundTrip(t *testing.T) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(exportedRules); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := rules.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewRules()
+	if err := reloaded.LoadRulesFromJSONString(string(exported)); err != nil {
+		t.Fatalf("exported rules do not load: %v\n%s", err, exported)
+	}
+
+	want, got := rules.GetRules(), reloaded.GetRules()
+	if len(got) != len(want) {
+		t.Fatalf("reloaded %d rules, want %d", len(got), len(want))
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		w.Source, g.Source = Source{}, Source{}
+		if w.Schedule != nil && g.Schedule != nil {
+			if w.Schedule.Cron != g.Schedule.Cron || w.Schedule.Timezone != g.Schedule.Timezone {
+				t.Errorf("rule %s: schedule %+v, want %+v", w.ID, g.Schedule, w.Schedule)
+			}
+			w.Schedule, g.Schedule = nil, nil
+		}
+		if w.EffectiveUntil != nil && g.EffectiveUntil != nil && w.EffectiveUntil.Equal(*g.EffectiveUntil) {
+			w.EffectiveUntil, g.EffectiveUntil = nil, nil
+		}
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("rule %s changed:\n got %#v\nwant %#v", w.ID, g, w)
+		}
+	}
+
+	again, err := reloaded.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, exported) {
+		t.Errorf("second export differs:\n%s\n%s", exported, again)
+	}
+
+	diff, err := DiffRules(rules, reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Empty() {
+		t.Errorf("reloaded rules differ:\n%s", diff)
+	}
+}
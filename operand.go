@@ -0,0 +1,243 @@
+package go_json_rules_engine
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// ValueType is a set of JSON value kinds accepted by an operator.
+type ValueType uint8
+
+const (
+	TypeNull ValueType = 1 << iota
+	TypeBool
+	TypeNumber
+	TypeString
+	TypeArray
+	TypeObject
+
+	TypeAny = TypeNull | TypeBool | TypeNumber | TypeString | TypeArray | TypeObject
+)
+
+var valueTypeNames = []struct {
+	typ  ValueType
+	name string
+}{
+	{TypeNull, "null"},
+	{TypeBool, "boolean"},
+	{TypeNumber, "number"},
+	{TypeString, "string"},
+	{TypeArray, "array"},
+	{TypeObject, "object"},
+}
+
+func (t ValueType) String() string {
+	if t == TypeAny {
+		return "any"
+	}
+
+	var names []string
+	for _, n := range valueTypeNames {
+		if t&n.typ != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, " or ")
+}
+
+// Accepts reports whether every kind in other is also in t.
+func (t ValueType) Accepts(other ValueType) bool {
+	return other&^t == 0
+}
+
+// TypeOf returns the kind of a fact or condition value.
+func TypeOf(v interface{}) ValueType {
+	if v == nil {
+		return TypeNull
+	}
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool:
+		return TypeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return TypeNumber
+	case reflect.String:
+		return TypeString
+	case reflect.Slice, reflect.Array:
+		return TypeArray
+	default:
+		return TypeObject
+	}
+}
+
+// OperatorSpec declares the operands an operator works on. FactTypes and
+// ValueTypes list the accepted kinds of the fact and of the condition value.
+// ValidateValue, if set, performs further checks on the condition value, and
+// Coerce, if set, converts the condition value before it is handed to a
+// custom operator.
+type OperatorSpec struct {
+	FactTypes     ValueType
+	ValueTypes    ValueType
+	ValidateValue func(value interface{}) error
+	Coerce        func(value interface{}) (interface{}, error)
+}
+
+var builtinSpecs = map[Operator]OperatorSpec{
+	Equal:          {FactTypes: TypeAny, ValueTypes: TypeAny},
+	NotEqual:       {FactTypes: TypeAny, ValueTypes: TypeAny},
+	GreaterThan:    {FactTypes: TypeNumber, ValueTypes: TypeNumber},
+	LessThan:       {FactTypes: TypeNumber, ValueTypes: TypeNumber},
+	GreaterThanInc: {FactTypes: TypeNumber, ValueTypes: TypeNumber},
+	LessThanInc:    {FactTypes: TypeNumber, ValueTypes: TypeNumber},
+	In:             {FactTypes: TypeAny, ValueTypes: TypeArray},
+	NotIn:          {FactTypes: TypeAny, ValueTypes: TypeArray},
+	Regex:          {FactTypes: TypeString, ValueTypes: TypeString, ValidateValue: validateRegex},
+	IsNull:         {FactTypes: TypeAny, ValueTypes: TypeAny},
+	IsNotNull:      {FactTypes: TypeAny, ValueTypes: TypeAny},
+	InBucket:       {FactTypes: TypeString | TypeNumber | TypeBool, ValueTypes: TypeObject, ValidateValue: validateBucketRange},
+}
+
+func validateRegex(value interface{}) error {
+	_, err := regexp.Compile(value.(string))
+	return err
+}
+
+// OperatorOption configures a custom operator at registration.
+type OperatorOption func(*OperatorSpec)
+
+// WithOperandTypes declares the kinds of fact and condition value a custom
+// operator accepts. Without it both default to TypeAny.
+func WithOperandTypes(fact, value ValueType) OperatorOption {
+	return func(spec *OperatorSpec) {
+		spec.FactTypes = fact
+		spec.ValueTypes = value
+	}
+}
+
+// WithValueValidator adds a check run on every condition value using the
+// operator when rules are validated.
+func WithValueValidator(fn func(value interface{}) error) OperatorOption {
+	return func(spec *OperatorSpec) {
+		spec.ValidateValue = fn
+	}
+}
+
+// WithValueCoercion converts condition values before they are passed to the
+// operator, e.g. parsing a duration string. A value that cannot be coerced
+// fails validation and never matches.
+func WithValueCoercion(fn func(value interface{}) (interface{}, error)) OperatorOption {
+	return func(spec *OperatorSpec) {
+		spec.Coerce = fn
+	}
+}
+
+// OperatorSpec returns the declared operands of op and whether op is known
+// to e.
+func (e *Engine) OperatorSpec(op Operator) (OperatorSpec, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.operatorSpec(op)
+}
+
+func (e *Engine) operatorSpec(op Operator) (OperatorSpec, bool) {
+	if _, custom := e.customOperators[op]; custom {
+		return e.operatorSpecs[op], true
+	}
+	spec, ok := builtinSpecs[op]
+	return spec, ok
+}
+
+// checkOperand verifies a condition value against spec.
+func checkOperand(op Operator, spec OperatorSpec, value interface{}) error {
+	if typ := TypeOf(value); !spec.ValueTypes.Accepts(typ) {
+		return fmt.Errorf("operator %s expects a value of type %s, got %s", op, spec.ValueTypes, typ)
+	}
+	if spec.ValidateValue != nil {
+		if err := spec.ValidateValue(value); err != nil {
+			return fmt.Errorf("invalid value for operator %s: %w", op, err)
+		}
+	}
+	if spec.Coerce != nil {
+		if _, err := spec.Coerce(value); err != nil {
+			return fmt.Errorf("invalid value for operator %s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// checkOperands type-checks every condition of rule against the specs
+// returned by lookup. Operators unknown to lookup are reported only when
+// strict is set, since they may be registered on an engine later.
+func checkOperands(rule ruleOption, lookup func(Operator) (OperatorSpec, bool), strict bool) []error {
+	var errs []error
+	walkConditions(rule.Conditions, "conditions", func(path string, cond Condition) {
+		report := func(err error) {
+			errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: path, Message: err.Error()})
+		}
+
+		// Expressions are type-checked even when the operator is unknown.
+		factType, valueType := ValueType(0), ValueType(0)
+		if cond.Expr != "" {
+			typ, err := expressionType(cond.Expr, anyFactType)
+			if err != nil {
+				report(fmt.Errorf("expr: %w", err))
+				return
+			}
+			factType = typ
+		}
+		if src, ok := valueExpression(cond.Value); ok {
+			typ, err := expressionType(src, anyFactType)
+			if err != nil {
+				report(fmt.Errorf("value: %w", err))
+				return
+			}
+			valueType = typ
+		}
+
+		if cond.Operator == "" {
+			return
+		}
+		spec, ok := lookup(cond.Operator)
+		if !ok {
+			if strict {
+				report(fmt.Errorf("unknown operator %q", cond.Operator))
+			}
+			return
+		}
+
+		if factType != 0 && spec.FactTypes&factType == 0 {
+			report(fmt.Errorf("operator %s cannot be applied to a value of type %s", cond.Operator, factType))
+		}
+		if valueType != 0 {
+			if spec.ValueTypes&valueType == 0 {
+				report(fmt.Errorf("operator %s expects a value of type %s, got %s", cond.Operator, spec.ValueTypes, valueType))
+			}
+			return
+		}
+		if err := checkOperand(cond.Operator, spec, cond.Value); err != nil {
+			report(err)
+		}
+	}, nil)
+	return errs
+}
+
+// expressionType parses src and infers its type from the types of facts.
+func expressionType(src string, factType func(string) ValueType) (ValueType, error) {
+	expr, err := compileExpression(src)
+	if err != nil {
+		return 0, err
+	}
+	return expr.root.typ(factType)
+}
+
+func builtinSpec(op Operator) (OperatorSpec, bool) {
+	spec, ok := builtinSpecs[op]
+	return spec, ok
+}
@@ -0,0 +1,107 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func conditionRules(condition string) string {
+	return fmt.Sprintf(`[{"id": "r", "conditions": {"operator": "and", "conditions": [%s]}, "event": {"type": "x"}}]`, condition)
+}
+
+func TestOperandTypesCheckedAtLoad(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      string // empty if the condition is valid
+	}{
+		{`{"fact": "age", "operator": "greaterThan", "value": 18}`, ""},
+		{`{"fact": "age", "operator": "greaterThan", "value": "18"}`, "operator greaterThan expects a value of type number, got string"},
+		{`{"fact": "c", "operator": "in", "value": "VN"}`, "operator in expects a value of type array, got string"},
+		{`{"fact": "c", "operator": "notIn", "value": ["VN", 1, null]}`, ""},
+		{`{"fact": "name", "operator": "regex", "value": "(unclosed"}`, "invalid value for operator regex"},
+		{`{"fact": "name", "operator": "regex", "value": 5}`, "operator regex expects a value of type string, got number"},
+		{`{"expr": "upper(name)", "operator": "greaterThan", "value": 1}`, "operator greaterThan cannot be applied to a value of type string"},
+		{`{"fact": "age", "operator": "lessThan", "value": {"expr": "upper(name)"}}`, "operator lessThan expects a value of type number, got string"},
+		{`{"fact": "age", "operator": "lessThan", "value": {"expr": "limit * 2"}}`, ""},
+		{`{"fact": "x", "operator": "custom", "value": "anything"}`, ""},
+	}
+	for _, tt := range tests {
+		rules := NewRules()
+		err := rules.LoadRulesFromJSONString(conditionRules(tt.condition))
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: %v", tt.condition, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: error %v, want %q", tt.condition, err, tt.want)
+		case tt.want != "":
+			var verr *ValidationError
+			if !errors.As(err, &verr) || verr.Path != "conditions.conditions[0]" {
+				t.Errorf("%s: error %#v does not point at the condition", tt.condition, verr)
+			}
+		}
+	}
+}
+
+func TestCustomOperandTypes(t *testing.T) {
+	eng := NewEngine()
+	err := eng.RegisterCustomOperator("within", func(a, b interface{}) bool { return true },
+		WithOperandTypes(TypeNumber, TypeString),
+		WithValueCoercion(func(value interface{}) (interface{}, error) {
+			return time.ParseDuration(value.(string))
+		}),
+		WithValueValidator(func(value interface{}) error {
+			if strings.HasPrefix(value.(string), "-") {
+				return errors.New("negative duration")
+			}
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		condition string
+		want      string
+	}{
+		{`{"fact": "age", "operator": "within", "value": "5m"}`, ""},
+		{`{"fact": "age", "operator": "within", "value": 5}`, "operator within expects a value of type string, got number"},
+		{`{"fact": "age", "operator": "within", "value": "-5m"}`, "negative duration"},
+		{`{"fact": "age", "operator": "within", "value": "soon"}`, "invalid value for operator within"},
+		{`{"expr": "lower(name)", "operator": "within", "value": "5m"}`, "cannot be applied to a value of type string"},
+		{`{"fact": "age", "operator": "unknown", "value": 1}`, `unknown operator "unknown"`},
+	}
+	for _, tt := range tests {
+		rules := NewRules()
+		if err := rules.LoadRulesFromJSONString(conditionRules(tt.condition)); err != nil {
+			t.Errorf("%s: custom operators are checked by the engine, not at load: %v", tt.condition, err)
+			continue
+		}
+		err := eng.Validate(rules)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: %v", tt.condition, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: error %v, want %q", tt.condition, err, tt.want)
+		}
+	}
+}
+
+func TestValueTypeString(t *testing.T) {
+	tests := map[ValueType]string{
+		TypeAny:                 "any",
+		TypeNumber:              "number",
+		TypeString | TypeNumber: "number or string",
+		0:                       "none",
+	}
+	for typ, want := range tests {
+		if got := typ.String(); got != want {
+			t.Errorf("%d: %q, want %q", typ, got, want)
+		}
+	}
+	if !TypeAny.Accepts(TypeString|TypeNull) || TypeNumber.Accepts(TypeNumber|TypeNull) {
+		t.Error("Accepts is wrong")
+	}
+}
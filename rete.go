@@ -0,0 +1,266 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Network is a compiled matcher for a rule set in which identical conditions
+// and condition groups are shared between rules. Alpha nodes hold the unique
+// fact tests and beta nodes join them with the group's logical operator, so
+// during a single evaluation each unique test runs at most once and its
+// result is reused by every rule that depends on it.
+//
+// A Network is a snapshot: rules added to the source *Rule after it was built
+// are not seen. It is safe for concurrent use.
+type Network struct {
+	engine    *Engine
+	rules     []ruleOption
+	alpha     []Condition
+	beta      []betaNode
+	terminals []nodeRef
+
+	conditions int
+}
+
+// NetworkStats describes the shape of a compiled Network.
+type NetworkStats struct {
+	Rules      int
+	Conditions int
+	AlphaNodes int
+	BetaNodes  int
+}
+
+type nodeKind uint8
+
+const (
+	alphaKind nodeKind = iota
+	betaKind
+)
+
+type nodeRef struct {
+	kind  nodeKind
+	index int
+}
+
+type betaNode struct {
+	operator LogicalOperator
+	children []nodeRef
+}
+
+type networkBuilder struct {
+	network    *Network
+	alphaIndex map[string]int
+	betaIndex  map[string]int
+}
+
+// BuildNetwork compiles rules into a shared condition Network bound to e,
+// so custom operators registered on e are honored during evaluation.
+func (e *Engine) BuildNetwork(rules *Rule) *Network {
+	b := &networkBuilder{
+		network: &Network{
+			engine: e,
+			rules:  append([]ruleOption(nil), rules.GetRules()...),
+		},
+		alphaIndex: make(map[string]int),
+		betaIndex:  make(map[string]int),
+	}
+
+	for _, rule := range b.network.rules {
+		b.network.terminals = append(b.network.terminals, b.addGroup(rule.Conditions))
+	}
+
+	return b.network
+}
+
+func (b *networkBuilder) addGroup(group ConditionGroup) nodeRef {
+	node := betaNode{operator: group.Operator}
+	for _, condition := range group.Conditions {
+		switch cond := condition.(type) {
+		case Condition:
+			node.children = append(node.children, b.addCondition(cond))
+		case ConditionGroup:
+			node.children = append(node.children, b.addGroup(cond))
+		}
+	}
+
+	key := betaKey(node)
+	if idx, ok := b.betaIndex[key]; ok {
+		return nodeRef{kind: betaKind, index: idx}
+	}
+
+	b.network.beta = append(b.network.beta, node)
+	b.betaIndex[key] = len(b.network.beta) - 1
+	return nodeRef{kind: betaKind, index: len(b.network.beta) - 1}
+}
+
+func (b *networkBuilder) addCondition(cond Condition) nodeRef {
+	b.network.conditions++
+
+	key := conditionKey(cond)
+	if idx, ok := b.alphaIndex[key]; ok {
+		return nodeRef{kind: alphaKind, index: idx}
+	}
+
+	b.network.alpha = append(b.network.alpha, cond)
+	b.alphaIndex[key] = len(b.network.alpha) - 1
+	return nodeRef{kind: alphaKind, index: len(b.network.alpha) - 1}
+}
+
+// conditionKey identifies conditions that always produce the same result for
+// the same facts.
+func conditionKey(cond Condition) string {
+	value, err := json.Marshal(cond.Value)
+	if err != nil {
+		value = []byte(fmt.Sprintf("%#v", cond.Value))
+	}
+	return fmt.Sprintf("%q|%q|%q|%s|%t", cond.Fact, cond.Expr, cond.Operator, value, cond.Not)
+}
+
+func betaKey(node betaNode) string {
+	var sb strings.Builder
+	sb.WriteString(string(node.operator))
+	for _, child := range node.children {
+		fmt.Fprintf(&sb, "|%d:%d", child.kind, child.index)
+	}
+	return sb.String()
+}
+
+// Stats reports how many conditions the network shares between rules.
+func (n *Network) Stats() NetworkStats {
+	return NetworkStats{
+		Rules:      len(n.rules),
+		Conditions: n.conditions,
+		AlphaNodes: len(n.alpha),
+		BetaNodes:  len(n.beta),
+	}
+}
+
+// Evaluate runs the network against facts and returns the events of matching
+// rules in the same order as Engine.Evaluate.
+func (n *Network) Evaluate(facts map[string]interface{}, opts ...EvaluateOption) ([]Event, error) {
+	cfg := n.engine.newEvaluateConfig(opts)
+	if cfg.validateFacts {
+		if err := n.engine.ValidateFacts(facts); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &networkMemory{
+		network: n,
+		env:     &exprEnv{facts: facts, now: cfg.now, operators: cfg.operators},
+		alpha:   make([]memoState, len(n.alpha)),
+		beta:    make([]memoState, len(n.beta)),
+	}
+
+	result := &Explanation{}
+	var errs []error
+	fired := make(activations)
+	for i, rule := range n.rules {
+		if cfg.skipReason(rule) != "" || fired.skipReason(rule) != "" || rule.Rollout.skipReason(rule, facts) != "" {
+			continue
+		}
+		matched, err := m.eval(n.terminals[i])
+		if err != nil {
+			errs = append(errs, &EvaluationError{RuleID: rule.ID, Err: err})
+			continue
+		}
+		if !matched {
+			continue
+		}
+		event, err := renderEvent(rule.Event, m.env, cfg.escape)
+		if err != nil {
+			errs = append(errs, &EvaluationError{RuleID: rule.ID, Err: err})
+			continue
+		}
+		fired.record(rule)
+		result.firedBy = append(result.firedBy, rule)
+		result.fired = append(result.fired, event)
+	}
+
+	if _, err := resolveConflicts(result, n.engine.currentConflictPolicies()); err != nil {
+		errs = append(errs, err)
+	}
+	return result.Events, errors.Join(errs...)
+}
+
+type memoState uint8
+
+const (
+	memoUnknown memoState = iota
+	memoTrue
+	memoFalse
+)
+
+// networkMemory holds the per-evaluation results of every node.
+type networkMemory struct {
+	network *Network
+	env     *exprEnv
+	alpha   []memoState
+	beta    []memoState
+}
+
+func (m *networkMemory) eval(ref nodeRef) (bool, error) {
+	states := m.alpha
+	if ref.kind == betaKind {
+		states = m.beta
+	}
+
+	switch states[ref.index] {
+	case memoTrue:
+		return true, nil
+	case memoFalse:
+		return false, nil
+	}
+
+	var result bool
+	var err error
+	if ref.kind == alphaKind {
+		result, err = m.network.engine.evaluateCondition(m.network.alpha[ref.index], m.env)
+	} else {
+		result, err = m.evalBeta(m.network.beta[ref.index])
+	}
+	if err != nil {
+		// Failures are not memoized; every rule using the node reports
+		// them.
+		return false, err
+	}
+
+	if result {
+		states[ref.index] = memoTrue
+	} else {
+		states[ref.index] = memoFalse
+	}
+	return result, nil
+}
+
+func (m *networkMemory) evalBeta(node betaNode) (bool, error) {
+	if len(node.children) == 0 {
+		return true, nil
+	}
+
+	switch node.operator {
+	case And:
+		for _, child := range node.children {
+			matched, err := m.eval(child)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case Or:
+		for _, child := range node.children {
+			matched, err := m.eval(child)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+
+	default:
+		return false, nil
+	}
+}
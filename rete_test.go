@@ -0,0 +1,104 @@
+package go_json_rules_engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const networkRules = `[
+	{"id": "adult", "priority": 10, "conditions": {"operator": "and", "conditions": [
+		{"fact": "age", "operator": "greaterThanInclusive", "value": 18},
+		{"fact": "country", "operator": "in", "value": ["VN", "TH"]}
+	]}, "event": {"type": "adult"}},
+	{"id": "adult-vip", "priority": 5, "conditions": {"operator": "and", "conditions": [
+		{"fact": "age", "operator": "greaterThanInclusive", "value": 18},
+		{"operator": "or", "conditions": [
+			{"fact": "spend", "operator": "greaterThan", "value": 1000},
+			{"fact": "tier", "operator": "equal", "value": "gold"}
+		]}
+	]}, "event": {"type": "vip", "params": {"tier": "{{tier}}"}}},
+	{"id": "minor", "conditions": {"operator": "and", "conditions": [
+		{"fact": "age", "operator": "greaterThanInclusive", "value": 18, "not": true}
+	]}, "event": {"type": "minor"}},
+	{"id": "no-tier", "conditions": {"operator": "and", "conditions": [
+		{"fact": "tier", "operator": "isNull", "value": null},
+		{"expr": "spend * 2", "operator": "greaterThan", "value": 100}
+	]}, "event": {"type": "upsell"}},
+	{"id": "gold-first", "activationGroup": "tier", "priority": 3, "conditions": {"operator": "and", "conditions": [
+		{"fact": "tier", "operator": "equal", "value": "gold"}
+	]}, "event": {"type": "gold"}},
+	{"id": "gold-second", "activationGroup": "tier", "priority": 2, "conditions": {"operator": "and", "conditions": [
+		{"fact": "tier", "operator": "in", "value": ["gold", "silver"]}
+	]}, "event": {"type": "member"}},
+	{"id": "email", "conditions": {"operator": "and", "conditions": [
+		{"fact": "email", "operator": "endsWith", "value": "@example.com"}
+	]}, "event": {"type": "internal"}}
+]`
+
+var networkFacts = []map[string]interface{}{
+	{},
+	{"age": 17},
+	{"age": 18, "country": "VN"},
+	{"age": 30, "country": "US", "spend": 2000},
+	{"age": 40, "country": "TH", "tier": "gold"},
+	{"age": 40, "tier": "silver", "spend": 10},
+	{"spend": 60, "email": "a@example.com"},
+	{"age": "not a number", "tier": nil, "spend": 51},
+}
+
+func TestNetworkMatchesEvaluate(t *testing.T) {
+	eng := NewEngine()
+	if err := eng.RegisterCustomOperator("endsWith", func(a, b interface{}) bool {
+		s, ok := a.(string)
+		suffix, _ := b.(string)
+		return ok && strings.HasSuffix(s, suffix)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(networkRules); err != nil {
+		t.Fatal(err)
+	}
+	network := eng.BuildNetwork(rules)
+
+	for _, facts := range networkFacts {
+		want, wantErr := eng.Evaluate(rules, facts)
+		got, gotErr := network.Evaluate(facts)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("facts %v: network events %v, Evaluate events %v", facts, got, want)
+		}
+		if (gotErr == nil) != (wantErr == nil) {
+			t.Errorf("facts %v: network error %v, Evaluate error %v", facts, gotErr, wantErr)
+		}
+	}
+}
+
+func TestNetworkUsesRuleSetOperators(t *testing.T) {
+	eng := NewEngine()
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(`[{"id": "even", "conditions": {"operator": "and", "conditions": [
+		{"fact": "n", "operator": "even", "value": true}
+	]}, "event": {"type": "even"}}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	operators := map[Operator]customOperator{
+		"even": {fn: func(a, b interface{}) bool {
+			n, ok := numberValue(a)
+			return ok && int(n)%2 == 0
+		}},
+	}
+	withOperators := func(cfg *evaluateConfig) { cfg.operators = operators }
+
+	facts := map[string]interface{}{"n": 4}
+	want, err := eng.Evaluate(rules, facts, withOperators)
+	if err != nil || len(want) != 1 {
+		t.Fatalf("Evaluate = %v, %v; want one event", want, err)
+	}
+	got, err := eng.BuildNetwork(rules).Evaluate(facts, withOperators)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("network = %v, %v; want %v", got, err, want)
+	}
+}
@@ -0,0 +1,195 @@
+package go_json_rules_engine
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Percentage rollouts assign every value of a fact, such as a user ID, to
+// one of BucketCount buckets:
+//
+//	bucket = uint64(sha256(salt + "." + key)[0:8]) mod BucketCount
+//
+// where the first 8 bytes of the digest are read big-endian and key is the
+// fact as text: strings unchanged, integers and integral floats in decimal
+// without exponent or fraction (42 and 42.0 are both "42"), other numbers in
+// the shortest decimal form that round-trips and booleans as "true" or
+// "false". The bucket depends on nothing but the salt and the value, so it is
+// the same in every process and release. Using a different salt per rollout
+// or experiment keeps their populations independent.
+
+// BucketCount is the number of buckets, giving percentages a resolution of
+// 0.01.
+const BucketCount = 10000
+
+// InBucket matches facts whose bucket is within the range given by the
+// condition value, either the lowest percentage of buckets:
+//
+//	{"fact": "userId", "operator": "inBucket", "value": {"salt": "new-checkout", "percentage": 10}}
+//
+// or an explicit half-open range of buckets, e.g. for the B arm of an A/B
+// test:
+//
+//	{"fact": "userId", "operator": "inBucket", "value": {"salt": "exp-42", "buckets": [5000, 10000]}}
+const InBucket Operator = "inBucket"
+
+// Rollout limits a rule to a stable percentage of the values of Fact. Salt
+// defaults to the rule's ID. Rules outside their rollout, or whose fact is
+// missing, are skipped.
+type Rollout struct {
+	Fact       string  `json:"fact"`
+	Percentage float64 `json:"percentage"`
+	Salt       string  `json:"salt,omitempty"`
+}
+
+// Bucket returns the bucket of value under salt, and false if value is not
+// a string, number or boolean.
+func Bucket(salt string, value interface{}) (int, bool) {
+	key, ok := bucketKey(value)
+	if !ok {
+		return 0, false
+	}
+	sum := sha256.Sum256([]byte(salt + "." + key))
+	return int(binary.BigEndian.Uint64(sum[:8]) % BucketCount), true
+}
+
+func bucketKey(value interface{}) (string, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// percentageBuckets returns the number of buckets covering percentage.
+func percentageBuckets(percentage float64) int {
+	return int(math.Round(percentage * BucketCount / 100))
+}
+
+// bucketRange is a parsed inBucket condition value.
+type bucketRange struct {
+	salt     string
+	from, to int
+}
+
+func parseBucketRange(value interface{}) (bucketRange, error) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return bucketRange{}, errors.New("expected an object with salt and percentage or buckets")
+	}
+
+	var r bucketRange
+	for key := range fields {
+		if key != "salt" && key != "percentage" && key != "buckets" {
+			return bucketRange{}, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	r.salt, ok = fields["salt"].(string)
+	if !ok || r.salt == "" {
+		return bucketRange{}, errors.New("salt must be a non-empty string")
+	}
+
+	percentage, hasPercentage := fields["percentage"]
+	buckets, hasBuckets := fields["buckets"]
+	switch {
+	case hasPercentage == hasBuckets:
+		return bucketRange{}, errors.New("exactly one of percentage and buckets must be set")
+	case hasPercentage:
+		p, ok := numberValue(percentage)
+		if !ok || p < 0 || p > 100 {
+			return bucketRange{}, errors.New("percentage must be a number from 0 to 100")
+		}
+		r.to = percentageBuckets(p)
+	default:
+		bounds, ok := buckets.([]interface{})
+		if !ok || len(bounds) != 2 {
+			return bucketRange{}, errors.New("buckets must be a [from, to) pair")
+		}
+		from, okFrom := numberValue(bounds[0])
+		to, okTo := numberValue(bounds[1])
+		if !okFrom || !okTo || from != math.Trunc(from) || to != math.Trunc(to) || from < 0 || to > BucketCount || from > to {
+			return bucketRange{}, fmt.Errorf("buckets must be integers with 0 <= from <= to <= %d", BucketCount)
+		}
+		r.from, r.to = int(from), int(to)
+	}
+	return r, nil
+}
+
+func validateBucketRange(value interface{}) error {
+	_, err := parseBucketRange(value)
+	return err
+}
+
+func (e *Engine) evaluateInBucket(fact, value interface{}) bool {
+	r, err := parseBucketRange(value)
+	if err != nil {
+		return false
+	}
+	bucket, ok := Bucket(r.salt, fact)
+	return ok && bucket >= r.from && bucket < r.to
+}
+
+// skipReason explains why rule is outside its rollout for facts, or returns
+// "" if it takes part.
+func (r *Rollout) skipReason(rule ruleOption, facts map[string]interface{}) string {
+	if r == nil {
+		return ""
+	}
+	value, exists := lookupFact(facts, r.Fact)
+	if !exists {
+		return fmt.Sprintf("outside rollout: fact %s is missing", r.Fact)
+	}
+	salt := r.Salt
+	if salt == "" {
+		salt = rule.ID
+	}
+	bucket, ok := Bucket(salt, value)
+	if !ok {
+		return fmt.Sprintf("outside rollout: fact %s cannot be bucketed", r.Fact)
+	}
+	if limit := percentageBuckets(r.Percentage); bucket >= limit {
+		return fmt.Sprintf("outside rollout: bucket %d of %s is not below %d (%g%%)", bucket, r.Fact, limit, r.Percentage)
+	}
+	return ""
+}
+
+// checkRollout reports an invalid rollout, so that a rule set with one fails
+// to load.
+func checkRollout(rule ruleOption) []error {
+	if rule.Rollout == nil {
+		return nil
+	}
+	if msg := rule.Rollout.validate(); msg != "" {
+		return []error{&ValidationError{RuleID: rule.ID, Source: rule.Source, Path: "rollout", Message: msg}}
+	}
+	return nil
+}
+
+func (r *Rollout) validate() string {
+	switch {
+	case r.Fact == "":
+		return "missing fact"
+	case r.Percentage < 0 || r.Percentage > 100:
+		return "percentage must be from 0 to 100"
+	}
+	return ""
+}
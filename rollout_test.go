@@ -0,0 +1,187 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBucketVectors(t *testing.T) {
+	tests := []struct {
+		salt  string
+		value interface{}
+		want  int
+	}{
+		{"new-checkout", "user-1", 3402},
+		{"new-checkout", "user-2", 7100},
+		{"new-checkout", "user-3", 7923},
+		{"new-checkout", "user-54", 21},
+		{"exp-42", "user-1", 3258},
+		{"exp-42", 12345, 3993},
+		{"exp-42", int64(12345), 3993},
+		{"exp-42", uint16(12345), 3993},
+		{"exp-42", 12345.0, 3993},
+		{"exp-42", float32(12345), 3993},
+		{"exp-42", "12345", 3993},
+		{"", "alice", 8853},
+		{"flag", true, 7199},
+		{"flag", "true", 7199},
+	}
+	for _, tt := range tests {
+		got, ok := Bucket(tt.salt, tt.value)
+		if !ok || got != tt.want {
+			t.Errorf("Bucket(%q, %#v) = %d, %v; want %d", tt.salt, tt.value, got, ok, tt.want)
+		}
+	}
+}
+
+func TestBucketKeys(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"a.b", "a.b"},
+		{-7, "-7"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{42.0, "42"},
+		{1.5, "1.5"},
+		{1e21, "1000000000000000000000"},
+		{0.1, "0.1"},
+		{false, "false"},
+	}
+	for _, tt := range tests {
+		if got, ok := bucketKey(tt.value); !ok || got != tt.want {
+			t.Errorf("bucketKey(%#v) = %q, %v; want %q", tt.value, got, ok, tt.want)
+		}
+	}
+
+	for _, value := range []interface{}{nil, math.NaN(), math.Inf(1), []interface{}{"a"}, map[string]interface{}{}} {
+		if _, ok := Bucket("s", value); ok {
+			t.Errorf("Bucket accepted %#v", value)
+		}
+	}
+}
+
+func TestInBucketRanges(t *testing.T) {
+	// user-54 is in bucket 21 under new-checkout.
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{`{"salt": "new-checkout", "percentage": 0}`, false},
+		{`{"salt": "new-checkout", "percentage": 100}`, true},
+		{`{"salt": "new-checkout", "percentage": 0.21}`, false},
+		{`{"salt": "new-checkout", "percentage": 0.22}`, true},
+		{`{"salt": "new-checkout", "buckets": [0, 21]}`, false},
+		{`{"salt": "new-checkout", "buckets": [21, 22]}`, true},
+		{`{"salt": "new-checkout", "buckets": [21, 21]}`, false},
+		{`{"salt": "new-checkout", "buckets": [0, 10000]}`, true},
+		{`{"salt": "new-checkout", "buckets": [22, 10000]}`, false},
+	}
+	eng := NewEngine()
+	for _, tt := range tests {
+		rules := NewRules()
+		if err := rules.LoadRulesFromJSONString(fmt.Sprintf(`[{"id": "r", "conditions": {"operator": "and", "conditions": [
+			{"fact": "userId", "operator": "inBucket", "value": %s}
+		]}, "event": {"type": "x"}}]`, tt.value)); err != nil {
+			t.Fatalf("%s: %v", tt.value, err)
+		}
+		events, err := eng.Evaluate(rules, map[string]interface{}{"userId": "user-54"})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.value, err)
+		}
+		if got := len(events) == 1; got != tt.want {
+			t.Errorf("%s: matched %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestInBucketRejectsInvalidRanges(t *testing.T) {
+	for _, value := range []string{
+		`{"salt": "s", "percentage": -1}`,
+		`{"salt": "s", "percentage": 100.5}`,
+		`{"salt": "s", "buckets": [-1, 10]}`,
+		`{"salt": "s", "buckets": [0, 10001]}`,
+		`{"salt": "s", "buckets": [20, 10]}`,
+		`{"salt": "s", "buckets": [0.5, 10]}`,
+		`{"salt": "s", "buckets": [0]}`,
+		`{"salt": "s", "percentage": 10, "buckets": [0, 10]}`,
+		`{"salt": "s"}`,
+		`{"percentage": 10}`,
+		`{"salt": "s", "percentage": 10, "extra": 1}`,
+	} {
+		rules := NewRules()
+		err := rules.LoadRulesFromJSONString(fmt.Sprintf(`[{"id": "r", "conditions": {"operator": "and", "conditions": [
+			{"fact": "userId", "operator": "inBucket", "value": %s}
+		]}, "event": {"type": "x"}}]`, value))
+		if err == nil {
+			t.Errorf("%s: accepted", value)
+		}
+	}
+}
+
+func TestRolloutPercentage(t *testing.T) {
+	eng := NewEngine()
+	for _, tt := range []struct {
+		percentage float64
+		want       int
+	}{{0, 0}, {100, 100}} {
+		rules := NewRules()
+		if err := rules.LoadRulesFromJSONString(fmt.Sprintf(`[{"id": "r", "rollout": {"fact": "userId", "percentage": %g},
+			"conditions": {"operator": "and", "conditions": []}, "event": {"type": "x"}}]`, tt.percentage)); err != nil {
+			t.Fatal(err)
+		}
+		matched := 0
+		for i := 0; i < 100; i++ {
+			events, err := eng.Evaluate(rules, map[string]interface{}{"userId": fmt.Sprintf("user-%d", i)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			matched += len(events)
+		}
+		if matched != tt.want {
+			t.Errorf("percentage %g: %d of 100 users matched, want %d", tt.percentage, matched, tt.want)
+		}
+	}
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(`[{"id": "r", "rollout": {"fact": "userId", "percentage": 100},
+		"conditions": {"operator": "and", "conditions": []}, "event": {"type": "x"}}]`); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := eng.Evaluate(rules, map[string]interface{}{}); len(events) != 0 {
+		t.Error("rule matched without the rollout fact")
+	}
+}
+
+func TestRolloutValidation(t *testing.T) {
+	tests := []struct {
+		rollout string
+		want    string
+	}{
+		{`{"fact": "userId", "percentage": 150}`, "percentage must be from 0 to 100"},
+		{`{"fact": "userId", "percentage": -1}`, "percentage must be from 0 to 100"},
+		{`{"percentage": 10}`, "missing fact"},
+	}
+	for _, tt := range tests {
+		rules := NewRules()
+		err := rules.LoadRulesFromJSONString(`[{"id": "r", "rollout": ` + tt.rollout + `,
+			"conditions": {"operator": "and", "conditions": []}, "event": {"type": "x"}}]`)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Path != "rollout" || verr.Message != tt.want {
+			t.Errorf("rollout %s: error %v, want rollout: %s", tt.rollout, err, tt.want)
+		}
+		if len(rules.GetRules()) != 0 {
+			t.Errorf("rollout %s: rules were loaded", tt.rollout)
+		}
+	}
+
+	// Rules built in code are still checked by Validate.
+	rules := NewRules()
+	rules.AddRule(ruleOption{ID: "r", Rollout: &Rollout{Fact: "userId", Percentage: 150}, Event: Event{Type: "x"}})
+	if err := rules.Validate(); err == nil || !strings.Contains(err.Error(), "percentage must be from 0 to 100") {
+		t.Errorf("Validate: error %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"sort"
+	"time"
 )
 
 // Operator represents the comparison operators that can be used in conditions.
@@ -34,10 +35,17 @@ const (
 	Or  LogicalOperator = "or"
 )
 
+// Condition compares a fact, or the result of the expression Expr, with
+// Value using Operator. Value may itself be computed by an expression,
+// written {"expr": "..."}; see ParseConditions for the syntax.
 type Condition struct {
-	Fact     string      `json:"fact"`
+	Fact     string      `json:"fact,omitempty"`
+	Expr     string      `json:"expr,omitempty"`
 	Operator Operator    `json:"operator"`
 	Value    interface{} `json:"value"`
+	// Not inverts the result of the comparison, including when the fact
+	// is missing.
+	Not bool `json:"not,omitempty"`
 }
 
 type ConditionGroup struct {
@@ -51,35 +59,58 @@ func (cg *ConditionGroup) UnmarshalJSON(data []byte) error {
 	type Alias ConditionGroup
 	aux := &struct {
 		*Alias
+		Use *string `json:"$use"`
 	}{
 		Alias: (*Alias)(cg),
 	}
 	if err := json.Unmarshal(data, &aux); err != nil {
 		return err
 	}
+	if aux.Use != nil {
+		if cg.Operator != "" || cg.Conditions != nil || *aux.Use == "" {
+			return errors.New("\"$use\" must name a fragment and be the only key")
+		}
+		*cg = ConditionGroup{Operator: And, Conditions: []interface{}{fragmentRef{name: *aux.Use}}}
+		return nil
+	}
 
 	// Validate and convert conditions
 	for i, condition := range cg.Conditions {
+		fields, ok := condition.(map[string]interface{})
+		if !ok {
+			return errors.New("invalid condition format")
+		}
+
 		condData, err := json.Marshal(condition)
 		if err != nil {
 			return err
 		}
 
-		// Try to unmarshal as Condition
-		var singleCond Condition
-		if err := json.Unmarshal(condData, &singleCond); err == nil {
-			cg.Conditions[i] = singleCond
+		// Entries carrying a "conditions" key are nested groups, entries
+		// with "$use" reference a fragment and everything else is a single
+		// condition.
+		if use, isRef := fields["$use"]; isRef {
+			name, ok := use.(string)
+			if !ok || name == "" || len(fields) != 1 {
+				return errors.New("\"$use\" must name a fragment and be the only key")
+			}
+			cg.Conditions[i] = fragmentRef{name: name}
 			continue
 		}
-
-		// Try to unmarshal as ConditionGroup
-		var groupCond ConditionGroup
-		if err := json.Unmarshal(condData, &groupCond); err == nil {
+		if _, isGroup := fields["conditions"]; isGroup {
+			var groupCond ConditionGroup
+			if err := json.Unmarshal(condData, &groupCond); err != nil {
+				return err
+			}
 			cg.Conditions[i] = groupCond
 			continue
 		}
 
-		return errors.New("invalid condition format")
+		var singleCond Condition
+		if err := json.Unmarshal(condData, &singleCond); err != nil {
+			return err
+		}
+		cg.Conditions[i] = singleCond
 	}
 
 	return nil
@@ -91,6 +122,78 @@ type ruleOption struct {
 	Priority   int            `json:"priority"`
 	Conditions ConditionGroup `json:"conditions"`
 	Event      Event          `json:"event"`
+
+	Description string                 `json:"description,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Owner       string                 `json:"owner,omitempty"`
+	Version     string                 `json:"version,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	// Enabled defaults to true when omitted; disabled rules are skipped.
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// EffectiveFrom and EffectiveUntil bound the period in which the rule is
+	// active; EffectiveUntil is exclusive. Schedule further limits it to
+	// recurring times.
+	EffectiveFrom  *time.Time `json:"effectiveFrom,omitempty"`
+	EffectiveUntil *time.Time `json:"effectiveUntil,omitempty"`
+	Schedule       *Schedule  `json:"schedule,omitempty"`
+
+	// ActivationGroup names a set of mutually exclusive rules: once a rule
+	// of the group matches, the group's later rules in evaluation order are
+	// skipped.
+	ActivationGroup string `json:"activationGroup,omitempty"`
+
+	// Rollout limits the rule to a stable percentage of the values of a
+	// fact; see rollout.go.
+	Rollout *Rollout `json:"rollout,omitempty"`
+
+	// Score is the number of points the rule adds when it matches in
+	// Engine.Score, scaled by Weight, which defaults to 1.
+	Score  *float64 `json:"score,omitempty"`
+	Weight *float64 `json:"weight,omitempty"`
+
+	// Source records where the rule was loaded from for error reporting.
+	Source Source `json:"-"`
+
+	// extends is the ID of the parent rule until it is resolved at load
+	// time; see fragment.go.
+	extends string
+}
+
+// IsEnabled reports whether the rule takes part in evaluation.
+func (o ruleOption) IsEnabled() bool {
+	return o.Enabled == nil || *o.Enabled
+}
+
+// UnmarshalJSON accepts the rule's conditions either as a "conditions" group
+// or as a "when" expression (see ParseConditions), but not both, and records
+// the parent named by "extends".
+func (o *ruleOption) UnmarshalJSON(data []byte) error {
+	type Alias ruleOption
+	aux := &struct {
+		*Alias
+		When    *string `json:"when"`
+		Extends string  `json:"extends"`
+	}{
+		Alias: (*Alias)(o),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	o.extends = aux.Extends
+	if aux.When == nil {
+		return nil
+	}
+
+	if len(o.Conditions.Conditions) > 0 {
+		return errors.New("rule must not define both \"when\" and \"conditions\"")
+	}
+	group, err := ParseConditions(*aux.When)
+	if err != nil {
+		return fmt.Errorf("when: %w", err)
+	}
+	o.Conditions = group
+	return nil
 }
 
 // Event represents what should happen when a rule's conditions are met.
@@ -100,17 +203,22 @@ type Event struct {
 }
 
 type Rule struct {
-	opts []ruleOption
+	opts  []ruleOption
+	index *ruleIndex
 }
 
 func NewRules() *Rule {
 	return &Rule{
-		opts: make([]ruleOption, 0),
+		opts:  make([]ruleOption, 0),
+		index: newRuleIndex(),
 	}
 }
 
 func (r *Rule) AddRule(opts ruleOption) {
 	r.opts = append(r.opts, opts)
+	if r.index != nil {
+		r.index.add(len(r.opts)-1, opts)
+	}
 }
 
 func (r *Rule) LoadRulesFromJSON(filename string) error {
@@ -119,17 +227,40 @@ func (r *Rule) LoadRulesFromJSON(filename string) error {
 		return fmt.Errorf("failed to read rules file: %w", err)
 	}
 
-	return r.LoadRulesFromJSONString(string(data))
+	return r.replaceRules(decodeRules(data, filename))
 }
 
 func (r *Rule) LoadRulesFromJSONString(jsonStr string) error {
-	var rules []ruleOption
-	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
-		return fmt.Errorf("failed to parse rules: %w", err)
+	return r.replaceRules(decodeRules([]byte(jsonStr), ""))
+}
+
+// replaceRules replaces the rules in r with freshly decoded ones.
+func (r *Rule) replaceRules(rules []ruleOption, err error) error {
+	if err != nil {
+		return err
+	}
+	if err := checkLoadedRules(rules); err != nil {
+		return err
 	}
 
 	r.opts = rules
 	r.sortRulesByPriority()
+	r.index = buildRuleIndex(r.opts)
+	return nil
+}
+
+// checkLoadedRules type-checks the conditions of freshly loaded rules that
+// use built-in operators and parses their event param templates.
+func checkLoadedRules(rules []ruleOption) error {
+	var errs []error
+	for _, rule := range rules {
+		errs = append(errs, checkOperands(rule, builtinSpec, false)...)
+		errs = append(errs, checkParams(rule)...)
+		errs = append(errs, checkRollout(rule)...)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to load rules: %w", errors.Join(errs...))
+	}
 	return nil
 }
 
@@ -138,7 +269,7 @@ func (r *Rule) GetRules() []ruleOption {
 }
 
 func (r *Rule) sortRulesByPriority() {
-	sort.Slice(r.opts, func(i, j int) bool {
+	sort.SliceStable(r.opts, func(i, j int) bool {
 		return r.opts[i].Priority > r.opts[j].Priority
 	})
 }
@@ -0,0 +1,484 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RuleTemplate is a rule shape shared by several concrete rules, such as one
+// rule per market with different thresholds. Placeholders in the rule whose
+// expressions only reference declared params are substituted when the
+// template is instantiated:
+//
+//	{
+//	  "name": "eligibility",
+//	  "params": {"country": {"type": "string"}, "minAge": {"type": "number", "default": 18}},
+//	  "key": "{{lower(country)}}",
+//	  "rule": {
+//	    "priority": 10,
+//	    "when": "country == \"{{country}}\" && age >= {{minAge}}",
+//	    "event": {"type": "eligible", "params": {"message": "Welcome, {{name}}"}}
+//	  }
+//	}
+//
+// A string that is a single placeholder takes the param's value and type;
+// otherwise the value is inserted as text. In "when" and "expr" expressions
+// values are inserted as literals: escaped inside a quoted string, quoted
+// elsewhere, so a param can never change the expression. Other
+// placeholders, such as {{name}} above, are left for event params to render
+// at evaluation time.
+//
+// Each instance becomes a rule with the ID "<name>:<key>", where the key is
+// given by the instance or computed from the template's Key, e.g.
+// "eligibility:vn". Keys may only contain letters, digits, '-', '_' and
+// '.', and must be unique among the instances.
+type RuleTemplate struct {
+	Name   string                   `json:"name"`
+	Params map[string]TemplateParam `json:"params,omitempty"`
+	Key    string                   `json:"key,omitempty"`
+	Rule   json.RawMessage          `json:"rule"`
+
+	source string
+}
+
+// TemplateParam declares a template parameter. A param without a Default
+// must be given by every instance.
+type TemplateParam struct {
+	Type    ValueType
+	Default interface{}
+}
+
+// TemplateInstance instantiates the template named Template with Params.
+// Key, if set, overrides the key computed by the template.
+type TemplateInstance struct {
+	Template string                 `json:"template"`
+	Key      string                 `json:"key,omitempty"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+
+	source Source
+}
+
+// UnmarshalJSON reads the param type by name, e.g. "number", defaulting to
+// any type.
+func (p *TemplateParam) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Type    string      `json:"type"`
+		Default interface{} `json:"default"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	p.Type, p.Default = TypeAny, aux.Default
+	if aux.Type == "" || aux.Type == "any" {
+		return nil
+	}
+	for _, n := range valueTypeNames {
+		if n.name == aux.Type {
+			p.Type = n.typ
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown param type %q", aux.Type)
+}
+
+func (p TemplateParam) MarshalJSON() ([]byte, error) {
+	aux := struct {
+		Type    string      `json:"type"`
+		Default interface{} `json:"default,omitempty"`
+	}{Type: p.Type.String(), Default: p.Default}
+	return json.Marshal(aux)
+}
+
+// ParseRuleTemplate parses and checks a rule template from JSON.
+func ParseRuleTemplate(data []byte) (*RuleTemplate, error) {
+	var t RuleTemplate
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse rule template: %w", err)
+	}
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// LoadRuleTemplate reads a rule template from a JSON file.
+func LoadRuleTemplate(filename string) (*RuleTemplate, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule template: %w", err)
+	}
+
+	t, err := ParseRuleTemplate(data)
+	if err != nil {
+		return nil, err
+	}
+	t.source = filename
+	return t, nil
+}
+
+func (t *RuleTemplate) check() error {
+	if t.Name == "" {
+		return errors.New("rule template is missing a name")
+	}
+	if len(t.Rule) == 0 {
+		return fmt.Errorf("rule template %s has no rule", t.Name)
+	}
+
+	var rule map[string]interface{}
+	if err := json.Unmarshal(t.Rule, &rule); err != nil {
+		return fmt.Errorf("rule template %s: rule: %w", t.Name, err)
+	}
+	if _, ok := rule["id"]; ok {
+		return fmt.Errorf("rule template %s: rule must not set an id; instances are identified as %s:<key>", t.Name, t.Name)
+	}
+	for name, param := range t.Params {
+		if param.Default != nil && !param.Type.Accepts(TypeOf(param.Default)) {
+			return fmt.Errorf("rule template %s: param %s: default %v is not a %s", t.Name, name, param.Default, param.Type)
+		}
+	}
+	return nil
+}
+
+// Rules expands the instances into rules, in the order given.
+func (t *RuleTemplate) Rules(instances ...TemplateInstance) (*Rule, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+
+	var opts []ruleOption
+	var errs []error
+	seen := make(map[string]Source, len(instances))
+	for _, inst := range instances {
+		if inst.source.File == "" {
+			inst.source.File = t.source
+		}
+		rule, err := t.instantiate(inst)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if first, ok := seen[rule.ID]; ok {
+			errs = append(errs, &DuplicateRuleError{ID: rule.ID, First: first, Second: rule.Source})
+			continue
+		}
+		seen[rule.ID] = rule.Source
+		opts = append(opts, rule)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("rule template %s: %w", t.Name, errors.Join(errs...))
+	}
+
+	opts, err := resolveReferences(opts, nil)
+	if err == nil {
+		err = checkLoadedRules(opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rule template %s: %w", t.Name, err)
+	}
+
+	rules := NewRules()
+	for _, rule := range opts {
+		rules.AddRule(rule)
+	}
+	return rules, nil
+}
+
+// AddRuleTemplate expands the instances of t and merges them into r.
+func (r *Rule) AddRuleTemplate(t *RuleTemplate, instances ...TemplateInstance) error {
+	expanded, err := t.Rules(instances...)
+	if err != nil {
+		return err
+	}
+	return r.mergeRules(expanded.opts)
+}
+
+// instantiate expands one instance into a rule.
+func (t *RuleTemplate) instantiate(inst TemplateInstance) (ruleOption, error) {
+	fail := func(format string, args ...interface{}) (ruleOption, error) {
+		msg := fmt.Sprintf(format, args...)
+		if inst.source != (Source{}) {
+			msg = fmt.Sprintf("%s: %s", inst.source, msg)
+		}
+		return ruleOption{}, errors.New(msg)
+	}
+	if inst.Template != "" && inst.Template != t.Name {
+		return fail("instance of template %q", inst.Template)
+	}
+
+	params, err := t.bind(inst.Params)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	key := inst.Key
+	if key == "" && t.Key != "" {
+		value, err := substitute(t.Key, params, false)
+		if err != nil {
+			return fail("key: %v", err)
+		}
+		key = formatText(value)
+	}
+	if key == "" || strings.Contains(key, "{{") {
+		return fail("instance has no key and the template does not compute one")
+	}
+	if i := strings.IndexFunc(key, func(r rune) bool { return !isKeyRune(r) }); i >= 0 {
+		r, _ := utf8.DecodeRuneInString(key[i:])
+		return fail("key %q contains %q, which is not allowed in rule IDs", key, r)
+	}
+	id := t.Name + ":" + key
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(t.Rule, &body); err != nil {
+		return fail("%v", err)
+	}
+	expanded, err := substituteValue(body, params, false)
+	if err != nil {
+		return fail("instance %s: %v", id, err)
+	}
+	data, err := json.Marshal(expanded)
+	if err != nil {
+		return fail("instance %s: %v", id, err)
+	}
+
+	var rule ruleOption
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return fail("instance %s: %v", id, err)
+	}
+	rule.ID = id
+	rule.Source = inst.source
+
+	metadata := make(map[string]interface{}, len(rule.Metadata)+2)
+	for k, v := range rule.Metadata {
+		metadata[k] = v
+	}
+	metadata["template"] = t.Name
+	metadata["instance"] = key
+	rule.Metadata = metadata
+	return rule, nil
+}
+
+// bind checks the instance's params against the declarations and fills in
+// defaults.
+func (t *RuleTemplate) bind(values map[string]interface{}) (map[string]interface{}, error) {
+	names := make([]string, 0, len(t.Params)+len(values))
+	for name := range t.Params {
+		names = append(names, name)
+	}
+	for name := range values {
+		if _, declared := t.Params[name]; !declared {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	params := make(map[string]interface{}, len(names))
+	var problems []string
+	for _, name := range names {
+		decl, declared := t.Params[name]
+		value, given := values[name]
+		switch {
+		case !declared:
+			problems = append(problems, fmt.Sprintf("unknown param %s", name))
+		case !given && decl.Default == nil:
+			problems = append(problems, fmt.Sprintf("missing param %s", name))
+		case !given:
+			params[name] = decl.Default
+		case !decl.Type.Accepts(TypeOf(value)):
+			problems = append(problems, fmt.Sprintf("param %s: expected %s, got %s", name, decl.Type, TypeOf(value)))
+		default:
+			params[name] = value
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return params, nil
+}
+
+func isKeyRune(r rune) bool {
+	return r == '-' || r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// substituteValue substitutes params into every string of value. expr marks
+// value as the source of an expression.
+func substituteValue(value interface{}, params map[string]interface{}, expr bool) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return substitute(v, params, expr)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			s, err := substituteValue(item, params, key == "when" || key == "expr")
+			if err != nil {
+				return nil, err
+			}
+			out[key] = s
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			s, err := substituteValue(item, params, false)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = s
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
+
+// substitute replaces the placeholders of s that only reference params.
+// Strings that are not templates are returned unchanged. If s is the source
+// of an expression, values are inserted as literals.
+func substitute(s string, params map[string]interface{}, expr bool) (interface{}, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	t, err := parseTemplate(s)
+	if err != nil {
+		return s, nil
+	}
+
+	env := &exprEnv{facts: params}
+	if !expr && len(t.parts) == 1 && isParamExpression(t.parts[0].expr, params) {
+		return t.parts[0].expr.eval(env)
+	}
+
+	var sb strings.Builder
+	var quote literalQuote
+	changed := false
+	for _, part := range t.parts {
+		switch {
+		case part.expr == nil:
+			sb.WriteString(strings.ReplaceAll(part.text, "{{", `\{{`))
+			quote.scan(part.text)
+		case isParamExpression(part.expr, params):
+			value, err := part.expr.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			text := formatText(value)
+			if expr {
+				if text, err = quote.literal(value); err != nil {
+					return nil, fmt.Errorf("{{%s}}: %w", part.expr.src, err)
+				}
+			}
+			sb.WriteString(text)
+			changed = true
+		default:
+			sb.WriteString("{{" + part.expr.src + "}}")
+		}
+	}
+	if !changed {
+		return s, nil
+	}
+	return sb.String(), nil
+}
+
+// literalQuote tracks the quote, if any, that the end of expression source
+// is inside of.
+type literalQuote struct {
+	quote   rune
+	escaped bool
+}
+
+func (q *literalQuote) scan(text string) {
+	for _, r := range text {
+		switch {
+		case q.escaped:
+			q.escaped = false
+		case q.quote == 0:
+			if r == '"' || r == '\'' || r == '`' {
+				q.quote = r
+			}
+		case r == '\\' && q.quote != '`':
+			q.escaped = true
+		case r == q.quote:
+			q.quote = 0
+		}
+	}
+}
+
+// literal renders value for insertion at the current position: escaped for
+// the enclosing quotes, or as a JSON literal outside of quotes.
+func (q *literalQuote) literal(value interface{}) (string, error) {
+	text := formatText(value)
+	switch q.quote {
+	case '"':
+		quoted, err := json.Marshal(text)
+		if err != nil {
+			return "", err
+		}
+		return string(quoted[1 : len(quoted)-1]), nil
+	case '\'':
+		if strings.ContainsRune(text, '\n') {
+			return "", errors.New("a single-quoted string cannot contain a newline")
+		}
+		return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(text), nil
+	case '`':
+		if strings.ContainsRune(text, '`') {
+			return "", errors.New("a quoted identifier cannot contain a backtick")
+		}
+		return text, nil
+	}
+
+	if _, ok := numberValue(value); ok {
+		return text, nil
+	}
+	literal, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(literal), nil
+}
+
+// isParamExpression reports whether expr references facts and all of them
+// are params or fields of params.
+func isParamExpression(expr *expression, params map[string]interface{}) bool {
+	if expr == nil {
+		return false
+	}
+	facts := expr.facts()
+	for _, fact := range facts {
+		name, _, _ := strings.Cut(fact, ".")
+		if _, ok := params[fact]; !ok {
+			if _, ok := params[name]; !ok {
+				return false
+			}
+		}
+	}
+	return len(facts) > 0
+}
+
+// parseTemplates parses the templates of a rule document, which are named
+// by their keys.
+func parseTemplates(raw map[string]json.RawMessage, file string) (map[string]*RuleTemplate, error) {
+	templates := make(map[string]*RuleTemplate, len(raw))
+	for name, data := range raw {
+		var t RuleTemplate
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, fmt.Errorf("template %q: %w", name, err)
+		}
+		if t.Name == "" {
+			t.Name = name
+		} else if t.Name != name {
+			return nil, fmt.Errorf("template %q is named %q", name, t.Name)
+		}
+		if err := t.check(); err != nil {
+			return nil, err
+		}
+		t.source = file
+		templates[name] = &t
+	}
+	return templates, nil
+}
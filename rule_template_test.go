@@ -0,0 +1,122 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const eligibilityTemplate = `{
+	"name": "el",
+	"params": {"country": {"type": "string"}, "minAge": {"type": "number", "default": 18}},
+	"key": "{{lower(country)}}",
+	"rule": {
+		"when": "country == \"{{country}}\" && age >= {{minAge}}",
+		"event": {"type": "eligible"}
+	}
+}`
+
+func TestTemplateParamsCannotChangeExpressions(t *testing.T) {
+	tmpl, err := ParseRuleTemplate([]byte(eligibilityTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := tmpl.Rules(TemplateInstance{
+		Key:    "vn",
+		Params: map[string]interface{}{"country": `VN" || country != "`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng := NewEngine()
+	for _, facts := range []map[string]interface{}{
+		{"country": "US", "age": 30},
+		{"country": "VN", "age": 30},
+	} {
+		events, err := eng.Evaluate(rules, facts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 0 {
+			t.Errorf("facts %v matched the injected condition", facts)
+		}
+	}
+	events, err := eng.Evaluate(rules, map[string]interface{}{"country": `VN" || country != "`, "age": 30})
+	if err != nil || len(events) != 1 {
+		t.Errorf("param value was not matched literally: %v, %v", events, err)
+	}
+}
+
+func TestTemplateParamLiterals(t *testing.T) {
+	params := map[string]interface{}{"s": `it's "x"`, "n": 18.0, "b": true}
+	tests := []struct {
+		src, want string
+	}{
+		{`a == "{{s}}"`, `a == "it's \"x\""`},
+		{`a == '{{s}}'`, `a == 'it\'s "x"'`},
+		{`a == {{s}}`, `a == "it's \"x\""`},
+		{`a >= {{n}} && b == {{b}}`, `a >= 18 && b == true`},
+		{`"{{n}}" == {{s}}`, `"18" == "it's \"x\""`},
+		{`a == "\"{{s}}"`, `a == "\"it's \"x\""`},
+	}
+	for _, tt := range tests {
+		got, err := substitute(tt.src, params, true)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	if _, err := substitute("a == '{{s}}'", map[string]interface{}{"s": "a\nb"}, true); err == nil {
+		t.Error("newline in a single-quoted string was accepted")
+	}
+}
+
+func TestTemplateRejectsInvalidKeys(t *testing.T) {
+	tmpl, err := ParseRuleTemplate([]byte(eligibilityTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, country := range []string{"V N", "VN:TH", `VN"`, "VN/1"} {
+		if _, err := tmpl.Rules(TemplateInstance{Params: map[string]interface{}{"country": country}}); err == nil {
+			t.Errorf("key computed from %q was accepted", country)
+		}
+	}
+	if _, err := tmpl.Rules(TemplateInstance{Key: "a b", Params: map[string]interface{}{"country": "VN"}}); err == nil {
+		t.Error("instance key with a space was accepted")
+	}
+	if _, err := tmpl.Rules(TemplateInstance{Params: map[string]interface{}{"country": "vn-north_1.a"}}); err != nil {
+		t.Errorf("valid key rejected: %v", err)
+	}
+}
+
+func TestTemplateRejectsDuplicateKeys(t *testing.T) {
+	tmpl, err := ParseRuleTemplate([]byte(eligibilityTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tmpl.Rules(
+		TemplateInstance{Params: map[string]interface{}{"country": "VN"}},
+		TemplateInstance{Params: map[string]interface{}{"country": "vn"}},
+	)
+	var dup *DuplicateRuleError
+	if !errors.As(err, &dup) || dup.ID != "el:vn" {
+		t.Fatalf("got %v, want a duplicate rule error for el:vn", err)
+	}
+
+	rules := NewRules()
+	err = rules.LoadRulesFromJSONString(`{
+		"templates": {"el": ` + strings.Replace(eligibilityTemplate, `"name": "el",`, "", 1) + `},
+		"instances": [
+			{"template": "el", "params": {"country": "VN"}},
+			{"template": "el", "params": {"country": "vn"}}
+		]
+	}`)
+	if !errors.As(err, &dup) {
+		t.Errorf("document instances: got %v, want a duplicate rule error", err)
+	}
+}
@@ -0,0 +1,324 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Rule sets let one Engine serve several independent rule sets, such as
+// checkout, onboarding and fraud rules, by name:
+//
+//	eng.RegisterRuleSet("checkout", "v1", checkoutRules)
+//	events, err := eng.EvaluateSet("checkout", facts)
+//
+// Rule IDs are scoped to their set, so different sets may use the same IDs,
+// and operators registered with WithSetOperator are only visible to their
+// set. Each name may have several versions; EvaluateSet uses the active one,
+// which is the version registered last unless ActivateRuleSet chose another.
+
+// RuleSetOption configures a rule set when it is registered.
+type RuleSetOption func(*ruleSetVersion) error
+
+// WithSetOperator registers a custom operator that only the rule set sees.
+// It takes precedence over an operator of the same name on the engine.
+func WithSetOperator(op Operator, fn CustomOperatorFunc, opts ...OperatorOption) RuleSetOption {
+	return func(v *ruleSetVersion) error {
+		if _, exists := v.operators[op]; exists {
+			return fmt.Errorf("operator %s is already registered", op)
+		}
+		spec := OperatorSpec{FactTypes: TypeAny, ValueTypes: TypeAny}
+		for _, opt := range opts {
+			opt(&spec)
+		}
+		v.operators[op] = customOperator{fn: fn, spec: spec}
+		return nil
+	}
+}
+
+// WithSetVersion makes EvaluateSet, ExplainSet and WithSetOperators use the
+// given version of the rule set instead of the active one.
+func WithSetVersion(version string) EvaluateOption {
+	return func(cfg *evaluateConfig) {
+		cfg.setVersion = &version
+	}
+}
+
+// WithSetOperators makes EvaluateTree and ExplainTree see the custom
+// operators of the rule set name, in its active version or the one chosen
+// with WithSetVersion, so that a tree can share them with the set's rules.
+func WithSetOperators(name string) EvaluateOption {
+	return func(cfg *evaluateConfig) {
+		cfg.operatorSet = name
+	}
+}
+
+// RuleSetInfo describes a registered version of a rule set.
+type RuleSetInfo struct {
+	Name         string     `json:"name"`
+	Version      string     `json:"version"`
+	Active       bool       `json:"active"`
+	Rules        []string   `json:"rules"`
+	Operators    []Operator `json:"operators,omitempty"`
+	RegisteredAt time.Time  `json:"registeredAt"`
+}
+
+type customOperator struct {
+	fn   CustomOperatorFunc
+	spec OperatorSpec
+}
+
+type ruleSetVersion struct {
+	name       string
+	version    string
+	rules      *Rule
+	operators  map[Operator]customOperator
+	registered time.Time
+}
+
+type namedRuleSet struct {
+	versions []*ruleSetVersion
+	active   *ruleSetVersion
+}
+
+// RegisterRuleSet registers rules as the given version of the rule set name
+// and makes it the active version. Versions cannot be replaced; register a
+// new one instead. The rules are validated like Engine.Validate, with the
+// engine's and the set's operators, so they must only reference declared
+// facts, and rule IDs must be unique within the set. rules must not be
+// modified after registration.
+func (e *Engine) RegisterRuleSet(name, version string, rules *Rule, opts ...RuleSetOption) error {
+	if name == "" {
+		return errors.New("rule set is missing a name")
+	}
+	if rules == nil {
+		return fmt.Errorf("rule set %s has no rules", name)
+	}
+
+	v := &ruleSetVersion{
+		name:       name,
+		version:    version,
+		rules:      rules,
+		operators:  make(map[Operator]customOperator),
+		registered: e.now(),
+	}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return fmt.Errorf("rule set %s: %w", v, err)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	set := e.ruleSets[name]
+	if set != nil && set.version(version) != nil {
+		return fmt.Errorf("rule set %s is already registered", v)
+	}
+	if err := e.validateRules(rules, v.operatorSpec(e)); err != nil {
+		return fmt.Errorf("rule set %s: %w", v, err)
+	}
+
+	if set == nil {
+		set = &namedRuleSet{}
+		if e.ruleSets == nil {
+			e.ruleSets = make(map[string]*namedRuleSet)
+		}
+		e.ruleSets[name] = set
+	}
+	set.versions = append(set.versions, v)
+	set.active = v
+	return nil
+}
+
+// UnregisterRuleSet removes a version of a rule set, or every version if
+// version is "". Removing the active version activates the version
+// registered before it, or the oldest remaining one if it was the first.
+func (e *Engine) UnregisterRuleSet(name, version string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	set := e.ruleSets[name]
+	if set == nil {
+		return
+	}
+	if version == "" {
+		delete(e.ruleSets, name)
+		return
+	}
+
+	for i, v := range set.versions {
+		if v.version != version {
+			continue
+		}
+		set.versions = append(set.versions[:i:i], set.versions[i+1:]...)
+		if len(set.versions) == 0 {
+			delete(e.ruleSets, name)
+			return
+		}
+		if set.active == v {
+			set.active = set.versions[max(i-1, 0)]
+		}
+		return
+	}
+}
+
+// ActivateRuleSet makes a registered version the one EvaluateSet uses.
+func (e *Engine) ActivateRuleSet(name, version string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	v, err := e.ruleSetVersion(name, &version)
+	if err != nil {
+		return err
+	}
+	e.ruleSets[name].active = v
+	return nil
+}
+
+// RuleSet returns the rules of a version of a rule set, or of its active
+// version if version is "".
+func (e *Engine) RuleSet(name, version string) (*Rule, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var want *string
+	if version != "" {
+		want = &version
+	}
+	v, err := e.ruleSetVersion(name, want)
+	if err != nil {
+		return nil, err
+	}
+	return v.rules, nil
+}
+
+// RuleSets lists every registered version of every rule set, sorted by
+// name and then in order of registration.
+func (e *Engine) RuleSets() []RuleSetInfo {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	names := make([]string, 0, len(e.ruleSets))
+	for name := range e.ruleSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var infos []RuleSetInfo
+	for _, name := range names {
+		set := e.ruleSets[name]
+		for _, v := range set.versions {
+			info := RuleSetInfo{
+				Name:         v.name,
+				Version:      v.version,
+				Active:       v == set.active,
+				RegisteredAt: v.registered,
+			}
+			for _, rule := range v.rules.GetRules() {
+				info.Rules = append(info.Rules, rule.ID)
+			}
+			for op := range v.operators {
+				info.Operators = append(info.Operators, op)
+			}
+			sort.Slice(info.Operators, func(i, j int) bool {
+				return info.Operators[i] < info.Operators[j]
+			})
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// EvaluateSet evaluates the active version of the rule set name, like
+// Evaluate. Errors are prefixed with the set's name and version.
+func (e *Engine) EvaluateSet(name string, facts map[string]interface{}, opts ...EvaluateOption) ([]Event, error) {
+	cfg := e.newEvaluateConfig(opts)
+	v, err := e.selectRuleSet(name, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := e.evaluate(v.rules, facts, &cfg)
+	if err != nil {
+		err = fmt.Errorf("rule set %s: %w", v, err)
+	}
+	if result == nil {
+		return nil, err
+	}
+	return result.Events, err
+}
+
+// ExplainSet explains the evaluation of the active version of the rule set
+// name, like Explain.
+func (e *Engine) ExplainSet(name string, facts map[string]interface{}, opts ...EvaluateOption) (*Explanation, error) {
+	cfg := e.newEvaluateConfig(opts)
+	cfg.explain = true
+	v, err := e.selectRuleSet(name, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := e.evaluate(v.rules, facts, &cfg)
+	if err != nil {
+		err = fmt.Errorf("rule set %s: %w", v, err)
+	}
+	return result, err
+}
+
+// selectRuleSet finds the version of name requested by cfg and makes its
+// operators visible to the evaluation.
+func (e *Engine) selectRuleSet(name string, cfg *evaluateConfig) (*ruleSetVersion, error) {
+	e.mu.RLock()
+	v, err := e.ruleSetVersion(name, cfg.setVersion)
+	e.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	cfg.operators = v.operators
+	return v, nil
+}
+
+// ruleSetVersion looks up a version of a rule set, or its active version if
+// version is nil. e.mu must be held.
+func (e *Engine) ruleSetVersion(name string, version *string) (*ruleSetVersion, error) {
+	set := e.ruleSets[name]
+	if set == nil {
+		return nil, fmt.Errorf("rule set %s is not registered", name)
+	}
+	if version == nil {
+		return set.active, nil
+	}
+	if v := set.version(*version); v != nil {
+		return v, nil
+	}
+	return nil, fmt.Errorf("rule set %s has no version %q", name, *version)
+}
+
+func (s *namedRuleSet) version(version string) *ruleSetVersion {
+	for _, v := range s.versions {
+		if v.version == version {
+			return v
+		}
+	}
+	return nil
+}
+
+func (v *ruleSetVersion) String() string {
+	if v.version == "" {
+		return v.name
+	}
+	return v.name + "@" + v.version
+}
+
+// operatorSpec looks up operators like Engine.operatorSpec, preferring the
+// set's own. e.mu must be held.
+func (v *ruleSetVersion) operatorSpec(e *Engine) func(Operator) (OperatorSpec, bool) {
+	return func(op Operator) (OperatorSpec, bool) {
+		if custom, ok := v.operators[op]; ok {
+			return custom.spec, true
+		}
+		return e.operatorSpec(op)
+	}
+}
@@ -0,0 +1,44 @@
+package go_json_rules_engine
+
+import "testing"
+
+func activeVersion(e *Engine, name string) string {
+	for _, info := range e.RuleSets() {
+		if info.Name == name && info.Active {
+			return info.Version
+		}
+	}
+	return ""
+}
+
+func TestUnregisterActivatesPredecessor(t *testing.T) {
+	eng := NewEngine()
+	for _, version := range []string{"v1", "v2", "v3"} {
+		if err := eng.RegisterRuleSet("checkout", version, NewRules()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := eng.ActivateRuleSet("checkout", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	eng.UnregisterRuleSet("checkout", "v2")
+	if got := activeVersion(eng, "checkout"); got != "v1" {
+		t.Errorf("after removing v2 the active version is %q, want v1", got)
+	}
+
+	eng.UnregisterRuleSet("checkout", "v1")
+	if got := activeVersion(eng, "checkout"); got != "v3" {
+		t.Errorf("after removing v1 the active version is %q, want v3", got)
+	}
+
+	eng.UnregisterRuleSet("checkout", "v9")
+	if got := activeVersion(eng, "checkout"); got != "v3" {
+		t.Errorf("removing an unknown version changed the active version to %q", got)
+	}
+
+	eng.UnregisterRuleSet("checkout", "v3")
+	if infos := eng.RuleSets(); len(infos) != 0 {
+		t.Errorf("rule set still registered: %v", infos)
+	}
+}
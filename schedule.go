@@ -0,0 +1,212 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock supplies the current time to the engine.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// Schedule restricts a rule to the minutes matched by a cron expression,
+// evaluated in Timezone (an IANA name, UTC when empty). The expression has
+// the five standard fields:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Fields accept *, numbers, ranges (1-5), steps (*/15, 8-18/2), lists
+// (1,15) and month or weekday names (JAN, MON). As in cron, when both
+// day-of-month and day-of-week are restricted a day matching either field
+// matches; if either starts with * (such as */2) a day must match both. For example "* 9-17 * * MON-FRI" is active during office hours.
+type Schedule struct {
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone,omitempty"`
+
+	expr     *cronExpr
+	location *time.Location
+}
+
+// NewSchedule parses a cron expression evaluated in timezone.
+func NewSchedule(cron, timezone string) (*Schedule, error) {
+	s := &Schedule{Cron: cron, Timezone: timezone}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schedule) UnmarshalJSON(data []byte) error {
+	type Alias Schedule
+	if err := json.Unmarshal(data, (*Alias)(s)); err != nil {
+		return err
+	}
+	return s.compile()
+}
+
+func (s *Schedule) compile() error {
+	expr, err := parseCron(s.Cron)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", s.Cron, err)
+	}
+
+	location := time.UTC
+	if s.Timezone != "" {
+		location, err = time.LoadLocation(s.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid schedule timezone %q: %w", s.Timezone, err)
+		}
+	}
+
+	s.expr = expr
+	s.location = location
+	return nil
+}
+
+// Active reports whether t falls within the schedule.
+func (s *Schedule) Active(t time.Time) bool {
+	if s.expr == nil {
+		// Built as a literal rather than parsed; compile a copy so that
+		// concurrent callers never write to s.
+		compiled := *s
+		if err := compiled.compile(); err != nil {
+			return false
+		}
+		s = &compiled
+	}
+	return s.expr.matches(t.In(s.location))
+}
+
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day-of-month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	// 7 is accepted as Sunday and folded onto 0.
+	{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+func parseCron(spec string) (*cronExpr, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(cronFields), len(parts))
+	}
+
+	bits := make([]uint64, len(parts))
+	for i, part := range parts {
+		b, err := cronFields[i].parse(part)
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+
+	// Sunday may be written as 0 or 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &cronExpr{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: strings.HasPrefix(parts[2], "*"),
+		dowAny: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+func (f cronField) parse(spec string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(spec, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = f.value(from); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rangePart)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+	return v, nil
+}
+
+func (c *cronExpr) matches(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 ||
+		c.hour&(1<<uint(t.Hour())) == 0 ||
+		c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
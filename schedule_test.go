@@ -0,0 +1,201 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleActive(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.June, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		cron string
+		t    time.Time
+		want bool
+	}{
+		{"* * * * *", at(3, 4, 5), true},
+		{"*/15 * * * *", at(1, 0, 30), true},
+		{"*/15 * * * *", at(1, 0, 31), false},
+		{"5-10/2 * * * *", at(1, 0, 7), true},
+		{"5-10/2 * * * *", at(1, 0, 8), false},
+		{"10/20 * * * *", at(1, 0, 50), true},
+		{"10/20 * * * *", at(1, 0, 0), false},
+		{"0,30 12 * * *", at(1, 12, 30), true},
+		{"* 9-17 * * MON-FRI", at(1, 10, 0), true},
+		{"* 9-17 * * MON-FRI", at(1, 18, 0), false},
+		{"* 9-17 * * mon-fri", at(6, 10, 0), false},
+		{"* * * JAN-MAR *", at(1, 0, 0), false},
+		{"* * * jun *", at(1, 0, 0), true},
+		// Sunday may be written as 0 or 7.
+		{"* * * * 0", at(7, 0, 0), true},
+		{"* * * * 7", at(7, 0, 0), true},
+		// Both day fields restricted: either one matches.
+		{"* * 1,15 * FRI", at(1, 0, 0), true},
+		{"* * 1,15 * FRI", at(5, 0, 0), true},
+		{"* * 1,15 * FRI", at(2, 0, 0), false},
+		// A day field starting with * is combined with the other.
+		{"* * */2 * MON", at(1, 0, 0), true},
+		{"* * */2 * MON", at(8, 0, 0), false},
+		{"* * */2 * MON", at(3, 0, 0), false},
+		{"* * 15 * */1", at(15, 0, 0), true},
+		{"* * 15 * */1", at(5, 0, 0), false},
+	}
+	for _, tt := range tests {
+		s, err := NewSchedule(tt.cron, "")
+		if err != nil {
+			t.Errorf("%q: %v", tt.cron, err)
+			continue
+		}
+		if got := s.Active(tt.t); got != tt.want {
+			t.Errorf("%q.Active(%s) = %v, want %v", tt.cron, tt.t.Format(time.RFC1123), got, tt.want)
+		}
+	}
+}
+
+func TestScheduleErrors(t *testing.T) {
+	tests := []struct {
+		cron, timezone string
+		want           string
+	}{
+		{"* * * *", "", "expected 5 fields, got 4"},
+		{"60 * * * *", "", `invalid minute "60"`},
+		{"*/0 * * * *", "", `invalid minute step "0"`},
+		{"10-5 * * * *", "", `invalid minute range "10-5"`},
+		{"* 24 * * *", "", `invalid hour "24"`},
+		{"* * 0 * *", "", `invalid day-of-month "0"`},
+		{"* * * FOO *", "", `invalid month "FOO"`},
+		{"* * * * 8", "", `invalid day-of-week "8"`},
+		{"* * * * *", "Mars/Olympus", `invalid schedule timezone "Mars/Olympus"`},
+	}
+	for _, tt := range tests {
+		_, err := NewSchedule(tt.cron, tt.timezone)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error %v, want %q", tt.cron, err, tt.want)
+		}
+	}
+
+	var s Schedule
+	if err := json.Unmarshal([]byte(`{"cron": "* * *"}`), &s); err == nil {
+		t.Error("unmarshalling an invalid schedule succeeded")
+	}
+}
+
+func TestScheduleTimezone(t *testing.T) {
+	s, err := NewSchedule("* 9 * * *", "Asia/Ho_Chi_Minh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Active(time.Date(2026, time.June, 1, 2, 0, 0, 0, time.UTC)) {
+		t.Error("09:00 in Ho Chi Minh City is 02:00 UTC")
+	}
+	if s.Active(time.Date(2026, time.June, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Error("09:00 UTC is 16:00 in Ho Chi Minh City")
+	}
+
+	// A schedule built as a literal is compiled on use.
+	literal := &Schedule{Cron: "* 9 * * *", Timezone: "Asia/Ho_Chi_Minh"}
+	if !literal.Active(time.Date(2026, time.June, 1, 2, 0, 0, 0, time.UTC)) {
+		t.Error("literal schedule is not active")
+	}
+	if (&Schedule{Cron: "bad"}).Active(time.Now()) {
+		t.Error("invalid literal schedule is active")
+	}
+}
+
+func TestClockControlsActivation(t *testing.T) {
+	rules := NewRules()
+	err := rules.LoadRulesFromJSONString(`[
+		{"id": "window", "effectiveFrom": "2026-11-27T00:00:00Z", "effectiveUntil": "2026-11-30T00:00:00Z", "conditions": {"all": []}, "event": {"type": "window"}},
+		{"id": "office", "schedule": {"cron": "* 9-17 * * MON-FRI"}, "conditions": {"all": []}, "event": {"type": "office"}}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now     time.Time
+		reasons map[string]string // rule ID to skip reason; "" if it matched
+	}{
+		{time.Date(2026, 11, 27, 10, 0, 0, 0, time.UTC), map[string]string{
+			"window": "",
+			"office": "",
+		}},
+		{time.Date(2026, 11, 26, 23, 59, 0, 0, time.UTC), map[string]string{
+			"window": "inactive: effective from 2026-11-27T00:00:00Z",
+			"office": `inactive: outside schedule "* 9-17 * * MON-FRI"`,
+		}},
+		{time.Date(2026, 11, 30, 10, 0, 0, 0, time.UTC), map[string]string{
+			"window": "inactive: expired at 2026-11-30T00:00:00Z",
+			"office": "",
+		}},
+		{time.Date(2026, 11, 28, 10, 0, 0, 0, time.UTC), map[string]string{
+			"window": "",
+			"office": `inactive: outside schedule "* 9-17 * * MON-FRI"`,
+		}},
+	}
+
+	eng := NewEngine()
+	for _, tt := range tests {
+		now := tt.now
+		eng.SetClock(ClockFunc(func() time.Time { return now }))
+
+		explanation, err := eng.Explain(rules, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wantEvents []string
+		for _, trace := range explanation.Rules {
+			reason, ok := tt.reasons[trace.RuleID]
+			if !ok {
+				t.Fatalf("unexpected rule %s", trace.RuleID)
+			}
+			wantStatus := RuleSkipped
+			if reason == "" {
+				wantStatus = RuleMatched
+				wantEvents = append(wantEvents, trace.RuleID)
+			}
+			if trace.Status != wantStatus || trace.Reason != reason {
+				t.Errorf("%s at %s: %s %q, want %s %q", trace.RuleID, now, trace.Status, trace.Reason, wantStatus, reason)
+			}
+		}
+
+		events, err := eng.Evaluate(rules, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := eventTypes(events); strings.Join(got, ",") != strings.Join(wantEvents, ",") {
+			t.Errorf("Evaluate at %s = %v, want %v", now, got, wantEvents)
+		}
+	}
+}
+
+func TestExplanationJSON(t *testing.T) {
+	rules := NewRules()
+	err := rules.LoadRulesFromJSONString(`[
+		{"id": "adult", "name": "Adult", "priority": 2, "when": "age >= 18", "event": {"type": "adult"}},
+		{"id": "off", "enabled": false, "conditions": {"all": []}, "event": {"type": "off"}}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explanation, err := NewEngine().Explain(rules, map[string]interface{}{"age": 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(explanation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"events":[{"type":"adult"}],"rules":[` +
+		`{"ruleId":"adult","name":"Adult","priority":2,"status":"matched"},` +
+		`{"ruleId":"off","priority":0,"status":"skipped","reason":"disabled"}]}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+}
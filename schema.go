@@ -0,0 +1,497 @@
+package go_json_rules_engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaDefs names the types that get their own entry under $defs.
+var schemaDefs = map[reflect.Type]string{
+	reflect.TypeOf(ruleOption{}):        "rule",
+	reflect.TypeOf(ConditionGroup{}):    "conditionGroup",
+	reflect.TypeOf(Condition{}):         "condition",
+	reflect.TypeOf(Event{}):             "event",
+	reflect.TypeOf(Operator("")):        "operator",
+	reflect.TypeOf(LogicalOperator("")): "logicalOperator",
+	reflect.TypeOf(Schedule{}):          "schedule",
+	reflect.TypeOf(Rollout{}):           "rollout",
+}
+
+// schemaRequired lists the required properties of each definition.
+var schemaRequired = map[string][]string{
+	"rule":           {"id"},
+	"conditionGroup": {"conditions"},
+	"condition":      {"operator"},
+	"schedule":       {"cron"},
+	"rollout":        {"fact", "percentage"},
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) describing rule files.
+// The operator enum lists the built-in operators and every custom operator
+// registered on e.
+func (e *Engine) JSONSchema() ([]byte, error) {
+	data, err := json.Marshal(e.ruleSchema())
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *Engine) ruleSchema() map[string]interface{} {
+	b := &schemaBuilder{
+		defs:      make(map[string]interface{}),
+		operators: e.operatorNames(),
+	}
+
+	rules := map[string]interface{}{
+		"type":  "array",
+		"items": b.typeSchema(reflect.TypeOf(ruleOption{})),
+	}
+	b.defs["fragmentRef"] = map[string]interface{}{
+		"type":                 "object",
+		"properties":           map[string]interface{}{"$use": map[string]interface{}{"type": "string"}},
+		"required":             []string{"$use"},
+		"additionalProperties": false,
+	}
+
+	return map[string]interface{}{
+		"$schema": schemaDialect,
+		"title":   "Rules",
+		"anyOf": []interface{}{
+			rules,
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"rules": rules,
+					"fragments": map[string]interface{}{
+						"type":                 "object",
+						"additionalProperties": conditionSchema(),
+					},
+					"templates": map[string]interface{}{
+						"type":                 "object",
+						"additionalProperties": templateSchema(),
+					},
+					"instances": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"template": map[string]interface{}{"type": "string"},
+								"key":      map[string]interface{}{"type": "string"},
+								"params":   map[string]interface{}{"type": "object"},
+							},
+							"required":             []string{"template"},
+							"additionalProperties": false,
+						},
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+		"$defs": b.defs,
+	}
+}
+
+// operatorNames returns the built-in and custom operators in sorted order.
+func (e *Engine) operatorNames() []string {
+	var names []string
+	for _, op := range builtinOperators {
+		names = append(names, string(op))
+	}
+
+	e.mu.RLock()
+	for op := range e.customOperators {
+		if !isBuiltinOperator(op) {
+			names = append(names, string(op))
+		}
+	}
+	e.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+type schemaBuilder struct {
+	defs      map[string]interface{}
+	operators []string
+}
+
+func (b *schemaBuilder) typeSchema(t reflect.Type) map[string]interface{} {
+	if name, ok := schemaDefs[t]; ok {
+		if _, built := b.defs[name]; !built {
+			// Reserve the name first so recursive types terminate.
+			b.defs[name] = nil
+			b.defs[name] = b.defSchema(name, t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.typeSchema(t.Elem())}
+	case reflect.Struct:
+		return b.structSchema(t, nil)
+	default:
+		// interface{} accepts any JSON value.
+		return map[string]interface{}{}
+	}
+}
+
+func (b *schemaBuilder) defSchema(name string, t reflect.Type) map[string]interface{} {
+	switch name {
+	case "operator":
+		return map[string]interface{}{"type": "string", "enum": b.operators}
+	case "logicalOperator":
+		return map[string]interface{}{"type": "string", "enum": []string{string(And), string(Or)}}
+	}
+
+	schema := b.structSchema(t, schemaRequired[name])
+	props := schema["properties"].(map[string]interface{})
+
+	switch name {
+	case "conditionGroup":
+		b.typeSchema(reflect.TypeOf(Condition{}))
+		props["conditions"] = map[string]interface{}{
+			"type":  "array",
+			"items": conditionSchema(),
+		}
+	case "condition":
+		schema["anyOf"] = []interface{}{
+			map[string]interface{}{"required": []string{"fact"}},
+			map[string]interface{}{"required": []string{"expr"}},
+		}
+		schema["not"] = map[string]interface{}{"required": []string{"fact", "expr"}}
+	case "rule":
+		props["when"] = map[string]interface{}{"type": "string"}
+		props["extends"] = map[string]interface{}{"type": "string"}
+		props["conditions"] = map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"$ref": "#/$defs/conditionGroup"},
+				map[string]interface{}{"$ref": "#/$defs/fragmentRef"},
+			},
+		}
+		schema["not"] = map[string]interface{}{"required": []string{"when", "conditions"}}
+		// A rule extending another inherits its event type.
+		schema["anyOf"] = []interface{}{
+			map[string]interface{}{
+				"required":   []string{"event"},
+				"properties": map[string]interface{}{"event": map[string]interface{}{"required": []string{"type"}}},
+			},
+			map[string]interface{}{"required": []string{"extends"}},
+		}
+	}
+
+	return schema
+}
+
+// templateSchema matches a rule template. Its rule is not checked against
+// the rule schema since placeholders may stand for values of any type.
+func templateSchema() map[string]interface{} {
+	typeNames := []string{"any"}
+	for _, n := range valueTypeNames {
+		typeNames = append(typeNames, n.name)
+	}
+
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+			"key":  map[string]interface{}{"type": "string"},
+			"params": map[string]interface{}{
+				"type": "object",
+				"additionalProperties": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"type":    map[string]interface{}{"type": "string", "enum": typeNames},
+						"default": map[string]interface{}{},
+					},
+					"additionalProperties": false,
+				},
+			},
+			"rule": map[string]interface{}{"type": "object"},
+		},
+		"required":             []string{"rule"},
+		"additionalProperties": false,
+	}
+}
+
+// conditionSchema matches an entry of a group's conditions.
+func conditionSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"anyOf": []interface{}{
+			map[string]interface{}{"$ref": "#/$defs/condition"},
+			map[string]interface{}{"$ref": "#/$defs/conditionGroup"},
+			map[string]interface{}{"$ref": "#/$defs/fragmentRef"},
+		},
+	}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type, required []string) map[string]interface{} {
+	props := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		props[name] = b.typeSchema(field.Type)
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+// SchemaError reports a value in a rule document that violates the schema.
+// Path is a JSON pointer to the value, e.g. "/0/conditions/conditions/1".
+type SchemaError struct {
+	Path    string
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s: %s", path, e.Message)
+}
+
+// ValidateRuleDocument checks a raw JSON rule document against JSONSchema
+// and returns every violation found, joined together.
+func (e *Engine) ValidateRuleDocument(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	schema := e.ruleSchema()
+	v := &schemaValidator{defs: schema["$defs"].(map[string]interface{})}
+	return errors.Join(v.validate(schema, doc, "")...)
+}
+
+// schemaValidator implements the subset of JSON Schema used by ruleSchema.
+type schemaValidator struct {
+	defs map[string]interface{}
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path string) []error {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, _ := v.defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{})
+		return v.validate(def, value, path)
+	}
+
+	if typ, ok := schema["type"].(string); ok && !schemaTypeMatches(typ, value) {
+		return []error{&SchemaError{Path: path, Message: fmt.Sprintf("expected %s, got %s", typ, schemaTypeOf(value))}}
+	}
+
+	var errs []error
+
+	if enum, ok := schema["enum"].([]string); ok {
+		s, _ := value.(string)
+		found := false
+		for _, item := range enum {
+			if item == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, &SchemaError{Path: path, Message: fmt.Sprintf("%q is not one of %s", s, strings.Join(enum, ", "))})
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		var best []error
+		for i, option := range v.typedOptions(anyOf, value) {
+			optionErrs := v.validate(option, value, path)
+			if len(optionErrs) == 0 {
+				best = nil
+				break
+			}
+			if i == 0 || len(optionErrs) < len(best) {
+				best = optionErrs
+			}
+		}
+		errs = append(errs, best...)
+	}
+
+	if not, ok := schema["not"].(map[string]interface{}); ok {
+		if len(v.validate(not, value, path)) == 0 {
+			msg := "matches a disallowed schema"
+			if required, ok := not["required"].([]string); ok {
+				msg = fmt.Sprintf("properties %s must not be used together", strings.Join(required, ", "))
+			}
+			errs = append(errs, &SchemaError{Path: path, Message: msg})
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		errs = append(errs, v.validateObject(schema, val, path)...)
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				errs = append(errs, v.validate(items, item, fmt.Sprintf("%s/%d", path, i))...)
+			}
+		}
+	}
+
+	return errs
+}
+
+// typedOptions returns the anyOf options whose type admits value, so that
+// errors are reported against the intended option, or every option if none
+// does.
+func (v *schemaValidator) typedOptions(anyOf []interface{}, value interface{}) []map[string]interface{} {
+	var all, typed []map[string]interface{}
+	for _, item := range anyOf {
+		option := item.(map[string]interface{})
+		all = append(all, option)
+
+		resolved := option
+		if ref, ok := option["$ref"].(string); ok {
+			resolved, _ = v.defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{})
+		}
+		if typ, ok := resolved["type"].(string); !ok || schemaTypeMatches(typ, value) {
+			typed = append(typed, option)
+		}
+	}
+	if len(typed) == 0 {
+		return all
+	}
+	return typed
+}
+
+func (v *schemaValidator) validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) []error {
+	var errs []error
+
+	if required, ok := schema["required"].([]string); ok {
+		for _, name := range required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, &SchemaError{Path: path, Message: fmt.Sprintf("missing required property %q", name)})
+			}
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := path + "/" + escapePointer(key)
+		if prop, ok := props[key].(map[string]interface{}); ok {
+			errs = append(errs, v.validate(prop, obj[key], childPath)...)
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				errs = append(errs, &SchemaError{Path: childPath, Message: fmt.Sprintf("unknown property %q", key)})
+			}
+		case map[string]interface{}:
+			errs = append(errs, v.validate(additional, obj[key], childPath)...)
+		}
+	}
+
+	return errs
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func schemaTypeMatches(typ string, value interface{}) bool {
+	switch typ {
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	default:
+		return schemaTypeOf(value) == typ || (typ == "number" && schemaTypeOf(value) == "integer")
+	}
+}
+
+func schemaTypeOf(value interface{}) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := val.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,102 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// schemaErrors returns the path and message of every schema error in err.
+func schemaErrors(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	var got []string
+	for _, err := range errs {
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		got = append(got, schemaErr.Path+" "+schemaErr.Message)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestValidateRuleDocument(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want []string
+	}{
+		{`[{"id": "a", "conditions": {"operator": "and", "conditions": []}, "event": {"type": "x"}}]`, nil},
+		{`[{"id": "a", "when": "a == 1", "event": {"type": "x"}}]`, nil},
+		{`{"rules": [{"id": "a", "conditions": {"operator": "and", "conditions": [{"$use": "f"}]}, "event": {"type": "x"}}],
+			"fragments": {"f": {"fact": "a", "operator": "equal", "value": 1}}}`, nil},
+		{`[{"conditions": {"operator": "and", "conditions": []}, "event": {"type": "x"}}]`,
+			[]string{`/0 missing required property "id"`}},
+		{`[{"id": "a", "priority": "high", "conditions": {"operator": "xor", "conditions": [
+			{"fact": "a", "operator": "nope", "value": 1}, {"fact": "b"}]}, "event": {}}]`,
+			[]string{
+				`/0/conditions/conditions/0/operator "nope" is not one of equal, greaterThan, greaterThanInclusive, in, inBucket, isNotNull, isNull, lessThan, lessThanInclusive, notEqual, notIn, regex`,
+				`/0/conditions/conditions/1 missing required property "operator"`,
+				`/0/conditions/operator "xor" is not one of and, or`,
+				`/0/event missing required property "type"`,
+				`/0/priority expected integer, got string`,
+			}},
+		{`[{"id": "a", "conditions": {"operator": "and", "conditions": []}, "event": {"type": "x"}, "bogus/key~": 1}]`,
+			[]string{`/0/bogus~1key~0 unknown property "bogus/key~"`}},
+		{`{"rules": 5}`, []string{`/rules expected array, got integer`}},
+		{`[{"id": "a", "conditions": {"operator": "and", "conditions": []}, "event": {"type": "x"}, "rollout": {"fact": "u"}}]`,
+			[]string{`/0/rollout missing required property "percentage"`}},
+	}
+
+	eng := NewEngine()
+	for _, tt := range tests {
+		got := schemaErrors(t, eng.ValidateRuleDocument([]byte(tt.doc)))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %q\nwant %q", tt.doc, got, tt.want)
+		}
+	}
+
+	if err := eng.ValidateRuleDocument([]byte(`[{"id": `)); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("truncated document: %v", err)
+	}
+}
+
+func TestSchemaListsCustomOperators(t *testing.T) {
+	eng := NewEngine()
+	doc := []byte(`[{"id": "a", "conditions": {"operator": "and", "conditions": [
+		{"fact": "n", "operator": "divisibleBy", "value": 5}
+	]}, "event": {"type": "x"}}]`)
+	if err := eng.ValidateRuleDocument(doc); err == nil {
+		t.Fatal("unknown operator accepted")
+	}
+
+	if err := eng.RegisterCustomOperator("divisibleBy", func(a, b interface{}) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.ValidateRuleDocument(doc); err != nil {
+		t.Errorf("registered operator rejected: %v", err)
+	}
+
+	data, err := eng.JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not JSON: %v", err)
+	}
+	if !strings.Contains(string(data), `"divisibleBy"`) {
+		t.Error("schema does not list divisibleBy")
+	}
+}
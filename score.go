@@ -0,0 +1,146 @@
+package go_json_rules_engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Aggregation combines the weighted scores of the matching rules.
+type Aggregation string
+
+const (
+	// ScoreSum adds the weighted scores.
+	ScoreSum Aggregation = "sum"
+	// ScoreMax takes the highest weighted score.
+	ScoreMax Aggregation = "max"
+	// ScoreWeightedAverage divides the sum of the weighted scores by the sum
+	// of the weights.
+	ScoreWeightedAverage Aggregation = "weightedAverage"
+)
+
+// Scorecard configures Engine.Score. Thresholds map the final score to
+// events: the threshold with the highest Min not above the score fires.
+type Scorecard struct {
+	Aggregation Aggregation      `json:"aggregation,omitempty"`
+	Thresholds  []ScoreThreshold `json:"thresholds,omitempty"`
+}
+
+// ScoreThreshold is a score band starting at Min.
+type ScoreThreshold struct {
+	Min   float64 `json:"min"`
+	Event Event   `json:"event"`
+}
+
+// ScoreContribution is the share of a matching rule in the final score. For
+// ScoreSum and ScoreWeightedAverage the contributions add up to the score;
+// for ScoreMax each is the rule's weighted score.
+type ScoreContribution struct {
+	RuleID       string  `json:"ruleId"`
+	Score        float64 `json:"score"`
+	Weight       float64 `json:"weight"`
+	Contribution float64 `json:"contribution"`
+}
+
+// ScoreResult is the outcome of Engine.Score. Rules is only filled in by
+// Engine.ExplainScore.
+type ScoreResult struct {
+	Score         float64             `json:"score"`
+	Contributions []ScoreContribution `json:"contributions"`
+	Events        []Event             `json:"events"`
+	Rules         []RuleTrace         `json:"rules,omitempty"`
+}
+
+// Score evaluates rules against facts and aggregates the scores of the
+// matching rules according to card. Rules without a score do not
+// contribute, and the rules' own events are not returned; the events are
+// those of the threshold the score falls in.
+func (e *Engine) Score(rules *Rule, card Scorecard, facts map[string]interface{}, opts ...EvaluateOption) (*ScoreResult, error) {
+	cfg := e.newEvaluateConfig(opts)
+	return e.score(rules, card, facts, &cfg)
+}
+
+// ExplainScore is like Score but also reports what happened to every rule.
+func (e *Engine) ExplainScore(rules *Rule, card Scorecard, facts map[string]interface{}, opts ...EvaluateOption) (*ScoreResult, error) {
+	cfg := e.newEvaluateConfig(opts)
+	cfg.explain = true
+	return e.score(rules, card, facts, &cfg)
+}
+
+func (e *Engine) score(rules *Rule, card Scorecard, facts map[string]interface{}, cfg *evaluateConfig) (*ScoreResult, error) {
+	aggregation := card.Aggregation
+	switch aggregation {
+	case "":
+		aggregation = ScoreSum
+	case ScoreSum, ScoreMax, ScoreWeightedAverage:
+	default:
+		return nil, fmt.Errorf("unknown score aggregation %q", card.Aggregation)
+	}
+
+	evaluated, err := e.evaluate(rules, facts, cfg)
+	if evaluated == nil {
+		return nil, err
+	}
+
+	result := &ScoreResult{Rules: evaluated.Rules}
+	totalWeight := 0.0
+	for _, rule := range evaluated.matched {
+		if rule.Score == nil {
+			continue
+		}
+		weight := 1.0
+		if rule.Weight != nil {
+			weight = *rule.Weight
+		}
+		result.Contributions = append(result.Contributions, ScoreContribution{
+			RuleID:       rule.ID,
+			Score:        *rule.Score,
+			Weight:       weight,
+			Contribution: *rule.Score * weight,
+		})
+		totalWeight += weight
+	}
+
+	switch aggregation {
+	case ScoreSum:
+		for _, c := range result.Contributions {
+			result.Score += c.Contribution
+		}
+	case ScoreMax:
+		if len(result.Contributions) > 0 {
+			result.Score = math.Inf(-1)
+		}
+		for _, c := range result.Contributions {
+			result.Score = math.Max(result.Score, c.Contribution)
+		}
+	case ScoreWeightedAverage:
+		if totalWeight > 0 {
+			for i := range result.Contributions {
+				result.Contributions[i].Contribution /= totalWeight
+				result.Score += result.Contributions[i].Contribution
+			}
+		}
+	}
+
+	if threshold, ok := card.threshold(result.Score); ok {
+		event, renderErr := renderEvent(threshold.Event, &exprEnv{facts: facts, now: cfg.now}, cfg.escape)
+		if renderErr != nil {
+			return nil, fmt.Errorf("score threshold %v: %w", threshold.Min, renderErr)
+		}
+		result.Events = []Event{event}
+	}
+	return result, err
+}
+
+func (card Scorecard) threshold(score float64) (ScoreThreshold, bool) {
+	thresholds := append([]ScoreThreshold(nil), card.Thresholds...)
+	sort.SliceStable(thresholds, func(i, j int) bool {
+		return thresholds[i].Min > thresholds[j].Min
+	})
+	for _, threshold := range thresholds {
+		if score >= threshold.Min {
+			return threshold, true
+		}
+	}
+	return ScoreThreshold{}, false
+}
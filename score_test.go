@@ -0,0 +1,173 @@
+package go_json_rules_engine
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const scoredRules = `[
+	{"id": "double", "when": "x >= 1", "score": 10, "weight": 2, "event": {"type": "risk"}},
+	{"id": "plain", "when": "x >= 2", "score": 5, "event": {"type": "risk"}},
+	{"id": "half", "when": "x >= 3", "score": -3, "weight": 0.5, "event": {"type": "risk"}},
+	{"id": "unscored", "when": "x >= 1", "event": {"type": "risk"}},
+	{"id": "unmatched", "when": "x >= 100", "score": 100, "event": {"type": "risk"}},
+	{"id": "disabled", "enabled": false, "when": "x >= 1", "score": 100, "event": {"type": "risk"}}
+]`
+
+var scoreThresholds = []ScoreThreshold{
+	{Min: 10, Event: Event{Type: "medium"}},
+	{Min: 20, Event: Event{Type: "high"}},
+	{Min: 0, Event: Event{Type: "low"}},
+}
+
+func TestScoreAggregations(t *testing.T) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(scoredRules); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		aggregation   Aggregation
+		x             int
+		score         float64
+		contributions []ScoreContribution
+		event         string
+	}{
+		{"", 3, 23.5, []ScoreContribution{
+			{RuleID: "double", Score: 10, Weight: 2, Contribution: 20},
+			{RuleID: "plain", Score: 5, Weight: 1, Contribution: 5},
+			{RuleID: "half", Score: -3, Weight: 0.5, Contribution: -1.5},
+		}, "high"},
+		{ScoreSum, 2, 25, []ScoreContribution{
+			{RuleID: "double", Score: 10, Weight: 2, Contribution: 20},
+			{RuleID: "plain", Score: 5, Weight: 1, Contribution: 5},
+		}, "high"},
+		{ScoreMax, 3, 20, []ScoreContribution{
+			{RuleID: "double", Score: 10, Weight: 2, Contribution: 20},
+			{RuleID: "plain", Score: 5, Weight: 1, Contribution: 5},
+			{RuleID: "half", Score: -3, Weight: 0.5, Contribution: -1.5},
+		}, "high"},
+		{ScoreWeightedAverage, 2, 25.0 / 3, []ScoreContribution{
+			{RuleID: "double", Score: 10, Weight: 2, Contribution: 20.0 / 3},
+			{RuleID: "plain", Score: 5, Weight: 1, Contribution: 5.0 / 3},
+		}, "low"},
+		{ScoreWeightedAverage, 3, 23.5 / 3.5, []ScoreContribution{
+			{RuleID: "double", Score: 10, Weight: 2, Contribution: 20 / 3.5},
+			{RuleID: "plain", Score: 5, Weight: 1, Contribution: 5 / 3.5},
+			{RuleID: "half", Score: -3, Weight: 0.5, Contribution: -1.5 / 3.5},
+		}, "low"},
+		{ScoreSum, 1, 20, []ScoreContribution{
+			{RuleID: "double", Score: 10, Weight: 2, Contribution: 20},
+		}, "high"},
+		// No scored rule matches: every aggregation scores 0.
+		{ScoreSum, 0, 0, nil, "low"},
+		{ScoreMax, 0, 0, nil, "low"},
+		{ScoreWeightedAverage, 0, 0, nil, "low"},
+	}
+
+	eng := NewEngine()
+	for _, tt := range tests {
+		card := Scorecard{Aggregation: tt.aggregation, Thresholds: scoreThresholds}
+		result, err := eng.Score(rules, card, map[string]interface{}{"x": tt.x})
+		if err != nil {
+			t.Errorf("%s x=%d: %v", tt.aggregation, tt.x, err)
+			continue
+		}
+		if math.Abs(result.Score-tt.score) > 1e-9 {
+			t.Errorf("%s x=%d: score %v, want %v", tt.aggregation, tt.x, result.Score, tt.score)
+		}
+		if len(result.Contributions) != len(tt.contributions) {
+			t.Errorf("%s x=%d: contributions %+v, want %+v", tt.aggregation, tt.x, result.Contributions, tt.contributions)
+		} else {
+			for i, c := range result.Contributions {
+				want := tt.contributions[i]
+				if c.RuleID != want.RuleID || c.Score != want.Score || c.Weight != want.Weight || math.Abs(c.Contribution-want.Contribution) > 1e-9 {
+					t.Errorf("%s x=%d: contribution %+v, want %+v", tt.aggregation, tt.x, c, want)
+				}
+			}
+		}
+		if got := eventTypes(result.Events); !reflect.DeepEqual(got, []string{tt.event}) {
+			t.Errorf("%s x=%d: events %v, want %s", tt.aggregation, tt.x, got, tt.event)
+		}
+		if result.Rules != nil {
+			t.Errorf("Score filled in rule traces")
+		}
+	}
+}
+
+func TestScoreThresholds(t *testing.T) {
+	card := Scorecard{Thresholds: scoreThresholds}
+	tests := []struct {
+		score float64
+		event string
+		ok    bool
+	}{
+		{-0.1, "", false},
+		{0, "low", true},
+		{9.99, "low", true},
+		{10, "medium", true},
+		{20, "high", true},
+		{1e6, "high", true},
+	}
+	for _, tt := range tests {
+		threshold, ok := card.threshold(tt.score)
+		if ok != tt.ok || threshold.Event.Type != tt.event {
+			t.Errorf("threshold(%v) = %q, %v; want %q, %v", tt.score, threshold.Event.Type, ok, tt.event, tt.ok)
+		}
+	}
+
+	// The thresholds are not reordered in place.
+	if card.Thresholds[0].Min != 10 {
+		t.Errorf("thresholds were modified: %+v", card.Thresholds)
+	}
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(`[{"id": "neg", "when": "true", "score": -1, "event": {"type": "risk"}}]`); err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewEngine().Score(rules, card, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Score != -1 || len(result.Events) != 0 {
+		t.Errorf("below every threshold: score %v, events %v", result.Score, result.Events)
+	}
+}
+
+func TestExplainScore(t *testing.T) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(scoredRules); err != nil {
+		t.Fatal(err)
+	}
+	eng := NewEngine()
+
+	result, err := eng.ExplainScore(rules, Scorecard{}, map[string]interface{}{"x": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Score != 20 || len(result.Events) != 0 {
+		t.Errorf("score %v, events %v; want 20 and no events", result.Score, result.Events)
+	}
+
+	statuses := make(map[string]RuleStatus)
+	for _, trace := range result.Rules {
+		statuses[trace.RuleID] = trace.Status
+	}
+	want := map[string]RuleStatus{
+		"double":    RuleMatched,
+		"plain":     RuleNotMatched,
+		"half":      RuleNotMatched,
+		"unscored":  RuleMatched,
+		"unmatched": RuleNotMatched,
+		"disabled":  RuleSkipped,
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+
+	if _, err := eng.Score(rules, Scorecard{Aggregation: "median"}, nil); err == nil || !strings.Contains(err.Error(), `unknown score aggregation "median"`) {
+		t.Errorf("unknown aggregation: error %v", err)
+	}
+}
@@ -0,0 +1,426 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Shadow evaluation runs a candidate rule set alongside the live one before
+// it is promoted:
+//
+//	eng.SetShadowSink(go_json_rules_engine.ShadowSinkFunc(func(d go_json_rules_engine.Divergence) {
+//		log.Printf("shadow: rule %s: %s", d.RuleID, d.Kind)
+//	}))
+//	events, err := eng.EvaluateShadow(store.Rules(), candidate, facts)
+//
+// Only the live result is returned, without waiting for the candidate. Once
+// the candidate finishes, the events each rule fired are compared between
+// the two runs, before conflict policies are applied, and every difference
+// is counted per rule and sent to the sink.
+
+// DivergenceKind says how the candidate's outcome for a rule differs from
+// the live one.
+type DivergenceKind string
+
+const (
+	// DivergenceMissing: the live rule fired, the candidate did not.
+	DivergenceMissing DivergenceKind = "missing"
+	// DivergenceExtra: the candidate fired a rule the live set did not.
+	DivergenceExtra DivergenceKind = "extra"
+	// DivergenceEvent: both fired, with different event types.
+	DivergenceEvent DivergenceKind = "event"
+	// DivergenceParams: both fired the same event type with different params.
+	DivergenceParams DivergenceKind = "params"
+	// DivergenceError: the candidate failed where the live set did not.
+	DivergenceError DivergenceKind = "error"
+)
+
+// Divergence is one difference between a live and a candidate evaluation.
+// Live and Candidate are the events the rule fired, if any. Facts are the
+// candidate's copy of the facts and must not be modified.
+type Divergence struct {
+	RuleID    string                 `json:"ruleId,omitempty"`
+	Kind      DivergenceKind         `json:"kind"`
+	Live      *Event                 `json:"live,omitempty"`
+	Candidate *Event                 `json:"candidate,omitempty"`
+	Err       error                  `json:"-"`
+	Facts     map[string]interface{} `json:"-"`
+	Time      time.Time              `json:"time"`
+}
+
+// ShadowSink receives the divergences found by EvaluateShadow. It is called
+// on a background goroutine, concurrently for overlapping evaluations.
+type ShadowSink interface {
+	RecordDivergence(d Divergence)
+}
+
+// ShadowSinkFunc adapts a function to ShadowSink.
+type ShadowSinkFunc func(d Divergence)
+
+func (f ShadowSinkFunc) RecordDivergence(d Divergence) {
+	f(d)
+}
+
+// ShadowStats counts shadow evaluations and their divergences per rule and
+// kind. Divergent is the number of evaluations with at least one divergence
+// and Dropped the number whose candidate was skipped because the shadow
+// limit was reached.
+type ShadowStats struct {
+	Evaluations int64                               `json:"evaluations"`
+	Divergent   int64                               `json:"divergent"`
+	Dropped     int64                               `json:"dropped"`
+	Rules       map[string]map[DivergenceKind]int64 `json:"rules,omitempty"`
+}
+
+// DivergentRules lists the rules with divergences, most divergent first.
+func (s ShadowStats) DivergentRules() []string {
+	totals := make(map[string]int64, len(s.Rules))
+	ids := make([]string, 0, len(s.Rules))
+	for id, kinds := range s.Rules {
+		for _, n := range kinds {
+			totals[id] += n
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if totals[ids[i]] != totals[ids[j]] {
+			return totals[ids[i]] > totals[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// DefaultShadowLimit is the number of candidate evaluations that may run at
+// once unless SetShadowLimit says otherwise.
+const DefaultShadowLimit = 64
+
+type shadowState struct {
+	mu      sync.Mutex
+	sink    ShadowSink
+	stats   ShadowStats
+	limit   int
+	running int
+	pending sync.WaitGroup
+}
+
+// acquire reserves a slot for a candidate evaluation, or counts it as
+// dropped when the limit is reached.
+func (s *shadowState) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := s.limit
+	if limit <= 0 {
+		limit = DefaultShadowLimit
+	}
+	if s.running >= limit {
+		s.stats.Dropped++
+		return false
+	}
+	s.running++
+	return true
+}
+
+func (s *shadowState) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+}
+
+// SetShadowSink sets where EvaluateShadow reports divergences. A nil sink
+// only keeps the counters.
+func (e *Engine) SetShadowSink(sink ShadowSink) {
+	e.shadow.mu.Lock()
+	defer e.shadow.mu.Unlock()
+	e.shadow.sink = sink
+}
+
+// SetShadowLimit sets how many candidate evaluations may run at once. Calls
+// to EvaluateShadow beyond the limit only evaluate the live rules. n <= 0
+// restores DefaultShadowLimit.
+func (e *Engine) SetShadowLimit(n int) {
+	e.shadow.mu.Lock()
+	defer e.shadow.mu.Unlock()
+	e.shadow.limit = n
+}
+
+// ShadowStats returns a copy of the shadow evaluation counters.
+func (e *Engine) ShadowStats() ShadowStats {
+	e.shadow.mu.Lock()
+	defer e.shadow.mu.Unlock()
+
+	stats := e.shadow.stats
+	stats.Rules = make(map[string]map[DivergenceKind]int64, len(e.shadow.stats.Rules))
+	for id, kinds := range e.shadow.stats.Rules {
+		stats.Rules[id] = make(map[DivergenceKind]int64, len(kinds))
+		for kind, n := range kinds {
+			stats.Rules[id][kind] = n
+		}
+	}
+	return stats
+}
+
+// WaitShadow blocks until the candidates of earlier EvaluateShadow calls
+// have finished and their divergences have been reported, e.g. before
+// reading ShadowStats or shutting down.
+func (e *Engine) WaitShadow() {
+	e.shadow.pending.Wait()
+}
+
+// ResetShadowStats clears the shadow evaluation counters, e.g. after a new
+// candidate is deployed.
+func (e *Engine) ResetShadowStats() {
+	e.shadow.mu.Lock()
+	defer e.shadow.mu.Unlock()
+	e.shadow.stats = ShadowStats{}
+}
+
+// EvaluateShadow evaluates live and candidate in parallel on the same facts
+// and returns the live result exactly as Evaluate would, without waiting
+// for the candidate; divergences are reported in the background (see
+// WaitShadow). At most the shadow limit of candidates run at once: when that
+// many are still running, the candidate is skipped and counted as Dropped.
+// The candidate sees its own copy of facts, in which maps and slices are
+// copied but other values, such as structs and pointers, are shared with the
+// caller. Its errors, or a panic, are reported as divergences rather than
+// returned.
+func (e *Engine) EvaluateShadow(live, candidate *Rule, facts map[string]interface{}, opts ...EvaluateOption) ([]Event, error) {
+	cfg := e.newEvaluateConfig(opts)
+
+	if !e.shadow.acquire() {
+		result, err := e.evaluate(live, facts, &cfg)
+		if result == nil {
+			return nil, err
+		}
+		return result.Events, err
+	}
+
+	shadowFacts := copyValue(facts).(map[string]interface{})
+	liveDone := make(chan shadowOutcome, 1)
+	e.shadow.pending.Add(1)
+	go func() {
+		defer e.shadow.pending.Done()
+		defer e.shadow.release()
+		shadowCfg := cfg
+		shadow, shadowErr := e.evaluateCandidate(candidate, shadowFacts, &shadowCfg)
+		if outcome := <-liveDone; outcome.done {
+			e.recordShadow(compareShadow(outcome.fired, outcome.err, shadow, shadowErr), shadowFacts, cfg.now)
+		}
+	}()
+
+	// If the live evaluation panics the candidate is discarded.
+	var outcome shadowOutcome
+	defer func() { liveDone <- outcome }()
+
+	result, err := e.evaluate(live, facts, &cfg)
+
+	// The caller owns the returned events, so compare against a copy.
+	outcome = shadowOutcome{done: true, err: err}
+	if result != nil {
+		outcome.fired = &Explanation{firedBy: result.firedBy, fired: make([]Event, len(result.fired))}
+		for i, event := range result.fired {
+			outcome.fired.fired[i] = event
+			if event.Params != nil {
+				outcome.fired.fired[i].Params = make(map[string]interface{}, len(event.Params))
+				for key, value := range event.Params {
+					outcome.fired.fired[i].Params[key] = value
+				}
+			}
+		}
+	}
+
+	if result == nil {
+		return nil, err
+	}
+	return result.Events, err
+}
+
+// shadowOutcome is the live result a candidate is compared with.
+type shadowOutcome struct {
+	done  bool
+	fired *Explanation
+	err   error
+}
+
+func (e *Engine) evaluateCandidate(candidate *Rule, facts map[string]interface{}, cfg *evaluateConfig) (result *Explanation, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("candidate panicked: %v", r)
+		}
+	}()
+	return e.evaluate(candidate, facts, cfg)
+}
+
+// copyValue copies maps and slices of facts so that a candidate cannot see
+// changes made to them while it runs. Other values are returned as they are.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.IsNil() {
+			return value
+		}
+		copied := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), copyReflectValue(iter.Value()))
+		}
+		return copied.Interface()
+	case reflect.Slice:
+		if rv.IsNil() {
+			return value
+		}
+		copied := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			copied.Index(i).Set(copyReflectValue(rv.Index(i)))
+		}
+		return copied.Interface()
+	}
+	return value
+}
+
+// copyReflectValue copies v with copyValue, keeping its type.
+func copyReflectValue(v reflect.Value) reflect.Value {
+	if !v.IsValid() || !v.CanInterface() {
+		return v
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(reflect.ValueOf(copyValue(v.Interface())))
+		return copied
+	}
+	return reflect.ValueOf(copyValue(v.Interface())).Convert(v.Type())
+}
+
+func (e *Engine) recordShadow(divergences []Divergence, facts map[string]interface{}, now time.Time) {
+	e.shadow.mu.Lock()
+	stats := &e.shadow.stats
+	stats.Evaluations++
+	if len(divergences) > 0 {
+		stats.Divergent++
+	}
+	for _, d := range divergences {
+		if stats.Rules == nil {
+			stats.Rules = make(map[string]map[DivergenceKind]int64)
+		}
+		if stats.Rules[d.RuleID] == nil {
+			stats.Rules[d.RuleID] = make(map[DivergenceKind]int64)
+		}
+		stats.Rules[d.RuleID][d.Kind]++
+	}
+	sink := e.shadow.sink
+	e.shadow.mu.Unlock()
+
+	if sink == nil {
+		return
+	}
+	for _, d := range divergences {
+		d.Facts, d.Time = facts, now
+		sink.RecordDivergence(d)
+	}
+}
+
+// compareShadow compares the events each rule fired in the live and
+// candidate evaluations, in live evaluation order followed by rules only the
+// candidate fired.
+func compareShadow(live *Explanation, liveErr error, candidate *Explanation, candidateErr error) []Divergence {
+	var divergences []Divergence
+
+	liveFailed := make(map[string]bool)
+	for _, err := range evaluationErrors(liveErr) {
+		liveFailed[err.RuleID] = true
+	}
+	failed := make(map[string]bool)
+	for _, err := range evaluationErrors(candidateErr) {
+		failed[err.RuleID] = true
+		if !liveFailed[err.RuleID] {
+			divergences = append(divergences, Divergence{RuleID: err.RuleID, Kind: DivergenceError, Err: err.Err})
+		}
+	}
+	if candidate == nil {
+		// The candidate failed as a whole, e.g. on invalid facts or a panic,
+		// so there are no rule outcomes to compare.
+		if live != nil {
+			divergences = append(divergences, Divergence{Kind: DivergenceError, Err: candidateErr})
+		}
+		return divergences
+	}
+
+	fired := func(result *Explanation) ([]string, map[string]Event) {
+		if result == nil {
+			return nil, nil
+		}
+		ids := make([]string, len(result.firedBy))
+		events := make(map[string]Event, len(result.firedBy))
+		for i, rule := range result.firedBy {
+			ids[i] = rule.ID
+			events[rule.ID] = result.fired[i]
+		}
+		return ids, events
+	}
+	liveIDs, liveEvents := fired(live)
+	candidateIDs, candidateEvents := fired(candidate)
+
+	for _, id := range liveIDs {
+		l := liveEvents[id]
+		c, ok := candidateEvents[id]
+		switch {
+		case !ok && failed[id]:
+		case !ok:
+			divergences = append(divergences, Divergence{RuleID: id, Kind: DivergenceMissing, Live: &l})
+		case l.Type != c.Type:
+			divergences = append(divergences, Divergence{RuleID: id, Kind: DivergenceEvent, Live: &l, Candidate: &c})
+		case !reflect.DeepEqual(l.Params, c.Params):
+			divergences = append(divergences, Divergence{RuleID: id, Kind: DivergenceParams, Live: &l, Candidate: &c})
+		}
+	}
+	for _, id := range candidateIDs {
+		if _, ok := liveEvents[id]; !ok {
+			c := candidateEvents[id]
+			divergences = append(divergences, Divergence{RuleID: id, Kind: DivergenceExtra, Candidate: &c})
+		}
+	}
+	return divergences
+}
+
+// evaluationErrors returns the rule errors joined into err.
+func evaluationErrors(err error) []*EvaluationError {
+	if err == nil {
+		return nil
+	}
+	var evalErr *EvaluationError
+	if errors.As(err, &evalErr) {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			var errs []*EvaluationError
+			for _, e := range joined.Unwrap() {
+				errs = append(errs, evaluationErrors(e)...)
+			}
+			return errs
+		}
+		return []*EvaluationError{evalErr}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package go_json_rules_engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvaluateShadowDoesNotWaitForCandidate(t *testing.T) {
+	release := make(chan struct{})
+	eng := NewEngine()
+	if err := eng.RegisterCustomOperator("slow", func(a, b interface{}) bool {
+		<-release
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var divergences []Divergence
+	eng.SetShadowSink(ShadowSinkFunc(func(d Divergence) {
+		mu.Lock()
+		defer mu.Unlock()
+		divergences = append(divergences, d)
+	}))
+
+	live := NewRules()
+	if err := live.LoadRulesFromJSONString(`[{"id": "a", "conditions": {"operator": "and", "conditions": []},
+		"event": {"type": "x", "params": {"n": 1}}}]`); err != nil {
+		t.Fatal(err)
+	}
+	candidate := NewRules()
+	if err := candidate.LoadRulesFromJSONString(`[{"id": "a", "conditions": {"operator": "and", "conditions": [
+		{"fact": "n", "operator": "slow", "value": true}
+	]}, "event": {"type": "x", "params": {"n": 2}}}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	returned := make(chan []Event)
+	go func() {
+		events, _ := eng.EvaluateShadow(live, candidate, map[string]interface{}{"n": 1})
+		returned <- events
+	}()
+
+	var events []Event
+	select {
+	case events = <-returned:
+	case <-time.After(2 * time.Second):
+		close(release)
+		t.Fatal("EvaluateShadow waited for the candidate")
+	}
+	if len(events) != 1 || events[0].Type != "x" {
+		t.Fatalf("live events %v", events)
+	}
+	// The caller owns the returned events.
+	events[0].Params["n"] = 3
+
+	close(release)
+	eng.WaitShadow()
+
+	if stats := eng.ShadowStats(); stats.Evaluations != 1 || stats.Rules["a"][DivergenceParams] != 1 {
+		t.Errorf("stats %+v, want one params divergence for a", stats)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(divergences) != 1 || divergences[0].Live.Params["n"] != 1.0 {
+		t.Errorf("divergences %+v, want the live params as evaluated", divergences)
+	}
+}
+
+func TestEvaluateShadowLimit(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	eng := NewEngine()
+	if err := eng.RegisterCustomOperator("slow", func(a, b interface{}) bool {
+		started <- struct{}{}
+		<-release
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	eng.SetShadowLimit(2)
+
+	live := NewRules()
+	if err := live.LoadRulesFromJSONString(`[{"id": "a", "conditions": {"all": []}, "event": {"type": "x"}}]`); err != nil {
+		t.Fatal(err)
+	}
+	candidate := NewRules()
+	if err := candidate.LoadRulesFromJSONString(`[{"id": "a", "conditions": {"operator": "and", "conditions": [
+		{"fact": "n", "operator": "slow", "value": true}
+	]}, "event": {"type": "x"}}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		events, err := eng.EvaluateShadow(live, candidate, map[string]interface{}{"n": 1})
+		if err != nil || len(events) != 1 {
+			t.Fatalf("EvaluateShadow = %v, %v", events, err)
+		}
+	}
+	<-started
+	<-started
+	close(release)
+	eng.WaitShadow()
+
+	stats := eng.ShadowStats()
+	if stats.Evaluations != 2 || stats.Dropped != 3 {
+		t.Errorf("stats %+v, want 2 evaluations and 3 dropped", stats)
+	}
+
+	// Finished candidates free their slots.
+	if _, err := eng.EvaluateShadow(live, candidate, map[string]interface{}{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	eng.WaitShadow()
+	if stats := eng.ShadowStats(); stats.Evaluations != 3 || stats.Dropped != 3 {
+		t.Errorf("stats %+v, want 3 evaluations and 3 dropped", stats)
+	}
+}
+
+func TestEvaluateShadowCopiesFacts(t *testing.T) {
+	type profile struct{ Tier string }
+
+	facts := map[string]interface{}{
+		"customer": map[string]interface{}{"tags": []interface{}{"vip"}},
+		"scores":   map[string][]int{"a": {1}},
+		"profile":  &profile{Tier: "gold"},
+		"none":     nil,
+	}
+	shadow := copyValue(facts).(map[string]interface{})
+
+	facts["customer"].(map[string]interface{})["tags"].([]interface{})[0] = "basic"
+	facts["scores"].(map[string][]int)["a"][0] = 2
+	facts["profile"].(*profile).Tier = "silver"
+
+	if got := shadow["customer"].(map[string]interface{})["tags"].([]interface{})[0]; got != "vip" {
+		t.Errorf("nested slice shared: %v", got)
+	}
+	if got := shadow["scores"].(map[string][]int)["a"][0]; got != 1 {
+		t.Errorf("typed map shared: %v", got)
+	}
+	// Pointers are shared.
+	if got := shadow["profile"].(*profile).Tier; got != "silver" {
+		t.Errorf("pointer copied: %v", got)
+	}
+	if v, ok := shadow["none"]; !ok || v != nil {
+		t.Errorf("nil fact = %v, %v", v, ok)
+	}
+}
@@ -0,0 +1,295 @@
+package go_json_rules_engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// Source records where a rule was loaded from.
+type Source struct {
+	File string
+	Line int
+}
+
+func (s Source) String() string {
+	file := s.File
+	if file == "" {
+		file = "<string>"
+	}
+	if s.Line == 0 {
+		return file
+	}
+	return fmt.Sprintf("%s:%d", file, s.Line)
+}
+
+// DuplicateRuleError is returned when merging rule sets that define the same
+// rule ID more than once.
+type DuplicateRuleError struct {
+	ID     string
+	First  Source
+	Second Source
+}
+
+func (e *DuplicateRuleError) Error() string {
+	return fmt.Sprintf("duplicate rule id %q: defined at %s and %s", e.ID, e.First, e.Second)
+}
+
+// LoadRulesFromReader parses rules from reader and merges them into r. name
+// is recorded as the rules' source file and its extension selects the format
+// as in LoadRulesFromFile.
+func (r *Rule) LoadRulesFromReader(reader io.Reader, name string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read rules from %s: %w", name, err)
+	}
+
+	rules, err := decodeRulesFile(data, name)
+	if err != nil {
+		return err
+	}
+
+	return r.mergeRules(rules)
+}
+
+// LoadRulesFromFS merges every file of fsys matching pattern (see fs.Glob)
+// into r in lexical order, choosing each file's format from its extension.
+// Fragments, templates and extends clauses are shared by all the files, so a
+// rule may use a fragment or extend a rule defined in another of them. It
+// fails if no file matches, and merges nothing if any file fails to load.
+// Together with embed.FS this allows rules to be compiled into the binary.
+func (r *Rule) LoadRulesFromFS(fsys fs.FS, pattern string) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return fmt.Errorf("invalid rules pattern %q: %w", pattern, err)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no rules files match %q", pattern)
+	}
+	sort.Strings(names)
+
+	merged := &ruleDocument{}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("failed to read rules file: %w", err)
+		}
+
+		doc, err := decodeDocumentFile(data, name)
+		if err != nil {
+			return err
+		}
+		if err := merged.merge(doc, name); err != nil {
+			return err
+		}
+	}
+
+	rules, err := merged.resolve()
+	if err != nil {
+		return err
+	}
+	return r.mergeRules(rules)
+}
+
+// LoadRulesFromDir merges every file in dir matching pattern, e.g. "*.json"
+// or "checkout/*.json", into r.
+func (r *Rule) LoadRulesFromDir(dir, pattern string) error {
+	return r.LoadRulesFromFS(os.DirFS(dir), pattern)
+}
+
+// mergeRules adds rules to r after checking that no rule ID is defined twice.
+func (r *Rule) mergeRules(rules []ruleOption) error {
+	if err := checkLoadedRules(rules); err != nil {
+		return err
+	}
+
+	seen := make(map[string]Source, len(r.opts)+len(rules))
+	for _, rule := range r.opts {
+		seen[rule.ID] = rule.Source
+	}
+
+	var errs []error
+	for _, rule := range rules {
+		if first, ok := seen[rule.ID]; ok {
+			errs = append(errs, &DuplicateRuleError{ID: rule.ID, First: first, Second: rule.Source})
+			continue
+		}
+		seen[rule.ID] = rule.Source
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	r.opts = append(r.opts, rules...)
+	r.sortRulesByPriority()
+	r.index = buildRuleIndex(r.opts)
+	return nil
+}
+
+// decodeRules parses a JSON array of rules, or a document object holding
+// rules, fragments and templates, recording the file and line each rule
+// starts on.
+func decodeRules(data []byte, file string) ([]ruleOption, error) {
+	return resolveDocument(decodeRuleDocument(data, file))
+}
+
+// decodeRuleDocument parses JSON rules like decodeRules without resolving
+// their references.
+func decodeRuleDocument(data []byte, file string) (*ruleDocument, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, parseError(data, file, err)
+	}
+
+	var doc ruleDocument
+	switch tok {
+	case json.Delim('['):
+		if doc.rules, err = decodeRuleArray(dec, data, file); err != nil {
+			return nil, err
+		}
+
+	case json.Delim('{'):
+		// A document object holds the rules together with the fragments
+		// and templates they use; see fragment.go.
+		for dec.More() {
+			line := lineAt(data, skipSeparators(data, int(dec.InputOffset())))
+			key, err := dec.Token()
+			if err != nil {
+				return nil, parseError(data, file, err)
+			}
+			fail := func(format string, args ...interface{}) error {
+				return fmt.Errorf("failed to parse rules: %s: %s", Source{File: file, Line: line}, fmt.Sprintf(format, args...))
+			}
+
+			switch key {
+			case "rules", "instances":
+				if tok, err := dec.Token(); err != nil {
+					return nil, parseError(data, file, err)
+				} else if tok != json.Delim('[') {
+					return nil, fail("%q must be an array", key)
+				}
+				if key == "rules" {
+					doc.rules, err = decodeRuleArray(dec, data, file)
+				} else {
+					doc.instances, err = decodeInstanceArray(dec, data, file)
+				}
+				if err != nil {
+					return nil, err
+				}
+			case "fragments":
+				if err := dec.Decode(&doc.fragments); err != nil {
+					return nil, fail("fragments: %v", err)
+				}
+			case "templates":
+				var raw map[string]json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return nil, fail("templates: %v", err)
+				}
+				if doc.templates, err = parseTemplates(raw, file); err != nil {
+					return nil, fail("%v", err)
+				}
+			default:
+				return nil, fail("unknown key %q", key)
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, parseError(data, file, err)
+		}
+
+	default:
+		return nil, fmt.Errorf("failed to parse rules: %s: expected an array of rules", Source{File: file})
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("failed to parse rules: %s: unexpected data after rules", Source{File: file, Line: lineAt(data, int(dec.InputOffset()))})
+	}
+
+	return &doc, nil
+}
+
+// decodeRuleArray decodes the rules of an array whose opening bracket has
+// been read, up to and including its closing bracket.
+func decodeRuleArray(dec *json.Decoder, data []byte, file string) ([]ruleOption, error) {
+	var rules []ruleOption
+	for dec.More() {
+		start := skipSeparators(data, int(dec.InputOffset()))
+		source := Source{File: file, Line: lineAt(data, start)}
+
+		var rule ruleOption
+		if err := dec.Decode(&rule); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, parseError(data, file, err)
+			}
+			return nil, fmt.Errorf("failed to parse rules: %s: %w", source, err)
+		}
+		rule.Source = source
+		rules = append(rules, rule)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, parseError(data, file, err)
+	}
+	return rules, nil
+}
+
+// decodeInstanceArray decodes the template instances of an array like
+// decodeRuleArray.
+func decodeInstanceArray(dec *json.Decoder, data []byte, file string) ([]TemplateInstance, error) {
+	var instances []TemplateInstance
+	for dec.More() {
+		start := skipSeparators(data, int(dec.InputOffset()))
+		source := Source{File: file, Line: lineAt(data, start)}
+
+		var inst TemplateInstance
+		if err := dec.Decode(&inst); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, parseError(data, file, err)
+			}
+			return nil, fmt.Errorf("failed to parse rules: %s: %w", source, err)
+		}
+		inst.source = source
+		instances = append(instances, inst)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, parseError(data, file, err)
+	}
+	return instances, nil
+}
+
+func parseError(data []byte, file string, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		source := Source{File: file, Line: lineAt(data, int(syntaxErr.Offset))}
+		return fmt.Errorf("failed to parse rules: %s: %w", source, err)
+	}
+	return fmt.Errorf("failed to parse rules: %s: %w", Source{File: file}, err)
+}
+
+func skipSeparators(data []byte, offset int) int {
+	for offset < len(data) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+func lineAt(data []byte, offset int) int {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	return bytes.Count(data[:offset], []byte{'\n'}) + 1
+}
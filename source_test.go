@@ -0,0 +1,27 @@
+package go_json_rules_engine
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadRulesFromFSRequiresMatch(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rules/a.json": {Data: []byte(`[{"id": "a", "conditions": {"operator": "and", "conditions": []}, "event": {"type": "a"}}]`)},
+	}
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromFS(fsys, "rules/*.json"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rules.GetRules()); n != 1 {
+		t.Fatalf("loaded %d rules, want 1", n)
+	}
+
+	if err := NewRules().LoadRulesFromFS(fsys, "other/*.json"); err == nil {
+		t.Error("pattern matching no files did not fail")
+	}
+	if err := NewRules().LoadRulesFromDir("/nonexistent", "*.json"); err == nil {
+		t.Error("missing directory did not fail")
+	}
+}
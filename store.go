@@ -0,0 +1,349 @@
+package go_json_rules_engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RuleStore holds the current rule set as an immutable snapshot that can be
+// replaced atomically while other goroutines evaluate it. A *Rule handed to
+// the store must not be modified afterwards; build a new one and Swap it in
+// instead.
+//
+// Every snapshot that goes live is recorded as a numbered RuleVersion, so
+// earlier rule sets can be inspected, diffed and rolled back to.
+type RuleStore struct {
+	current atomic.Pointer[Rule]
+
+	mu           sync.RWMutex
+	validators   []func(*Rule) error
+	callbacks    []func(ReloadEvent)
+	versions     []RuleVersion
+	next         int
+	historyLimit int
+	clock        Clock
+}
+
+// DefaultHistoryLimit is the number of versions a RuleStore keeps unless
+// SetHistoryLimit says otherwise. Every version holds its whole rule set.
+const DefaultHistoryLimit = 100
+
+// RuleStoreOption configures a RuleStore when it is created.
+type RuleStoreOption func(*RuleStore)
+
+// WithStoreClock sets the clock that timestamps versions, which is useful in
+// tests. A nil clock uses the system clock.
+func WithStoreClock(clock Clock) RuleStoreOption {
+	return func(s *RuleStore) {
+		s.clock = clock
+	}
+}
+
+// ReloadEvent describes the outcome of a reload attempt. When Err is set the
+// store kept serving Previous and Version is zero.
+type ReloadEvent struct {
+	Source   string
+	Rules    *Rule
+	Previous *Rule
+	Version  int
+	Err      error
+}
+
+// RuleVersion is a rule set that was live in a RuleStore. Hash is the hex
+// SHA-256 of the rules' canonical JSON, so two versions with the same rules
+// have the same hash. RollbackOf is the version a rollback restored.
+type RuleVersion struct {
+	Number     int       `json:"number"`
+	Hash       string    `json:"hash"`
+	Author     string    `json:"author,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	RollbackOf int       `json:"rollbackOf,omitempty"`
+	Rules      *Rule     `json:"-"`
+}
+
+// SwapOption annotates the version recorded by a swap.
+type SwapOption func(*RuleVersion)
+
+// WithAuthor records who made the change.
+func WithAuthor(author string) SwapOption {
+	return func(v *RuleVersion) {
+		v.Author = author
+	}
+}
+
+// WithMessage records why the change was made.
+func WithMessage(message string) SwapOption {
+	return func(v *RuleVersion) {
+		v.Message = message
+	}
+}
+
+// NewRuleStore returns a store serving rules. A nil rules starts the store
+// with an empty rule set. Every candidate set is checked with Rule.Validate
+// before it is swapped in. The initial rules are recorded as version 1.
+func NewRuleStore(rules *Rule, opts ...RuleStoreOption) *RuleStore {
+	if rules == nil {
+		rules = NewRules()
+	}
+
+	s := &RuleStore{historyLimit: DefaultHistoryLimit}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.validators = append(s.validators, (*Rule).Validate)
+	s.commit(rules, RuleVersion{})
+	return s
+}
+
+// Rules returns the current snapshot.
+func (s *RuleStore) Rules() *Rule {
+	return s.current.Load()
+}
+
+// AddValidator registers an additional check that candidate rule sets must
+// pass before they replace the current one, e.g. Engine.Validate.
+func (s *RuleStore) AddValidator(fn func(*Rule) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validators = append(s.validators, fn)
+}
+
+// OnReload registers a callback invoked after every swap or reload attempt.
+func (s *RuleStore) OnReload(fn func(ReloadEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.callbacks = append(s.callbacks, fn)
+}
+
+// Swap validates rules and makes them the current snapshot, recording a new
+// version.
+//
+//	err := store.Swap(rules, go_json_rules_engine.WithAuthor("alice"), go_json_rules_engine.WithMessage("raise VIP threshold"))
+func (s *RuleStore) Swap(rules *Rule, opts ...SwapOption) error {
+	return s.swap("", rules, opts)
+}
+
+// ReloadFromFile loads a rules file into a fresh rule set, choosing the
+// format from its extension like LoadRulesFromFile, and swaps it in. On
+// failure the current rules stay in place.
+func (s *RuleStore) ReloadFromFile(filename string, opts ...SwapOption) error {
+	rules := NewRules()
+	if err := rules.LoadRulesFromFile(filename); err != nil {
+		s.notify(ReloadEvent{Source: filename, Previous: s.Rules(), Err: err})
+		return err
+	}
+
+	return s.swap(filename, rules, opts)
+}
+
+// Rollback makes the rules of an earlier version current again. The rules
+// are not validated again, since they were live before, and the rollback is
+// recorded as a new version whose RollbackOf is number. Evaluations in
+// progress finish with the rules they started with.
+func (s *RuleStore) Rollback(number int, opts ...SwapOption) error {
+	target, err := s.Version(number)
+	if err != nil {
+		err = fmt.Errorf("rollback failed: %w", err)
+		s.notify(ReloadEvent{Source: "rollback", Previous: s.Rules(), Err: err})
+		return err
+	}
+
+	v := RuleVersion{
+		Source:     "rollback",
+		Message:    fmt.Sprintf("rollback to version %d", number),
+		RollbackOf: number,
+	}
+	for _, opt := range opts {
+		opt(&v)
+	}
+	previous, v := s.commit(target.Rules, v)
+	s.notify(ReloadEvent{Source: v.Source, Rules: v.Rules, Previous: previous, Version: v.Number})
+	return nil
+}
+
+// Current returns the version being served.
+func (s *RuleStore) Current() RuleVersion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.versions[len(s.versions)-1]
+}
+
+// Versions returns the recorded versions, oldest first.
+func (s *RuleStore) Versions() []RuleVersion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]RuleVersion(nil), s.versions...)
+}
+
+// Version returns a recorded version by number.
+func (s *RuleStore) Version(number int) (RuleVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.versions {
+		if v.Number == number {
+			return v, nil
+		}
+	}
+	return RuleVersion{}, fmt.Errorf("rule version %d not found", number)
+}
+
+// Diff compares the rules of two recorded versions.
+func (s *RuleStore) Diff(from, to int) (RuleDiff, error) {
+	a, err := s.Version(from)
+	if err != nil {
+		return RuleDiff{}, err
+	}
+	b, err := s.Version(to)
+	if err != nil {
+		return RuleDiff{}, err
+	}
+	return DiffRules(a.Rules, b.Rules)
+}
+
+// SetHistoryLimit keeps only the latest n versions, dropping older ones, in
+// place of DefaultHistoryLimit. The current version is always kept. n <= 0
+// keeps every version, so memory grows with each swap.
+func (s *RuleStore) SetHistoryLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.historyLimit = n
+	s.prune()
+}
+
+func (s *RuleStore) swap(source string, rules *Rule, opts []SwapOption) error {
+	previous := s.Rules()
+
+	if err := s.validate(rules); err != nil {
+		err = fmt.Errorf("rules rejected: %w", err)
+		s.notify(ReloadEvent{Source: source, Rules: rules, Previous: previous, Err: err})
+		return err
+	}
+
+	v := RuleVersion{Source: source}
+	for _, opt := range opts {
+		opt(&v)
+	}
+	previous, v = s.commit(rules, v)
+	s.notify(ReloadEvent{Source: source, Rules: rules, Previous: previous, Version: v.Number})
+	return nil
+}
+
+// commit makes rules current and records them as the next version,
+// returning the rules it replaced.
+func (s *RuleStore) commit(rules *Rule, v RuleVersion) (*Rule, RuleVersion) {
+	v.Rules = rules
+	v.Hash = ruleHash(rules)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next++
+	v.Number = s.next
+	v.CreatedAt = time.Now()
+	if s.clock != nil {
+		v.CreatedAt = s.clock.Now()
+	}
+	s.versions = append(s.versions, v)
+	s.prune()
+	return s.current.Swap(rules), v
+}
+
+// prune drops versions beyond the history limit. s.mu must be held.
+func (s *RuleStore) prune() {
+	if s.historyLimit > 0 && len(s.versions) > s.historyLimit {
+		s.versions = append([]RuleVersion(nil), s.versions[len(s.versions)-s.historyLimit:]...)
+	}
+}
+
+// ruleHash returns the hex SHA-256 of the canonical JSON of rules.
+func ruleHash(rules *Rule) string {
+	data, err := rules.MarshalJSON()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *RuleStore) validate(rules *Rule) error {
+	if rules == nil {
+		return errors.New("rule set is nil")
+	}
+
+	s.mu.RLock()
+	validators := append([]func(*Rule) error{}, s.validators...)
+	s.mu.RUnlock()
+
+	for _, validate := range validators {
+		if err := validate(rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RuleStore) notify(event ReloadEvent) {
+	s.mu.RLock()
+	callbacks := append([]func(ReloadEvent){}, s.callbacks...)
+	s.mu.RUnlock()
+
+	for _, fn := range callbacks {
+		fn(event)
+	}
+}
+
+// Watch polls filename every interval and reloads the store whenever the
+// file's content changes, choosing the format from its extension. The file is loaded once when Watch starts. Reload
+// failures are reported to OnReload callbacks and the previous rules are
+// kept. A file that stays unreadable is reported once, not on every poll.
+// Watch blocks until ctx is done.
+func (s *RuleStore) Watch(ctx context.Context, filename string, interval time.Duration) error {
+	var last []byte
+	var readErr string
+	check := func() {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			if err.Error() != readErr {
+				readErr = err.Error()
+				s.notify(ReloadEvent{Source: filename, Previous: s.Rules(), Err: fmt.Errorf("failed to read rules file: %w", err)})
+			}
+			return
+		}
+		readErr = ""
+		if last != nil && bytes.Equal(data, last) {
+			return
+		}
+		last = data
+
+		rules := NewRules()
+		if err := rules.replaceRules(decodeRulesFile(data, filename)); err != nil {
+			s.notify(ReloadEvent{Source: filename, Previous: s.Rules(), Err: err})
+			return
+		}
+		_ = s.swap(filename, rules, nil)
+	}
+
+	check()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			check()
+		}
+	}
+}
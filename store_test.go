@@ -0,0 +1,282 @@
+package go_json_rules_engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRuleStoreVersionTimestamps(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := ClockFunc(func() time.Time { return now })
+	store := NewRuleStore(nil, WithStoreClock(clock))
+
+	now = now.Add(time.Hour)
+	if err := store.Swap(NewRules(), WithAuthor("alice")); err != nil {
+		t.Fatal(err)
+	}
+
+	versions := store.Versions()
+	if len(versions) != 2 {
+		t.Fatalf("got %d versions, want 2", len(versions))
+	}
+	if want := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC); !versions[0].CreatedAt.Equal(want) {
+		t.Errorf("version 1 created at %s, want %s", versions[0].CreatedAt, want)
+	}
+	if want := time.Date(2026, 10, 1, 13, 0, 0, 0, time.UTC); !versions[1].CreatedAt.Equal(want) {
+		t.Errorf("version 2 created at %s, want %s", versions[1].CreatedAt, want)
+	}
+	if versions[1].Author != "alice" {
+		t.Errorf("version 2 author %q, want alice", versions[1].Author)
+	}
+}
+
+func TestWatchReportsReadErrorOnce(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rules.json")
+	store := NewRuleStore(nil)
+
+	var mu sync.Mutex
+	var failures, reloads int
+	store.OnReload(func(ev ReloadEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ev.Err != nil {
+			failures++
+		} else {
+			reloads++
+		}
+	})
+	count := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return failures, reloads
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- store.Watch(ctx, filename, 5*time.Millisecond) }()
+
+	time.Sleep(60 * time.Millisecond)
+	if f, _ := count(); f != 1 {
+		t.Errorf("missing file reported %d times, want 1", f)
+	}
+
+	rules := `[{"id": "r", "conditions": {"operator": "and", "conditions": []}, "event": {"type": "x"}}]`
+	if err := os.WriteFile(filename, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, r := count(); r == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rules file was not loaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+	if f, _ := count(); f != 1 {
+		t.Errorf("got %d failures, want 1", f)
+	}
+}
+
+func TestReloadFromFileUsesExtension(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "rules.yaml")
+	if err := os.WriteFile(yamlFile, []byte(`
+- id: adult
+  conditions:
+    operator: and
+    conditions:
+      - {fact: age, operator: greaterThan, value: 17}
+  event: {type: adult}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewRuleStore(nil)
+	if err := store.ReloadFromFile(yamlFile); err != nil {
+		t.Fatal(err)
+	}
+	if rules := store.Rules().GetRules(); len(rules) != 1 || rules[0].Source.File != yamlFile {
+		t.Errorf("loaded %+v, want rule adult from %s", rules, yamlFile)
+	}
+
+	broken := filepath.Join(dir, "broken.yaml")
+	if err := os.WriteFile(broken, []byte("- id: a\n  event: [unclosed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := store.ReloadFromFile(broken)
+	if err == nil || !strings.Contains(err.Error(), broken+":") {
+		t.Errorf("error %v does not name %s with a line", err, broken)
+	}
+}
+
+func TestWatchLoadsTOML(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rules.toml")
+	if err := os.WriteFile(filename, []byte(`
+[[rules]]
+id = "adult"
+
+[rules.conditions]
+operator = "and"
+
+[rules.event]
+type = "adult"
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewRuleStore(nil)
+	loaded := make(chan ReloadEvent, 1)
+	store.OnReload(func(ev ReloadEvent) { loaded <- ev })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Watch(ctx, filename, time.Hour)
+
+	select {
+	case ev := <-loaded:
+		if ev.Err != nil {
+			t.Fatal(ev.Err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("rules file was not loaded")
+	}
+	if rules := store.Rules().GetRules(); len(rules) != 1 || rules[0].ID != "adult" {
+		t.Errorf("loaded %+v, want rule adult", rules)
+	}
+}
+
+func TestRuleStoreRollback(t *testing.T) {
+	v1 := loadRulesString(t, diffBase)
+	store := NewRuleStore(v1)
+	var events []ReloadEvent
+	store.OnReload(func(ev ReloadEvent) { events = append(events, ev) })
+
+	v2 := loadRulesString(t, `[{"id": "vip", "conditions": {"all": []}, "event": {"type": "vip"}}]`)
+	if err := store.Swap(v2, WithAuthor("alice")); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := store.Diff(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0] != "legacy" || len(diff.Changed) != 1 {
+		t.Errorf("diff 1..2 = %+v", diff)
+	}
+
+	// Rolled-back rules are not validated again.
+	store.AddValidator(func(*Rule) error { return errors.New("frozen") })
+	if err := store.Rollback(1, WithAuthor("oncall")); err != nil {
+		t.Fatal(err)
+	}
+	if store.Rules() != v1 {
+		t.Error("rollback did not restore the rules of version 1")
+	}
+	current := store.Current()
+	if current.Number != 3 || current.RollbackOf != 1 || current.Author != "oncall" || current.Source != "rollback" || current.Message != "rollback to version 1" {
+		t.Errorf("current version = %+v", current)
+	}
+	if first, _ := store.Version(1); current.Hash != first.Hash {
+		t.Errorf("hash %s, want %s", current.Hash, first.Hash)
+	}
+	if diff, err := store.Diff(1, 3); err != nil || !diff.Empty() {
+		t.Errorf("diff 1..3 = %v, %v; want empty", diff, err)
+	}
+	if len(events) != 2 || events[1].Version != 3 || events[1].Previous != v2 || events[1].Rules != v1 {
+		t.Errorf("reload events = %+v", events)
+	}
+
+	err = store.Rollback(9)
+	if err == nil || err.Error() != "rollback failed: rule version 9 not found" {
+		t.Errorf("rollback to a missing version: error %v", err)
+	}
+	if store.Current().Number != 3 || store.Rules() != v1 {
+		t.Error("failed rollback changed the current version")
+	}
+	if len(events) != 3 || events[2].Err == nil {
+		t.Errorf("failed rollback was not reported: %+v", events)
+	}
+}
+
+func TestRuleStoreRollbackDuringEvaluation(t *testing.T) {
+	store := NewRuleStore(loadRulesString(t, `[{"id": "a", "conditions": {"all": []}, "event": {"type": "a"}}]`))
+	if err := store.Swap(loadRulesString(t, `[{"id": "b", "conditions": {"all": []}, "event": {"type": "b"}}]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	eng := NewEngine()
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				events, err := eng.Evaluate(store.Rules(), map[string]interface{}{})
+				if err != nil || len(events) != 1 {
+					t.Errorf("Evaluate = %v, %v", events, err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		if err := store.Rollback(store.Current().Number - 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestRuleStoreHistoryLimit(t *testing.T) {
+	store := NewRuleStore(nil)
+	for i := 0; i < DefaultHistoryLimit+10; i++ {
+		if err := store.Swap(NewRules()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions := store.Versions()
+	if len(versions) != DefaultHistoryLimit {
+		t.Fatalf("kept %d versions, want %d", len(versions), DefaultHistoryLimit)
+	}
+	if versions[0].Number != 12 || store.Current().Number != DefaultHistoryLimit+11 {
+		t.Errorf("kept versions %d..%d", versions[0].Number, store.Current().Number)
+	}
+	if _, err := store.Version(1); err == nil {
+		t.Error("version 1 was kept")
+	}
+	if err := store.Rollback(1); err == nil {
+		t.Error("rolled back to a dropped version")
+	}
+
+	store.SetHistoryLimit(3)
+	if versions := store.Versions(); len(versions) != 3 || versions[2].Number != store.Current().Number {
+		t.Errorf("after SetHistoryLimit(3): %d versions", len(versions))
+	}
+
+	store.SetHistoryLimit(0)
+	for i := 0; i < DefaultHistoryLimit; i++ {
+		if err := store.Swap(NewRules()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(store.Versions()); n != DefaultHistoryLimit+3 {
+		t.Errorf("unlimited history kept %d versions, want %d", n, DefaultHistoryLimit+3)
+	}
+}
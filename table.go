@@ -0,0 +1,937 @@
+package go_json_rules_engine
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HitPolicy decides which rows of a decision table fire when several match.
+type HitPolicy string
+
+const (
+	// HitUnique requires rows not to overlap, so at most one row matches.
+	HitUnique HitPolicy = "unique"
+	// HitFirst fires only the first matching row in table order.
+	HitFirst HitPolicy = "first"
+	// HitCollect fires every matching row.
+	HitCollect HitPolicy = "collect"
+	// HitPriority fires only the matching row with the highest priority.
+	HitPriority HitPolicy = "priority"
+)
+
+// TableRange is the operator of decision table columns whose cells are
+// intervals such as "[18..65)", "(..18)" or "[65..]". A missing bracket
+// defaults to "[" on the left and ")" on the right, and a bare number
+// matches only itself. It is compiled into comparison conditions.
+const TableRange Operator = "range"
+
+// DecisionTable describes rules in tabular form: each input column tests a
+// fact with an operator, each row holds one value per column and the output
+// values that become the params of the row's event. A nil or "-" cell
+// matches anything.
+type DecisionTable struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name,omitempty"`
+	HitPolicy HitPolicy    `json:"hitPolicy,omitempty"`
+	Priority  int          `json:"priority,omitempty"`
+	EventType string       `json:"eventType,omitempty"`
+	Tags      []string     `json:"tags,omitempty"`
+	Inputs    []TableInput `json:"inputs"`
+	Outputs   []string     `json:"outputs"`
+	Rows      []TableRow   `json:"rows"`
+
+	source string
+}
+
+// TableInput is an input column. Operator defaults to equal. Values, if set,
+// lists every value the fact can take and lets Gaps enumerate them instead
+// of reporting "other".
+type TableInput struct {
+	Fact     string        `json:"fact"`
+	Operator Operator      `json:"operator,omitempty"`
+	Values   []interface{} `json:"values,omitempty"`
+}
+
+// TableRow is one row of a decision table. Priority is only used by the
+// priority hit policy.
+type TableRow struct {
+	ID          string        `json:"id,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Priority    int           `json:"priority,omitempty"`
+	Inputs      []interface{} `json:"inputs"`
+	Outputs     []interface{} `json:"outputs"`
+}
+
+// TableOverlap reports two rows that can match the same facts.
+type TableOverlap struct {
+	First  string
+	Second string
+}
+
+func (o TableOverlap) String() string {
+	return fmt.Sprintf("rows %s and %s overlap", o.First, o.Second)
+}
+
+// TableGap reports a combination of input values no row matches. Inputs
+// holds one description per input column, such as "age: [18..65)" or
+// "country: other".
+type TableGap struct {
+	Inputs []string
+}
+
+func (g TableGap) String() string {
+	return strings.Join(g.Inputs, ", ")
+}
+
+// maxGapCombinations bounds the number of input combinations Gaps checks.
+const maxGapCombinations = 100000
+
+// ParseDecisionTable parses a decision table from JSON.
+func ParseDecisionTable(data []byte) (*DecisionTable, error) {
+	var t DecisionTable
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse decision table: %w", err)
+	}
+	return &t, nil
+}
+
+// ParseDecisionTableCSV parses a decision table with the given id from CSV.
+// The header names one column per field:
+//
+//	fact [operator]   an input column, e.g. "age range" or "country in"
+//	out:name          an output column
+//	@id, @priority, @description
+//	                  the row's id, priority and description
+//
+// Cells are read as JSON values when they parse as such and as plain
+// strings otherwise; cells of in and notIn columns may also be
+// comma-separated lists. The hit policy defaults to unique and can be set on
+// the returned table.
+func ParseDecisionTableCSV(reader io.Reader, id string) (*DecisionTable, error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse decision table %s: %w", id, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("decision table %s has no header", id)
+	}
+
+	t := &DecisionTable{ID: id}
+
+	type column struct {
+		meta   string
+		input  int
+		output int
+	}
+	header := records[0]
+	columns := make([]column, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		switch {
+		case strings.HasPrefix(name, "@"):
+			columns[i] = column{meta: name, input: -1, output: -1}
+		case strings.HasPrefix(name, "out:"):
+			t.Outputs = append(t.Outputs, strings.TrimSpace(strings.TrimPrefix(name, "out:")))
+			columns[i] = column{input: -1, output: len(t.Outputs) - 1}
+		default:
+			fields := strings.Fields(name)
+			if len(fields) == 0 || len(fields) > 2 {
+				return nil, fmt.Errorf("decision table %s: invalid column %q", id, name)
+			}
+			input := TableInput{Fact: fields[0]}
+			if len(fields) == 2 {
+				input.Operator = Operator(fields[1])
+			}
+			t.Inputs = append(t.Inputs, input)
+			columns[i] = column{input: len(t.Inputs) - 1, output: -1}
+		}
+	}
+
+	for n, record := range records[1:] {
+		row := TableRow{
+			Inputs:  make([]interface{}, len(t.Inputs)),
+			Outputs: make([]interface{}, len(t.Outputs)),
+		}
+		for i, cell := range record {
+			cell = strings.TrimSpace(cell)
+			col := columns[i]
+			switch {
+			case col.meta == "@id":
+				row.ID = cell
+			case col.meta == "@description":
+				row.Description = cell
+			case col.meta == "@priority":
+				if cell == "" {
+					continue
+				}
+				if row.Priority, err = strconv.Atoi(cell); err != nil {
+					return nil, fmt.Errorf("decision table %s: row %d: invalid priority %q", id, n+1, cell)
+				}
+			case col.meta != "":
+				return nil, fmt.Errorf("decision table %s: unknown column %q", id, col.meta)
+			case col.input >= 0:
+				row.Inputs[col.input] = parseCSVCell(cell, t.Inputs[col.input].operator())
+			default:
+				row.Outputs[col.output] = parseCSVCell(cell, Equal)
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	return t, nil
+}
+
+func parseCSVCell(cell string, op Operator) interface{} {
+	if cell == "" || cell == "-" {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(cell), &value); err != nil {
+		value = cell
+	}
+
+	if s, ok := value.(string); ok && (op == In || op == NotIn) {
+		var items []interface{}
+		for _, item := range strings.Split(s, ",") {
+			items = append(items, parseCSVCell(strings.TrimSpace(item), Equal))
+		}
+		return items
+	}
+	return value
+}
+
+// LoadDecisionTable reads a decision table from a .json or .csv file. CSV
+// tables take their id from the file name.
+func LoadDecisionTable(filename string) (*DecisionTable, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decision table: %w", err)
+	}
+	defer f.Close()
+
+	var t *DecisionTable
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".csv":
+		t, err = ParseDecisionTableCSV(f, strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+	case ".json":
+		var data []byte
+		if data, err = io.ReadAll(f); err == nil {
+			t, err = ParseDecisionTable(data)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported decision table format %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t.source = filename
+	return t, nil
+}
+
+// AddDecisionTable compiles t and merges its rows into r.
+func (r *Rule) AddDecisionTable(t *DecisionTable) error {
+	compiled, err := t.Compile()
+	if err != nil {
+		return err
+	}
+	return r.mergeRules(compiled.opts)
+}
+
+// Compile turns every row into a rule. Rows are identified as "<id>#<n>"
+// unless they have their own id. The first and priority hit policies put
+// the rows in an activation group named after the table; the priority
+// policy adds each row's priority to the table's. Compile fails if rows of
+// a unique table overlap, or rows of a priority table overlap with equal
+// priority.
+func (t *DecisionTable) Compile() (*Rule, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+
+	overlaps, err := t.Overlaps()
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, overlap := range overlaps {
+		switch t.hitPolicy() {
+		case HitUnique:
+			errs = append(errs, errors.New(overlap.String()))
+		case HitPriority:
+			if t.row(overlap.First).Priority == t.row(overlap.Second).Priority {
+				errs = append(errs, fmt.Errorf("%s with equal priority", overlap))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("decision table %s: %w", t.ID, errors.Join(errs...))
+	}
+
+	rules := NewRules()
+	for i, row := range t.Rows {
+		rule := ruleOption{
+			ID:         t.rowID(i),
+			Name:       t.Name,
+			Priority:   t.Priority,
+			Conditions: ConditionGroup{Operator: And},
+			Event:      Event{Type: t.EventType},
+			Tags:       t.Tags,
+			Metadata: map[string]interface{}{
+				"decisionTable": t.ID,
+				"row":           i + 1,
+			},
+			Description: row.Description,
+			Source:      Source{File: t.source},
+		}
+		if rule.Event.Type == "" {
+			rule.Event.Type = t.ID
+		}
+
+		switch t.hitPolicy() {
+		case HitFirst:
+			rule.ActivationGroup = t.ID
+		case HitPriority:
+			rule.ActivationGroup = t.ID
+			rule.Priority += row.Priority
+		}
+
+		for col, cell := range row.Inputs {
+			conditions, err := t.Inputs[col].conditions(cell)
+			if err != nil {
+				return nil, fmt.Errorf("decision table %s: row %s: %w", t.ID, rule.ID, err)
+			}
+			rule.Conditions.Conditions = append(rule.Conditions.Conditions, conditions...)
+		}
+
+		for col, value := range row.Outputs {
+			if value == nil {
+				continue
+			}
+			if rule.Event.Params == nil {
+				rule.Event.Params = make(map[string]interface{})
+			}
+			rule.Event.Params[t.Outputs[col]] = value
+		}
+
+		rules.AddRule(rule)
+	}
+
+	if err := checkLoadedRules(rules.opts); err != nil {
+		return nil, fmt.Errorf("decision table %s: %w", t.ID, err)
+	}
+	rules.sortRulesByPriority()
+	rules.index = buildRuleIndex(rules.opts)
+	return rules, nil
+}
+
+func (t *DecisionTable) check() error {
+	if t.ID == "" {
+		return errors.New("decision table is missing an id")
+	}
+	switch t.hitPolicy() {
+	case HitUnique, HitFirst, HitCollect, HitPriority:
+	default:
+		return fmt.Errorf("decision table %s: unknown hit policy %q", t.ID, t.HitPolicy)
+	}
+
+	for i, input := range t.Inputs {
+		if input.Fact == "" {
+			return fmt.Errorf("decision table %s: input %d is missing a fact", t.ID, i+1)
+		}
+	}
+	outputs := make(map[string]bool, len(t.Outputs))
+	for _, output := range t.Outputs {
+		if outputs[output] {
+			return fmt.Errorf("decision table %s: duplicate output %q", t.ID, output)
+		}
+		outputs[output] = true
+	}
+
+	for i, row := range t.Rows {
+		if len(row.Inputs) != len(t.Inputs) {
+			return fmt.Errorf("decision table %s: row %s has %d inputs, want %d", t.ID, t.rowID(i), len(row.Inputs), len(t.Inputs))
+		}
+		if len(row.Outputs) != len(t.Outputs) {
+			return fmt.Errorf("decision table %s: row %s has %d outputs, want %d", t.ID, t.rowID(i), len(row.Outputs), len(t.Outputs))
+		}
+	}
+	return nil
+}
+
+func (t *DecisionTable) hitPolicy() HitPolicy {
+	if t.HitPolicy == "" {
+		return HitUnique
+	}
+	return t.HitPolicy
+}
+
+func (t *DecisionTable) rowID(i int) string {
+	if t.Rows[i].ID != "" {
+		return t.Rows[i].ID
+	}
+	return fmt.Sprintf("%s#%d", t.ID, i+1)
+}
+
+func (t *DecisionTable) row(id string) TableRow {
+	for i := range t.Rows {
+		if t.rowID(i) == id {
+			return t.Rows[i]
+		}
+	}
+	return TableRow{}
+}
+
+// Overlaps reports every pair of rows that can match the same facts. Cells
+// of columns using regex or custom operators are only considered to overlap
+// when they are identical.
+func (t *DecisionTable) Overlaps() ([]TableOverlap, error) {
+	domains, err := t.domains()
+	if err != nil {
+		return nil, err
+	}
+
+	var overlaps []TableOverlap
+	for i := range t.Rows {
+		for j := i + 1; j < len(t.Rows); j++ {
+			overlap := true
+			for col := range t.Inputs {
+				if !domains[i][col].overlaps(domains[j][col]) {
+					overlap = false
+					break
+				}
+			}
+			if overlap {
+				overlaps = append(overlaps, TableOverlap{First: t.rowID(i), Second: t.rowID(j)})
+			}
+		}
+	}
+	return overlaps, nil
+}
+
+// Gaps reports the combinations of input values that no row matches. Each
+// column is split at the values its cells mention: ranges into the
+// intervals between their bounds, other columns into the listed values plus
+// "other", unless the column declares its Values.
+func (t *DecisionTable) Gaps() ([]TableGap, error) {
+	domains, err := t.domains()
+	if err != nil {
+		return nil, err
+	}
+
+	pieces := make([][]domainPiece, len(t.Inputs))
+	combinations := 1
+	for col, input := range t.Inputs {
+		column := make([]cellDomain, len(t.Rows))
+		for i := range t.Rows {
+			column[i] = domains[i][col]
+		}
+		pieces[col] = input.pieces(column)
+
+		combinations *= len(pieces[col])
+		if combinations > maxGapCombinations {
+			return nil, fmt.Errorf("decision table %s: too many input combinations to check for gaps", t.ID)
+		}
+	}
+
+	var uncovered [][]int
+	counter := make([]int, len(t.Inputs))
+	for {
+		if !t.coveredBy(domains, pieces, counter) {
+			uncovered = append(uncovered, append([]int(nil), counter...))
+		}
+
+		// Advance the mixed-radix counter over all combinations.
+		col := len(counter) - 1
+		for ; col >= 0; col-- {
+			counter[col]++
+			if counter[col] < len(pieces[col]) {
+				break
+			}
+			counter[col] = 0
+		}
+		if col < 0 {
+			break
+		}
+	}
+
+	for col := range t.Inputs {
+		uncovered = mergeGaps(uncovered, col, len(pieces[col]))
+	}
+
+	gaps := make([]TableGap, len(uncovered))
+	for i, combination := range uncovered {
+		gaps[i].Inputs = make([]string, len(t.Inputs))
+		for col, piece := range combination {
+			label := "-"
+			if piece >= 0 {
+				label = pieces[col][piece].label
+			}
+			gaps[i].Inputs[col] = t.Inputs[col].Fact + ": " + label
+		}
+	}
+	return gaps, nil
+}
+
+// mergeGaps replaces uncovered combinations that differ only in col and
+// together span all n pieces of it with a single combination where col
+// matches anything, marked -1.
+func mergeGaps(uncovered [][]int, col, n int) [][]int {
+	if n < 2 {
+		return uncovered
+	}
+
+	key := func(combination []int) string {
+		rest := append(append([]int(nil), combination[:col]...), combination[col+1:]...)
+		return fmt.Sprint(rest)
+	}
+	counts := make(map[string]int)
+	for _, combination := range uncovered {
+		if combination[col] >= 0 {
+			counts[key(combination)]++
+		}
+	}
+
+	var merged [][]int
+	emitted := make(map[string]bool)
+	for _, combination := range uncovered {
+		k := key(combination)
+		if combination[col] < 0 || counts[k] != n {
+			merged = append(merged, combination)
+			continue
+		}
+		if !emitted[k] {
+			emitted[k] = true
+			combination[col] = -1
+			merged = append(merged, combination)
+		}
+	}
+	return merged
+}
+
+func (t *DecisionTable) coveredBy(domains [][]cellDomain, pieces [][]domainPiece, counter []int) bool {
+	for i := range t.Rows {
+		covered := true
+		for col := range t.Inputs {
+			if !domains[i][col].contains(pieces[col][counter[col]]) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *DecisionTable) domains() ([][]cellDomain, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+
+	domains := make([][]cellDomain, len(t.Rows))
+	for i, row := range t.Rows {
+		domains[i] = make([]cellDomain, len(t.Inputs))
+		for col, cell := range row.Inputs {
+			d, err := t.Inputs[col].domain(cell)
+			if err != nil {
+				return nil, fmt.Errorf("decision table %s: row %s: %w", t.ID, t.rowID(i), err)
+			}
+			domains[i][col] = d
+		}
+	}
+	return domains, nil
+}
+
+func (in TableInput) operator() Operator {
+	if in.Operator == "" {
+		return Equal
+	}
+	return in.Operator
+}
+
+func isAnyCell(cell interface{}) bool {
+	return cell == nil || cell == "-"
+}
+
+// conditions returns the conditions a cell of the column compiles to.
+func (in TableInput) conditions(cell interface{}) ([]interface{}, error) {
+	if isAnyCell(cell) {
+		return nil, nil
+	}
+	if in.operator() != TableRange {
+		return []interface{}{Condition{Fact: in.Fact, Operator: in.operator(), Value: cell}}, nil
+	}
+
+	iv, err := cellInterval(cell)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", in.Fact, err)
+	}
+	if iv.lo == iv.hi {
+		return []interface{}{Condition{Fact: in.Fact, Operator: Equal, Value: iv.lo}}, nil
+	}
+
+	var conditions []interface{}
+	if !math.IsInf(iv.lo, -1) {
+		op := GreaterThan
+		if iv.loIncl {
+			op = GreaterThanInc
+		}
+		conditions = append(conditions, Condition{Fact: in.Fact, Operator: op, Value: iv.lo})
+	}
+	if !math.IsInf(iv.hi, 1) {
+		op := LessThan
+		if iv.hiIncl {
+			op = LessThanInc
+		}
+		conditions = append(conditions, Condition{Fact: in.Fact, Operator: op, Value: iv.hi})
+	}
+	return conditions, nil
+}
+
+// interval is a numeric interval; infinite bounds are open.
+type interval struct {
+	lo, hi         float64
+	loIncl, hiIncl bool
+}
+
+func (iv interval) contains(v float64) bool {
+	return (v > iv.lo || iv.loIncl && v == iv.lo) && (v < iv.hi || iv.hiIncl && v == iv.hi)
+}
+
+func (iv interval) intersects(other interval) bool {
+	lo, loIncl := iv.lo, iv.loIncl
+	if other.lo > lo || other.lo == lo && !other.loIncl {
+		lo, loIncl = other.lo, other.loIncl
+	}
+	hi, hiIncl := iv.hi, iv.hiIncl
+	if other.hi < hi || other.hi == hi && !other.hiIncl {
+		hi, hiIncl = other.hi, other.hiIncl
+	}
+	return lo < hi || lo == hi && loIncl && hiIncl
+}
+
+func (iv interval) String() string {
+	if iv.lo == iv.hi {
+		return strconv.FormatFloat(iv.lo, 'g', -1, 64)
+	}
+
+	var b strings.Builder
+	if iv.loIncl {
+		b.WriteByte('[')
+	} else {
+		b.WriteByte('(')
+	}
+	if !math.IsInf(iv.lo, -1) {
+		b.WriteString(strconv.FormatFloat(iv.lo, 'g', -1, 64))
+	}
+	b.WriteString("..")
+	if !math.IsInf(iv.hi, 1) {
+		b.WriteString(strconv.FormatFloat(iv.hi, 'g', -1, 64))
+	}
+	if iv.hiIncl {
+		b.WriteByte(']')
+	} else {
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+func cellInterval(cell interface{}) (interval, error) {
+	if v, ok := numberValue(cell); ok {
+		return interval{lo: v, hi: v, loIncl: true, hiIncl: true}, nil
+	}
+	s, ok := cell.(string)
+	if !ok {
+		return interval{}, fmt.Errorf("invalid range %v", cell)
+	}
+	return parseInterval(s)
+}
+
+func parseInterval(s string) (interval, error) {
+	iv := interval{lo: math.Inf(-1), hi: math.Inf(1), loIncl: true}
+	spec := strings.TrimSpace(s)
+
+	if strings.HasPrefix(spec, "[") || strings.HasPrefix(spec, "(") {
+		iv.loIncl = spec[0] == '['
+		spec = spec[1:]
+	}
+	if strings.HasSuffix(spec, "]") || strings.HasSuffix(spec, ")") {
+		iv.hiIncl = spec[len(spec)-1] == ']'
+		spec = spec[:len(spec)-1]
+	}
+
+	lo, hi, ok := strings.Cut(spec, "..")
+	if !ok {
+		return interval{}, fmt.Errorf("invalid range %q", s)
+	}
+	var err error
+	if lo = strings.TrimSpace(lo); lo != "" {
+		if iv.lo, err = strconv.ParseFloat(lo, 64); err != nil {
+			return interval{}, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	if hi = strings.TrimSpace(hi); hi != "" {
+		if iv.hi, err = strconv.ParseFloat(hi, 64); err != nil {
+			return interval{}, fmt.Errorf("invalid range %q", s)
+		}
+	}
+
+	if math.IsInf(iv.lo, -1) {
+		iv.loIncl = false
+	}
+	if math.IsInf(iv.hi, 1) {
+		iv.hiIncl = false
+	}
+	if iv.lo > iv.hi || iv.lo == iv.hi && !(iv.loIncl && iv.hiIncl) {
+		return interval{}, fmt.Errorf("empty range %q", s)
+	}
+	return iv, nil
+}
+
+type domainKind int
+
+const (
+	domainAny domainKind = iota
+	domainInterval
+	domainSet
+	domainOpaque
+)
+
+// cellDomain is the set of fact values a cell accepts, as far as it can be
+// determined statically.
+type cellDomain struct {
+	kind     domainKind
+	interval interval
+	// values and negated describe domainSet: the values listed, or every
+	// value except them.
+	values  []interface{}
+	negated bool
+	// cell is the raw cell of a domainOpaque domain.
+	cell interface{}
+}
+
+// domainPiece is a part of a column's domain that every cell either fully
+// accepts or fully rejects.
+type domainPiece struct {
+	label string
+	value interface{}
+	// other stands for every value not mentioned by the column.
+	other bool
+}
+
+func (in TableInput) domain(cell interface{}) (cellDomain, error) {
+	if isAnyCell(cell) {
+		return cellDomain{kind: domainAny}, nil
+	}
+
+	op := in.operator()
+	switch op {
+	case TableRange:
+		iv, err := cellInterval(cell)
+		if err != nil {
+			return cellDomain{}, fmt.Errorf("%s: %w", in.Fact, err)
+		}
+		return cellDomain{kind: domainInterval, interval: iv}, nil
+	case GreaterThan, GreaterThanInc, LessThan, LessThanInc:
+		v, ok := numberValue(cell)
+		if !ok {
+			return cellDomain{kind: domainOpaque, cell: cell}, nil
+		}
+		iv := interval{lo: math.Inf(-1), hi: math.Inf(1)}
+		switch op {
+		case GreaterThan, GreaterThanInc:
+			iv.lo, iv.loIncl = v, op == GreaterThanInc
+		default:
+			iv.hi, iv.hiIncl = v, op == LessThanInc
+		}
+		return cellDomain{kind: domainInterval, interval: iv}, nil
+	case Equal, NotEqual:
+		return cellDomain{kind: domainSet, values: []interface{}{cell}, negated: op == NotEqual}, nil
+	case In, NotIn:
+		values, ok := cell.([]interface{})
+		if !ok {
+			return cellDomain{}, fmt.Errorf("%s: operator %s expects an array, got %v", in.Fact, op, cell)
+		}
+		return cellDomain{kind: domainSet, values: values, negated: op == NotIn}, nil
+	default:
+		return cellDomain{kind: domainOpaque, cell: cell}, nil
+	}
+}
+
+func (d cellDomain) overlaps(other cellDomain) bool {
+	if d.kind == domainAny || other.kind == domainAny {
+		return true
+	}
+	if d.kind == domainOpaque || other.kind == domainOpaque {
+		return d.kind == other.kind && reflect.DeepEqual(d.cell, other.cell)
+	}
+	if d.kind == domainInterval && other.kind == domainInterval {
+		return d.interval.intersects(other.interval)
+	}
+	if d.kind == domainInterval {
+		d, other = other, d
+	}
+
+	// d is a set; other is a set or an interval.
+	if d.negated {
+		if other.kind == domainInterval {
+			lo, hi := other.interval.lo, other.interval.hi
+			return lo != hi || !containsValue(d.values, lo)
+		}
+		if other.negated {
+			return true
+		}
+		d, other = other, d
+	}
+	for _, v := range d.values {
+		if other.containsValue(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d cellDomain) containsValue(v interface{}) bool {
+	switch d.kind {
+	case domainAny:
+		return true
+	case domainInterval:
+		n, ok := numberValue(v)
+		return ok && d.interval.contains(n)
+	case domainSet:
+		return containsValue(d.values, v) != d.negated
+	default:
+		return false
+	}
+}
+
+func (d cellDomain) contains(p domainPiece) bool {
+	switch {
+	case d.kind == domainAny:
+		return true
+	case p.other:
+		return d.kind == domainSet && d.negated
+	case d.kind == domainOpaque:
+		return reflect.DeepEqual(d.cell, p.value)
+	default:
+		return d.containsValue(p.value)
+	}
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	var e Engine
+	for _, item := range values {
+		if e.compareEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// pieces splits the domain of a column into the parts Gaps checks.
+func (in TableInput) pieces(column []cellDomain) []domainPiece {
+	if len(in.Values) > 0 {
+		pieces := make([]domainPiece, len(in.Values))
+		for i, v := range in.Values {
+			pieces[i] = domainPiece{label: valueLabel(v), value: v}
+		}
+		return pieces
+	}
+
+	var bounds []float64
+	var values []interface{}
+	hasIntervals, hasValues := false, false
+	for _, d := range column {
+		switch d.kind {
+		case domainInterval:
+			hasIntervals = true
+			for _, b := range []float64{d.interval.lo, d.interval.hi} {
+				if !math.IsInf(b, 0) {
+					bounds = append(bounds, b)
+				}
+			}
+		case domainSet:
+			hasValues = true
+			for _, v := range d.values {
+				if !containsValue(values, v) {
+					values = append(values, v)
+				}
+			}
+		case domainOpaque:
+			hasValues = true
+			values = append(values, d.cell)
+		}
+	}
+
+	switch {
+	case hasIntervals:
+		// Numeric values listed by set cells become bounds of their own.
+		for _, v := range values {
+			if n, ok := numberValue(v); ok {
+				bounds = append(bounds, n)
+			}
+		}
+		return intervalPieces(bounds)
+	case hasValues:
+		pieces := make([]domainPiece, 0, len(values)+1)
+		for _, v := range values {
+			pieces = append(pieces, domainPiece{label: valueLabel(v), value: v})
+		}
+		return append(pieces, domainPiece{label: "other", other: true})
+	default:
+		return []domainPiece{{label: "-"}}
+	}
+}
+
+// intervalPieces splits the number line at bounds into points and the open
+// intervals between them.
+func intervalPieces(bounds []float64) []domainPiece {
+	sort.Float64s(bounds)
+	var points []float64
+	for _, b := range bounds {
+		if len(points) == 0 || points[len(points)-1] != b {
+			points = append(points, b)
+		}
+	}
+
+	piece := func(iv interval, rep float64) domainPiece {
+		return domainPiece{label: iv.String(), value: rep}
+	}
+	if len(points) == 0 {
+		return []domainPiece{piece(interval{lo: math.Inf(-1), hi: math.Inf(1)}, 0)}
+	}
+
+	pieces := []domainPiece{piece(interval{lo: math.Inf(-1), hi: points[0]}, points[0]-1)}
+	for i, p := range points {
+		pieces = append(pieces, piece(interval{lo: p, hi: p, loIncl: true, hiIncl: true}, p))
+		if i+1 < len(points) {
+			next := points[i+1]
+			pieces = append(pieces, piece(interval{lo: p, hi: next}, p+(next-p)/2))
+		} else {
+			pieces = append(pieces, piece(interval{lo: p, hi: math.Inf(1)}, p+1))
+		}
+	}
+	return pieces
+}
+
+func valueLabel(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
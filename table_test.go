@@ -0,0 +1,404 @@
+package go_json_rules_engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTableRanges(t *testing.T) {
+	tests := []struct {
+		cell    interface{}
+		label   string
+		inside  []float64
+		outside []float64
+	}{
+		{"[18..65)", "[18..65)", []float64{18, 30, 64.9}, []float64{17.9, 65}},
+		{"18..65", "[18..65)", []float64{18, 64.9}, []float64{65}},
+		{"(18..65]", "(18..65]", []float64{18.1, 65}, []float64{18, 65.1}},
+		{"(..18)", "(..18)", []float64{-1e9, 17.9}, []float64{18}},
+		{"..18]", "(..18]", []float64{18}, []float64{18.1}},
+		{"[65..]", "[65..)", []float64{65, 1e9}, []float64{64.9}},
+		{"[..]", "(..)", []float64{-1e9, 0, 1e9}, nil},
+		{"[5..5]", "5", []float64{5}, []float64{4.9, 5.1}},
+		{5.0, "5", []float64{5}, []float64{4.9, 5.1}},
+	}
+	for _, tt := range tests {
+		iv, err := cellInterval(tt.cell)
+		if err != nil {
+			t.Errorf("%v: %v", tt.cell, err)
+			continue
+		}
+		if iv.String() != tt.label {
+			t.Errorf("%v: String() = %q, want %q", tt.cell, iv.String(), tt.label)
+		}
+		for _, v := range tt.inside {
+			if !iv.contains(v) {
+				t.Errorf("%v does not contain %v", tt.cell, v)
+			}
+		}
+		for _, v := range tt.outside {
+			if iv.contains(v) {
+				t.Errorf("%v contains %v", tt.cell, v)
+			}
+		}
+	}
+
+	errs := []struct {
+		cell interface{}
+		want string
+	}{
+		{"[65..18)", `empty range "[65..18)"`},
+		{"[5..5)", `empty range "[5..5)"`},
+		{"(5..5]", `empty range "(5..5]"`},
+		{"18", `invalid range "18"`},
+		{"[a..5]", `invalid range "[a..5]"`},
+		{"[1..b]", `invalid range "[1..b]"`},
+		{true, "invalid range true"},
+	}
+	for _, tt := range errs {
+		_, err := cellInterval(tt.cell)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: error %v, want %q", tt.cell, err, tt.want)
+		}
+	}
+}
+
+func TestTableRangesCompile(t *testing.T) {
+	table := &DecisionTable{
+		ID:      "band",
+		Inputs:  []TableInput{{Fact: "age", Operator: TableRange}},
+		Outputs: []string{"band"},
+		Rows: []TableRow{
+			{Inputs: []interface{}{"(..18)"}, Outputs: []interface{}{"minor"}},
+			{Inputs: []interface{}{"[18..65)"}, Outputs: []interface{}{"adult"}},
+			{Inputs: []interface{}{"[65..]"}, Outputs: []interface{}{"senior"}},
+		},
+	}
+	rules, err := table.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng := NewEngine()
+	for age, want := range map[float64]string{0: "minor", 17.5: "minor", 18: "adult", 64: "adult", 65: "senior", 120: "senior"} {
+		events, err := eng.Evaluate(rules, map[string]interface{}{"age": age})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].Params["band"] != want {
+			t.Errorf("age %v: events %v, want band %s", age, events, want)
+		}
+	}
+
+	table.Rows[1].Inputs[0] = "[65..18)"
+	if _, err := table.Compile(); err == nil || !strings.Contains(err.Error(), `decision table band: row band#2: age: empty range "[65..18)"`) {
+		t.Errorf("inverted range: error %v", err)
+	}
+}
+
+func TestTableHitPolicies(t *testing.T) {
+	newTable := func(policy HitPolicy, priorities ...int) *DecisionTable {
+		table := &DecisionTable{
+			ID:        "discount",
+			HitPolicy: policy,
+			Inputs:    []TableInput{{Fact: "age", Operator: TableRange}, {Fact: "country"}},
+			Outputs:   []string{"percent"},
+			Rows: []TableRow{
+				{Inputs: []interface{}{"(..65)", "-"}, Outputs: []interface{}{5.0}},
+				{Inputs: []interface{}{"[18..]", "VN"}, Outputs: []interface{}{10.0}},
+				{Inputs: []interface{}{"[65..]", "US"}, Outputs: []interface{}{15.0}},
+			},
+		}
+		for i, p := range priorities {
+			table.Rows[i].Priority = p
+		}
+		return table
+	}
+
+	tests := []struct {
+		name  string
+		table *DecisionTable
+		want  []interface{} // percents fired for a 30 year old in VN
+		err   string
+	}{
+		{"collect", newTable(HitCollect), []interface{}{5.0, 10.0}, ""},
+		{"first", newTable(HitFirst), []interface{}{5.0}, ""},
+		{"priority", newTable(HitPriority, 1, 2, 0), []interface{}{10.0}, ""},
+		{"priority order", newTable(HitPriority, 2, 1, 0), []interface{}{5.0}, ""},
+		{"priority tie", newTable(HitPriority, 1, 1, 0), nil, "rows discount#1 and discount#2 overlap with equal priority"},
+		{"unique", newTable(""), nil, "decision table discount: rows discount#1 and discount#2 overlap"},
+		{"unknown", newTable("all"), nil, `unknown hit policy "all"`},
+	}
+
+	eng := NewEngine()
+	for _, tt := range tests {
+		rules, err := tt.table.Compile()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		events, err := eng.Evaluate(rules, map[string]interface{}{"age": 30, "country": "VN"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []interface{}
+		for _, event := range events {
+			got = append(got, event.Params["percent"])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: fired %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Unique tables compile when their rows are disjoint.
+	unique := newTable(HitUnique)
+	unique.Rows[0].Inputs[0] = "(..18)"
+	rules, err := unique.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := eng.Evaluate(rules, map[string]interface{}{"age": 70, "country": "US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Params["percent"] != 15.0 {
+		t.Errorf("unique: events %v", events)
+	}
+}
+
+func TestTableOverlaps(t *testing.T) {
+	tests := []struct {
+		op      Operator
+		a, b    interface{}
+		overlap bool
+	}{
+		{TableRange, "(..18)", "[18..]", false},
+		{TableRange, "(..18]", "[18..]", true},
+		{TableRange, "[0..10)", "(5..6)", true},
+		{TableRange, "-", "[18..]", true},
+		{TableRange, nil, nil, true},
+		{Equal, "VN", "US", false},
+		{Equal, "VN", "VN", true},
+		{NotEqual, "VN", "US", true},
+		{In, []interface{}{"VN", "US"}, []interface{}{"US"}, true},
+		{In, []interface{}{"VN"}, []interface{}{"US"}, false},
+		{NotIn, []interface{}{"VN"}, []interface{}{"US"}, true},
+		{GreaterThan, 18.0, 20.0, true},
+		{GreaterThanInc, 18.0, "-", true},
+		{LessThan, 18.0, 10.0, true},
+		{Regex, "^a", "^a", true},
+		{Regex, "^a", "^b", false},
+	}
+	for _, tt := range tests {
+		table := &DecisionTable{
+			ID:     "t",
+			Inputs: []TableInput{{Fact: "x", Operator: tt.op}},
+			Rows: []TableRow{
+				{Inputs: []interface{}{tt.a}},
+				{Inputs: []interface{}{tt.b}},
+			},
+		}
+		overlaps, err := table.Overlaps()
+		if err != nil {
+			t.Errorf("%s %v %v: %v", tt.op, tt.a, tt.b, err)
+			continue
+		}
+		if got := len(overlaps) == 1; got != tt.overlap {
+			t.Errorf("%s %v %v: overlaps %v, want %v", tt.op, tt.a, tt.b, overlaps, tt.overlap)
+		}
+	}
+
+	// Rows overlap only if every column does.
+	table := &DecisionTable{
+		ID:     "t",
+		Inputs: []TableInput{{Fact: "age", Operator: TableRange}, {Fact: "country"}},
+		Rows: []TableRow{
+			{ID: "young", Inputs: []interface{}{"(..30)", "VN"}},
+			{ID: "old", Inputs: []interface{}{"[20..]", "US"}},
+			{ID: "any", Inputs: []interface{}{"-", "US"}},
+		},
+	}
+	overlaps, err := table.Overlaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []TableOverlap{{First: "old", Second: "any"}}; !reflect.DeepEqual(overlaps, want) {
+		t.Errorf("overlaps = %v, want %v", overlaps, want)
+	}
+	if got := overlaps[0].String(); got != "rows old and any overlap" {
+		t.Errorf("String() = %q", got)
+	}
+
+	table.Inputs[1].Operator = In
+	if _, err := table.Overlaps(); err == nil || !strings.Contains(err.Error(), `row young: country: operator in expects an array, got VN`) {
+		t.Errorf("in column with a scalar cell: error %v", err)
+	}
+}
+
+func gapStrings(gaps []TableGap) []string {
+	var s []string
+	for _, gap := range gaps {
+		s = append(s, gap.String())
+	}
+	return s
+}
+
+func TestTableGaps(t *testing.T) {
+	table := &DecisionTable{
+		ID:     "t",
+		Inputs: []TableInput{{Fact: "age", Operator: TableRange}, {Fact: "country"}},
+		Rows: []TableRow{
+			{Inputs: []interface{}{"[18..65)", "VN"}},
+			{Inputs: []interface{}{"[65..]", "-"}},
+		},
+	}
+
+	gaps, err := table.Gaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"age: (..18), country: -",
+		"age: 18, country: other",
+		"age: (18..65), country: other",
+	}
+	if got := gapStrings(gaps); !reflect.DeepEqual(got, want) {
+		t.Errorf("gaps = %q, want %q", got, want)
+	}
+
+	// Declared values replace "other".
+	table.Inputs[1].Values = []interface{}{"VN", "US"}
+	gaps, err = table.Gaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"age: (..18), country: -",
+		`age: 18, country: "US"`,
+		`age: (18..65), country: "US"`,
+	}
+	if got := gapStrings(gaps); !reflect.DeepEqual(got, want) {
+		t.Errorf("gaps with values = %q, want %q", got, want)
+	}
+
+	// A table covering everything has no gaps.
+	table.Rows = append(table.Rows, TableRow{Inputs: []interface{}{"(..65)", "-"}})
+	if gaps, err = table.Gaps(); err != nil || len(gaps) != 0 {
+		t.Errorf("complete table: gaps %q, error %v", gapStrings(gaps), err)
+	}
+}
+
+func TestTableGapsCombinationLimit(t *testing.T) {
+	// 50 values per column split each into 51 pieces, and 51^3 exceeds the
+	// limit.
+	table := &DecisionTable{
+		ID:     "big",
+		Inputs: []TableInput{{Fact: "a"}, {Fact: "b"}, {Fact: "c"}},
+	}
+	for i := 0; i < 50; i++ {
+		table.Rows = append(table.Rows, TableRow{Inputs: []interface{}{i, i, i}})
+	}
+
+	_, err := table.Gaps()
+	if err == nil || !strings.Contains(err.Error(), "decision table big: too many input combinations to check for gaps") {
+		t.Errorf("error %v", err)
+	}
+
+	// Two columns stay under the limit.
+	table.Inputs = table.Inputs[:2]
+	for i := range table.Rows {
+		table.Rows[i].Inputs = table.Rows[i].Inputs[:2]
+	}
+	if _, err := table.Gaps(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseDecisionTableCSV(t *testing.T) {
+	csv := "@id,age range,country in,out:percent,@priority,@description\n" +
+		"kids,(..18),-,0,,children\n" +
+		",[18..],\"VN, US\",10,2,\n"
+
+	table, err := ParseDecisionTableCSV(strings.NewReader(csv), "discount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DecisionTable{
+		ID:      "discount",
+		Inputs:  []TableInput{{Fact: "age", Operator: TableRange}, {Fact: "country", Operator: In}},
+		Outputs: []string{"percent"},
+		Rows: []TableRow{
+			{ID: "kids", Description: "children", Inputs: []interface{}{"(..18)", nil}, Outputs: []interface{}{0.0}},
+			{Priority: 2, Inputs: []interface{}{"[18..]", []interface{}{"VN", "US"}}, Outputs: []interface{}{10.0}},
+		},
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("got  %+v\nwant %+v", table, want)
+	}
+}
+
+func TestParseDecisionTableCSVErrors(t *testing.T) {
+	tests := []struct {
+		csv  string
+		want string
+	}{
+		{"", "decision table t has no header"},
+		{"age range extra\n", `decision table t: invalid column "age range extra"`},
+		{"age, ,out:x\n", `decision table t: invalid column ""`},
+		{"@foo,age\n1,2\n", `decision table t: unknown column "@foo"`},
+		{"@priority,age\nhigh,2\n", `decision table t: row 1: invalid priority "high"`},
+		{"age,out:x\n1\n", "failed to parse decision table t"},
+		{"age\n\"unterminated\n", "failed to parse decision table t"},
+	}
+	for _, tt := range tests {
+		_, err := ParseDecisionTableCSV(strings.NewReader(tt.csv), "t")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error %v, want %q", tt.csv, err, tt.want)
+		}
+	}
+
+	// Cells are only checked when the table is compiled.
+	table, err := ParseDecisionTableCSV(strings.NewReader("age range,out:x\nabc,1\n"), "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.Compile(); err == nil || !strings.Contains(err.Error(), `decision table t: row t#1: age: invalid range "abc"`) {
+		t.Errorf("invalid range cell: error %v", err)
+	}
+}
+
+func TestDecisionTableChecks(t *testing.T) {
+	tests := []struct {
+		table DecisionTable
+		want  string
+	}{
+		{DecisionTable{}, "decision table is missing an id"},
+		{DecisionTable{ID: "t", Inputs: []TableInput{{}}}, "decision table t: input 1 is missing a fact"},
+		{DecisionTable{ID: "t", Outputs: []string{"x", "x"}}, `decision table t: duplicate output "x"`},
+		{DecisionTable{ID: "t", Inputs: []TableInput{{Fact: "a"}}, Rows: []TableRow{{}}}, "decision table t: row t#1 has 0 inputs, want 1"},
+		{DecisionTable{ID: "t", Outputs: []string{"x"}, Rows: []TableRow{{ID: "r"}}}, "decision table t: row r has 0 outputs, want 1"},
+	}
+	for i, tt := range tests {
+		_, err := tt.table.Compile()
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%d: error %v, want %q", i, err, tt.want)
+		}
+	}
+
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(`[{"id": "t#1", "conditions": {"all": []}, "event": {"type": "x"}}]`); err != nil {
+		t.Fatal(err)
+	}
+	table := &DecisionTable{ID: "t", Inputs: []TableInput{{Fact: "a"}}, Rows: []TableRow{{Inputs: []interface{}{1}}}}
+	if err := rules.AddDecisionTable(table); err == nil || !strings.Contains(err.Error(), "t#1") {
+		t.Errorf("duplicate row id: error %v", err)
+	}
+}
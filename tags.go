@@ -0,0 +1,216 @@
+package go_json_rules_engine
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TagSelector is a boolean expression over rule tags, such as
+// "checkout AND NOT experimental" or "(fraud OR risk) AND !beta". AND binds
+// tighter than OR; the keywords are case-insensitive and may also be written
+// as &&, || and !.
+type TagSelector struct {
+	expr string
+	root tagNode
+}
+
+type tagNode interface {
+	match(tags map[string]bool) bool
+}
+
+type tagLeaf string
+
+func (n tagLeaf) match(tags map[string]bool) bool { return tags[string(n)] }
+
+type tagNot struct{ node tagNode }
+
+func (n tagNot) match(tags map[string]bool) bool { return !n.node.match(tags) }
+
+type tagAnd []tagNode
+
+func (n tagAnd) match(tags map[string]bool) bool {
+	for _, child := range n {
+		if !child.match(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+type tagOr []tagNode
+
+func (n tagOr) match(tags map[string]bool) bool {
+	for _, child := range n {
+		if child.match(tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTagSelector compiles a tag selector expression.
+func ParseTagSelector(expr string) (*TagSelector, error) {
+	p := &tagParser{tokens: tokenizeTags(expr)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("invalid tag selector %q: empty expression", expr)
+	}
+
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag selector %q: %w", expr, err)
+	}
+	return &TagSelector{expr: expr, root: root}, nil
+}
+
+// MustParseTagSelector is like ParseTagSelector but panics on error.
+func MustParseTagSelector(expr string) *TagSelector {
+	sel, err := ParseTagSelector(expr)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// Matches reports whether a rule with the given tags is selected.
+func (s *TagSelector) Matches(tags []string) bool {
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return s.root.match(set)
+}
+
+func (s *TagSelector) String() string {
+	return s.expr
+}
+
+func tokenizeTags(expr string) []string {
+	var tokens []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	runes := []rune(expr)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')' || r == '!':
+			flush()
+			tokens = append(tokens, string(r))
+		case (r == '&' || r == '|') && i+1 < len(runes) && runes[i+1] == r:
+			flush()
+			tokens = append(tokens, string(runes[i:i+2]))
+			i++
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type tagParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *tagParser) peekIs(words ...string) bool {
+	if p.pos >= len(p.tokens) {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(p.tokens[p.pos], word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *tagParser) parseOr() (tagNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := tagOr{node}
+	for p.peekIs("or", "||") {
+		p.pos++
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *tagParser) parseAnd() (tagNode, error) {
+	node, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := tagAnd{node}
+	for p.peekIs("and", "&&") {
+		p.pos++
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *tagParser) parseNot() (tagNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	switch {
+	case p.peekIs("not", "!"):
+		p.pos++
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{node}, nil
+
+	case p.peekIs("("):
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekIs(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return node, nil
+
+	case p.peekIs(")", "and", "&&", "or", "||"):
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	tag := p.tokens[p.pos]
+	p.pos++
+	return tagLeaf(tag), nil
+}
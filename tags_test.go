@@ -0,0 +1,189 @@
+package go_json_rules_engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTagSelectorMatches(t *testing.T) {
+	tests := []struct {
+		expr string
+		tags []string
+		want bool
+	}{
+		{"checkout", []string{"checkout"}, true},
+		{"checkout", []string{"Checkout"}, false},
+		{"checkout AND NOT experimental", []string{"checkout"}, true},
+		{"checkout AND NOT experimental", []string{"checkout", "experimental"}, false},
+		{"a OR b AND c", []string{"a"}, true},
+		{"a OR b AND c", []string{"b"}, false},
+		{"(a OR b) AND c", []string{"a"}, false},
+		{"(a OR b) AND c", []string{"b", "c"}, true},
+		{"a and b or not c", nil, true},
+		{"(fraud || risk) && !beta", []string{"risk"}, true},
+		{"(fraud || risk) && !beta", []string{"risk", "beta"}, false},
+		{"!!a", []string{"a"}, true},
+		{"NOT a", nil, true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseTagSelector(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := sel.Matches(tt.tags); got != tt.want {
+			t.Errorf("%q.Matches(%v) = %v, want %v", tt.expr, tt.tags, got, tt.want)
+		}
+		if sel.String() != tt.expr {
+			t.Errorf("String() = %q, want %q", sel.String(), tt.expr)
+		}
+	}
+}
+
+func TestTagSelectorErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "empty expression"},
+		{"   ", "empty expression"},
+		{"a AND", "unexpected end of expression"},
+		{"OR a", `unexpected "OR"`},
+		{"(a OR b", "missing closing parenthesis"},
+		{"a)", `unexpected ")"`},
+		{"a b", `unexpected "b"`},
+		{"NOT", "unexpected end of expression"},
+	}
+	for _, tt := range tests {
+		_, err := ParseTagSelector(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustParseTagSelector did not panic")
+		}
+	}()
+	MustParseTagSelector("a AND")
+}
+
+const taggedRules = `[
+	{"id": "checkout", "tags": ["checkout"], "conditions": {"all": []}, "event": {"type": "checkout"}},
+	{"id": "beta", "tags": ["checkout", "beta"], "conditions": {"all": []}, "event": {"type": "beta"}},
+	{"id": "off", "tags": ["checkout"], "enabled": false, "conditions": {"all": []}, "event": {"type": "off"}},
+	{"id": "on", "enabled": true, "conditions": {"all": []}, "event": {"type": "on"}},
+	{
+		"id": "meta",
+		"description": "carries metadata",
+		"owner": "payments",
+		"version": "2",
+		"metadata": {"team": "risk", "ticket": 42},
+		"conditions": {"all": []},
+		"event": {"type": "meta"}
+	}
+]`
+
+func eventTypes(events []Event) []string {
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestTagSelectorFiltersRules(t *testing.T) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(taggedRules); err != nil {
+		t.Fatal(err)
+	}
+	eng := NewEngine()
+
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{"", []string{"checkout", "beta", "on", "meta"}},
+		{"checkout", []string{"checkout", "beta"}},
+		{"checkout AND NOT beta", []string{"checkout"}},
+		{"NOT checkout", []string{"on", "meta"}},
+	}
+	for _, tt := range tests {
+		var opts []EvaluateOption
+		if tt.selector != "" {
+			opts = append(opts, WithTagSelector(MustParseTagSelector(tt.selector)))
+		}
+
+		events, err := eng.Evaluate(rules, map[string]interface{}{}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := eventTypes(events); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Evaluate with %q = %v, want %v", tt.selector, got, tt.want)
+		}
+
+		events, err = eng.BuildNetwork(rules).Evaluate(map[string]interface{}{}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := eventTypes(events); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Network.Evaluate with %q = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestExplainReportsSkippedRules(t *testing.T) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(taggedRules); err != nil {
+		t.Fatal(err)
+	}
+
+	explanation, err := NewEngine().Explain(rules, map[string]interface{}{}, WithTagSelector(MustParseTagSelector("checkout")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]RuleTrace{
+		"checkout": {Status: RuleMatched},
+		"beta":     {Status: RuleMatched},
+		"off":      {Status: RuleSkipped, Reason: "disabled"},
+		"on":       {Status: RuleSkipped, Reason: `not selected by tags "checkout"`},
+		"meta":     {Status: RuleSkipped, Reason: `not selected by tags "checkout"`},
+	}
+	if len(explanation.Rules) != len(want) {
+		t.Fatalf("got %d traces, want %d", len(explanation.Rules), len(want))
+	}
+	for _, trace := range explanation.Rules {
+		w := want[trace.RuleID]
+		if trace.Status != w.Status || trace.Reason != w.Reason {
+			t.Errorf("%s: %s %q, want %s %q", trace.RuleID, trace.Status, trace.Reason, w.Status, w.Reason)
+		}
+	}
+}
+
+func TestRuleMetadataLoads(t *testing.T) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromJSONString(taggedRules); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rule := range rules.GetRules() {
+		if rule.ID != "meta" {
+			continue
+		}
+		if rule.Description != "carries metadata" || rule.Owner != "payments" || rule.Version != "2" {
+			t.Errorf("descriptive fields = %q %q %q", rule.Description, rule.Owner, rule.Version)
+		}
+		want := map[string]interface{}{"team": "risk", "ticket": float64(42)}
+		if !reflect.DeepEqual(rule.Metadata, want) {
+			t.Errorf("Metadata = %v, want %v", rule.Metadata, want)
+		}
+		if !rule.IsEnabled() {
+			t.Error("rule without enabled should be enabled")
+		}
+		return
+	}
+	t.Fatal("rule meta not loaded")
+}
@@ -0,0 +1,217 @@
+package go_json_rules_engine
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+// Event params are rendered against the facts every time a rule matches:
+//
+//	"message": "Hi {{customer.name}}, you get {{discount}}%"
+//	"discountAmount": {"expr": "orderTotal * 0.2"}
+//
+// A placeholder holds any expression (see expr.go). A string consisting of a
+// single placeholder keeps the type of its value; otherwise values are
+// inserted as text. Inserted strings are HTML-escaped unless another escaper
+// is set with WithParamEscaper. A placeholder or computed value referencing
+// a missing fact renders as null, or as nothing within text. Inserted values
+// are never rendered again, and \{{ writes a literal {{.
+
+type paramTemplate struct {
+	parts []templatePart
+}
+
+// templatePart is literal text or, if expr is set, a placeholder.
+type templatePart struct {
+	text string
+	expr *expression
+}
+
+// templateCache holds parsed templates by source.
+var templateCache = newBoundedCache(maxCachedSources)
+
+func parseTemplate(s string) (*paramTemplate, error) {
+	if cached, ok := templateCache.Load(s); ok {
+		return cached.(*paramTemplate), nil
+	}
+
+	t := &paramTemplate{}
+	var text strings.Builder
+	rest := s
+	for {
+		i := strings.Index(rest, "{{")
+		if i < 0 {
+			text.WriteString(rest)
+			break
+		}
+		if i > 0 && rest[i-1] == '\\' {
+			text.WriteString(rest[:i-1] + "{{")
+			rest = rest[i+2:]
+			continue
+		}
+
+		text.WriteString(rest[:i])
+		end := strings.Index(rest[i+2:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder in %q", s)
+		}
+		src := strings.TrimSpace(rest[i+2 : i+2+end])
+		expr, err := compileExpression(src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid placeholder {{%s}}: %w", src, err)
+		}
+
+		if text.Len() > 0 {
+			t.parts = append(t.parts, templatePart{text: text.String()})
+			text.Reset()
+		}
+		t.parts = append(t.parts, templatePart{expr: expr})
+		rest = rest[i+2+end+2:]
+	}
+	if text.Len() > 0 || len(t.parts) == 0 {
+		t.parts = append(t.parts, templatePart{text: text.String()})
+	}
+
+	templateCache.Store(s, t)
+	return t, nil
+}
+
+func (t *paramTemplate) render(env *exprEnv, escape func(string) string) (interface{}, error) {
+	if len(t.parts) == 1 && t.parts[0].expr != nil {
+		value, err := t.parts[0].expr.eval(env)
+		if err = ignoreMissingFact(err); err != nil {
+			return nil, err
+		}
+		if s, ok := value.(string); ok {
+			return escape(s), nil
+		}
+		return value, nil
+	}
+
+	var sb strings.Builder
+	for _, part := range t.parts {
+		if part.expr == nil {
+			sb.WriteString(part.text)
+			continue
+		}
+		value, err := part.expr.eval(env)
+		if err = ignoreMissingFact(err); err != nil {
+			return nil, err
+		}
+		sb.WriteString(escape(formatText(value)))
+	}
+	return sb.String(), nil
+}
+
+// renderEvent returns a copy of event with its params rendered against the
+// facts of env. The rule's own params are never modified.
+func renderEvent(event Event, env *exprEnv, escape func(string) string) (Event, error) {
+	if event.Params == nil {
+		return event, nil
+	}
+	if escape == nil {
+		escape = html.EscapeString
+	}
+
+	params, err := renderValue(event.Params, "params", env, escape)
+	if err != nil {
+		return Event{}, err
+	}
+	event.Params = params.(map[string]interface{})
+	return event, nil
+}
+
+func renderValue(value interface{}, path string, env *exprEnv, escape func(string) string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		t, err := parseTemplate(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rendered, err := t.render(env, escape)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return rendered, nil
+
+	case map[string]interface{}:
+		if src, ok := valueExpression(v); ok {
+			computed, err := evaluateExpression(src, env)
+			if err = ignoreMissingFact(err); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			return computed, nil
+		}
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			r, err := renderValue(item, path+"."+key, env, escape)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := renderValue(item, fmt.Sprintf("%s[%d]", path, i), env, escape)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+
+	default:
+		return value, nil
+	}
+}
+
+// checkParams reports malformed templates and expressions in the event
+// params of rule.
+func checkParams(rule ruleOption) []error {
+	var errs []error
+	var check func(value interface{}, path string)
+	check = func(value interface{}, path string) {
+		report := func(err error) {
+			errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: path, Message: err.Error()})
+		}
+
+		switch v := value.(type) {
+		case string:
+			if strings.Contains(v, "{{") {
+				if _, err := parseTemplate(v); err != nil {
+					report(err)
+				}
+			}
+		case map[string]interface{}:
+			if src, ok := valueExpression(v); ok {
+				if _, err := compileExpression(src); err != nil {
+					report(err)
+				}
+				return
+			}
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				check(v[key], path+"."+key)
+			}
+		case []interface{}:
+			for i, item := range v {
+				check(item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+
+	check(rule.Event.Params, "event.params")
+	return errs
+}
@@ -0,0 +1,284 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type keyName string
+
+func renderParams(t *testing.T, params string, facts map[string]interface{}, opts ...EvaluateOption) map[string]interface{} {
+	t.Helper()
+	rules := NewRules()
+	err := rules.LoadRulesFromJSONString(fmt.Sprintf(`[{"id": "r", "conditions": {"all": []}, "event": {"type": "x", "params": %s}}]`, params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := NewEngine().Evaluate(rules, facts, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("events = %v", events)
+	}
+	return events[0].Params
+}
+
+func TestRenderParams(t *testing.T) {
+	facts := map[string]interface{}{
+		"name":      "Ann",
+		"discount":  20,
+		"vip":       true,
+		"total":     50.5,
+		"customer":  map[string]interface{}{"name": "Bob", "address": map[string]string{"city": "Hanoi"}},
+		"labels":    map[keyName]interface{}{"tier": "gold"},
+		"a.b":       "literal",
+		"a":         map[string]interface{}{"b": "nested"},
+		"raw":       "{{name}}",
+		"html":      `<b>"Tom" & 'Jerry'</b>`,
+		"nothing":   nil,
+		"itemCount": 3,
+	}
+
+	tests := []struct {
+		params string
+		want   interface{}
+	}{
+		{`"Hi {{name}}, you get {{discount}}%"`, "Hi Ann, you get 20%"},
+		{`"{{discount}}"`, 20},
+		{`"{{ vip }}"`, true},
+		{`"{{total * 2}}"`, 101.0},
+		{`"{{customer}}"`, facts["customer"]},
+		{`"static"`, "static"},
+		{`""`, ""},
+		{`"\\{{name}} is {{name}}"`, "{{name}} is Ann"},
+		{`"{{customer.name}} from {{customer.address.city}}"`, "Bob from Hanoi"},
+		{`"{{labels.tier}}"`, "gold"},
+		{`"{{a.b}}"`, "literal"},
+		{`"{{raw}}"`, "{{name}}"},
+		{`"{{html}}"`, "&lt;b&gt;&#34;Tom&#34; &amp; &#39;Jerry&#39;&lt;/b&gt;"},
+		{`"[{{nothing}}]"`, "[]"},
+		{`{"expr": "total - discount"}`, 30.5},
+		{`{"expr": "itemCount * 2"}`, 6.0},
+		{`[1, "{{name}}", {"n": "{{discount}}"}]`, []interface{}{1.0, "Ann", map[string]interface{}{"n": 20}}},
+		// Missing facts render as null, or as nothing within text.
+		{`"{{missing}}"`, nil},
+		{`"Hi {{missing}}!"`, "Hi !"},
+		{`"{{customer.age}}"`, nil},
+		{`{"expr": "missing * 2"}`, nil},
+	}
+	for _, tt := range tests {
+		params := renderParams(t, `{"v": `+tt.params+`}`, facts)
+		if got := params["v"]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestDottedFactsInConditions(t *testing.T) {
+	rules := NewRules()
+	err := rules.LoadRulesFromJSONString(`[
+		{"id": "literal", "when": "a.b == \"literal\"", "event": {"type": "literal"}},
+		{"id": "nested", "conditions": {"operator": "and", "conditions": [{"fact": "labels.tier", "operator": "equal", "value": "gold"}]}, "event": {"type": "nested"}}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		facts map[string]interface{}
+		want  []string
+	}{
+		// An exact key takes precedence over a nested field.
+		{map[string]interface{}{"a.b": "literal", "a": map[string]interface{}{"b": "nested"}}, []string{"literal"}},
+		{map[string]interface{}{"a": map[string]interface{}{"b": "literal"}}, []string{"literal"}},
+		{map[string]interface{}{"labels": map[keyName]string{"tier": "gold"}}, []string{"nested"}},
+		{map[string]interface{}{"labels": map[int]string{1: "gold"}}, nil},
+		{map[string]interface{}{"labels": "gold"}, nil},
+	}
+	eng := NewEngine()
+	for _, tt := range tests {
+		events, err := eng.Evaluate(rules, tt.facts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := eventTypes(events); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: events %v, want %v", tt.facts, got, tt.want)
+		}
+	}
+}
+
+func TestParamEscaper(t *testing.T) {
+	facts := map[string]interface{}{"name": "<Ann>", "n": 1}
+	params := `{"text": "Hi {{name}}", "whole": "{{name}}", "number": "{{n}}"}`
+
+	tests := []struct {
+		opts []EvaluateOption
+		want map[string]interface{}
+	}{
+		{nil, map[string]interface{}{"text": "Hi &lt;Ann&gt;", "whole": "&lt;Ann&gt;", "number": 1}},
+		{[]EvaluateOption{WithParamEscaper(nil)}, map[string]interface{}{"text": "Hi &lt;Ann&gt;", "whole": "&lt;Ann&gt;", "number": 1}},
+		{[]EvaluateOption{WithParamEscaper(func(s string) string { return s })}, map[string]interface{}{"text": "Hi <Ann>", "whole": "<Ann>", "number": 1}},
+		{[]EvaluateOption{WithParamEscaper(strings.ToUpper)}, map[string]interface{}{"text": "Hi <ANN>", "whole": "<ANN>", "number": 1}},
+	}
+	for i, tt := range tests {
+		if got := renderParams(t, params, facts, tt.opts...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: params %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestRenderDoesNotModifyRule(t *testing.T) {
+	rules := NewRules()
+	err := rules.LoadRulesFromJSONString(`[{"id": "r", "conditions": {"all": []}, "event": {"type": "x", "params": {"msg": "Hi {{name}}", "list": ["{{name}}"]}}}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng := NewEngine()
+	for _, name := range []string{"Ann", "Bob"} {
+		events, err := eng.Evaluate(rules, map[string]interface{}{"name": name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := events[0].Params["msg"]; got != "Hi "+name {
+			t.Errorf("msg = %v, want Hi %s", got, name)
+		}
+	}
+
+	params := rules.GetRules()[0].Event.Params
+	if params["msg"] != "Hi {{name}}" || !reflect.DeepEqual(params["list"], []interface{}{"{{name}}"}) {
+		t.Errorf("rule params were modified: %v", params)
+	}
+}
+
+func TestRenderErrorsFailTheRule(t *testing.T) {
+	rules := NewRules()
+	err := rules.LoadRulesFromJSONString(`[
+		{"id": "divide", "conditions": {"all": []}, "event": {"type": "x", "params": {"ratio": {"expr": "1 / zero"}}}},
+		{"id": "text", "conditions": {"all": []}, "event": {"type": "x", "params": {"msg": ["ok", "{{1 / zero}} left"]}}},
+		{"id": "fine", "conditions": {"all": []}, "event": {"type": "fine", "params": {"msg": "{{missing}}"}}}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explanation, err := NewEngine().Explain(rules, map[string]interface{}{"zero": 0})
+	if !errors.Is(err, ErrDivisionByZero) {
+		t.Fatalf("error %v, want division by zero", err)
+	}
+	if got := eventTypes(explanation.Events); !reflect.DeepEqual(got, []string{"fine"}) {
+		t.Errorf("events = %v, want [fine]", got)
+	}
+
+	reasons := map[string]string{
+		"divide": "params.ratio: 1 / zero: division by zero",
+		"text":   "params.msg[1]: 1 / zero: division by zero",
+	}
+	for _, trace := range explanation.Rules {
+		want, failed := reasons[trace.RuleID]
+		if !failed {
+			if trace.Status != RuleMatched {
+				t.Errorf("%s: status %s", trace.RuleID, trace.Status)
+			}
+			continue
+		}
+		if trace.Status != RuleFailed || trace.Reason != want {
+			t.Errorf("%s: %s %q, want %s %q", trace.RuleID, trace.Status, trace.Reason, RuleFailed, want)
+		}
+	}
+}
+
+func TestTemplateErrorsRejectedAtLoad(t *testing.T) {
+	tests := []struct {
+		params string
+		path   string
+		want   string
+	}{
+		{`{"msg": "Hi {{name"}`, "event.params.msg", `unclosed placeholder in "Hi {{name"`},
+		{`{"msg": "{{1 +}}"}`, "event.params.msg", "invalid placeholder {{1 +}}"},
+		{`{"list": ["ok", {"v": "{{}}"}]}`, "event.params.list[1].v", "invalid placeholder {{}}"},
+		{`{"n": {"expr": "a +"}}`, "event.params.n", ""},
+	}
+	for _, tt := range tests {
+		rules := NewRules()
+		err := rules.LoadRulesFromJSONString(fmt.Sprintf(`[{"id": "r", "conditions": {"all": []}, "event": {"type": "x", "params": %s}}]`, tt.params))
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("%s: error %v, want a ValidationError", tt.params, err)
+			continue
+		}
+		if verr.Path != tt.path || !strings.Contains(verr.Message, tt.want) {
+			t.Errorf("%s: %s: %s, want %s: %s", tt.params, verr.Path, verr.Message, tt.path, tt.want)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		src   string
+		parts []string // literal text, or {{source}} for placeholders
+	}{
+		{"plain", []string{"plain"}},
+		{"{{a}}", []string{"{{a}}"}},
+		{"a {{ b }} c {{d}}", []string{"a ", "{{b}}", " c ", "{{d}}"}},
+		{`\{{a}} {{b}}`, []string{"{{a}} ", "{{b}}"}},
+		{`x \{{`, []string{"x {{"}},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseTemplate(tt.src)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		var parts []string
+		for _, part := range tmpl.parts {
+			if part.expr != nil {
+				parts = append(parts, "{{"+part.expr.src+"}}")
+			} else {
+				parts = append(parts, part.text)
+			}
+		}
+		if !reflect.DeepEqual(parts, tt.parts) {
+			t.Errorf("%q: parts %q, want %q", tt.src, parts, tt.parts)
+		}
+
+		again, _ := parseTemplate(tt.src)
+		if again != tmpl {
+			t.Errorf("%q was parsed again instead of cached", tt.src)
+		}
+	}
+}
+
+func TestBoundedCache(t *testing.T) {
+	c := newBoundedCache(2)
+	c.Store("a", 1)
+	c.Store("b", 2)
+	c.Store("b", 3)
+	if c.Len() != 2 {
+		t.Fatalf("Len() = %d after replacing an entry, want 2", c.Len())
+	}
+	if v, ok := c.Load("b"); !ok || v != 3 {
+		t.Errorf("Load(b) = %v, %v; want 3", v, ok)
+	}
+
+	c.Store("c", 4)
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+	if v, ok := c.Load("c"); !ok || v != 4 {
+		t.Errorf("Load(c) = %v, %v; want 4", v, ok)
+	}
+
+	for i := 0; i < 2*maxCachedSources; i++ {
+		if _, err := compileExpression(fmt.Sprintf("x + %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := expressionCache.Len(); n > maxCachedSources {
+		t.Errorf("expression cache holds %d entries, want at most %d", n, maxCachedSources)
+	}
+}
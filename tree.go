@@ -0,0 +1,256 @@
+package go_json_rules_engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DecisionTree is an alternative to flat rules for flows that branch: each
+// node tests a condition and continues with its True or False branch until
+// it reaches a leaf carrying an Event. A missing branch ends evaluation
+// without an event.
+type DecisionTree struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	Priority int       `json:"priority,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Root     *TreeNode `json:"root"`
+
+	source string
+}
+
+// TreeNode is either a decision, with a Condition and branches, or a leaf
+// with an Event. Nodes without an ID are identified by their path from the
+// root, such as "root.true.false".
+type TreeNode struct {
+	ID        string     `json:"id,omitempty"`
+	Condition *Condition `json:"condition,omitempty"`
+	True      *TreeNode  `json:"true,omitempty"`
+	False     *TreeNode  `json:"false,omitempty"`
+	Event     *Event     `json:"event,omitempty"`
+}
+
+// TreeStep records one node visited while evaluating a tree. Result is the
+// outcome of the node's condition and is always true for the leaf.
+type TreeStep struct {
+	NodeID    string     `json:"nodeId"`
+	Condition *Condition `json:"condition,omitempty"`
+	Result    bool       `json:"result"`
+}
+
+// TreeExplanation is the path taken through a tree and the event of the
+// leaf it ended at, if any.
+type TreeExplanation struct {
+	Path  []TreeStep `json:"path"`
+	Event *Event     `json:"event,omitempty"`
+}
+
+// ParseDecisionTree parses and checks a decision tree from JSON.
+func ParseDecisionTree(data []byte) (*DecisionTree, error) {
+	var t DecisionTree
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse decision tree: %w", err)
+	}
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// LoadDecisionTree reads a decision tree from a JSON file.
+func LoadDecisionTree(filename string) (*DecisionTree, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decision tree: %w", err)
+	}
+
+	t, err := ParseDecisionTree(data)
+	if err != nil {
+		return nil, err
+	}
+	t.source = filename
+	return t, nil
+}
+
+func (t *DecisionTree) check() error {
+	if t.ID == "" {
+		return errors.New("decision tree is missing an id")
+	}
+	if t.Root == nil {
+		return fmt.Errorf("decision tree %s has no root", t.ID)
+	}
+
+	var errs []error
+	seen := make(map[string]bool)
+	t.walk(func(id string, node *TreeNode, _ []Condition) {
+		if seen[id] {
+			errs = append(errs, fmt.Errorf("duplicate node id %q", id))
+		}
+		seen[id] = true
+
+		switch {
+		case node.Condition == nil && node.Event == nil:
+			errs = append(errs, fmt.Errorf("node %s has neither a condition nor an event", id))
+		case node.Condition == nil && (node.True != nil || node.False != nil):
+			errs = append(errs, fmt.Errorf("node %s has branches but no condition", id))
+		case node.Condition != nil && node.Event != nil:
+			errs = append(errs, fmt.Errorf("node %s has both a condition and an event", id))
+		case node.Condition != nil:
+			switch {
+			case node.Condition.Fact == "" && node.Condition.Expr == "":
+				errs = append(errs, fmt.Errorf("node %s: condition is missing a fact or expr", id))
+			case node.Condition.Fact != "" && node.Condition.Expr != "":
+				errs = append(errs, fmt.Errorf("node %s: condition must not set both fact and expr", id))
+			}
+			if node.Condition.Operator == "" {
+				errs = append(errs, fmt.Errorf("node %s: condition is missing an operator", id))
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("decision tree %s: %w", t.ID, errors.Join(errs...))
+	}
+	return nil
+}
+
+// walk visits every node depth-first, true branches first, passing the
+// conditions that must hold to reach it.
+func (t *DecisionTree) walk(visit func(id string, node *TreeNode, path []Condition)) {
+	var walk func(node *TreeNode, id string, path []Condition)
+	walk = func(node *TreeNode, id string, path []Condition) {
+		if node.ID != "" {
+			id = node.ID
+		}
+		visit(id, node, path)
+		if node.Condition == nil {
+			return
+		}
+
+		path = path[:len(path):len(path)]
+		if node.True != nil {
+			walk(node.True, id+".true", append(path, *node.Condition))
+		}
+		if node.False != nil {
+			negated := *node.Condition
+			negated.Not = !negated.Not
+			walk(node.False, id+".false", append(path, negated))
+		}
+	}
+	walk(t.Root, "root", nil)
+}
+
+// Rules converts the tree into one rule per leaf whose conditions are the
+// decisions on the path to it, with the conditions of false branches
+// negated. The rules are mutually exclusive and match exactly when the tree
+// would reach their leaf. Rules are identified as "<tree id>#<node id>".
+func (t *DecisionTree) Rules() (*Rule, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+
+	rules := NewRules()
+	t.walk(func(id string, node *TreeNode, path []Condition) {
+		if node.Event == nil {
+			return
+		}
+
+		conditions := make([]interface{}, len(path))
+		for i, cond := range path {
+			conditions[i] = cond
+		}
+		rules.AddRule(ruleOption{
+			ID:         t.ID + "#" + id,
+			Name:       t.Name,
+			Priority:   t.Priority,
+			Conditions: ConditionGroup{Operator: And, Conditions: conditions},
+			Event:      *node.Event,
+			Tags:       t.Tags,
+			Metadata: map[string]interface{}{
+				"decisionTree": t.ID,
+				"node":         id,
+			},
+			Source: Source{File: t.source},
+		})
+	})
+
+	if err := checkLoadedRules(rules.opts); err != nil {
+		return nil, fmt.Errorf("decision tree %s: %w", t.ID, err)
+	}
+	return rules, nil
+}
+
+// AddDecisionTree converts t into rules and merges them into r.
+func (r *Rule) AddDecisionTree(t *DecisionTree) error {
+	compiled, err := t.Rules()
+	if err != nil {
+		return err
+	}
+	return r.mergeRules(compiled.opts)
+}
+
+// EvaluateTree walks tree with facts and returns the event of the leaf it
+// reaches, if any.
+func (e *Engine) EvaluateTree(tree *DecisionTree, facts map[string]interface{}, opts ...EvaluateOption) ([]Event, error) {
+	explanation, err := e.ExplainTree(tree, facts, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if explanation.Event == nil {
+		return nil, nil
+	}
+	return []Event{*explanation.Event}, nil
+}
+
+// ExplainTree walks tree with facts like EvaluateTree and also returns the
+// path taken. Conditions see the engine's custom operators and, with
+// WithSetOperators, those of a rule set.
+func (e *Engine) ExplainTree(tree *DecisionTree, facts map[string]interface{}, opts ...EvaluateOption) (*TreeExplanation, error) {
+	if err := tree.check(); err != nil {
+		return nil, err
+	}
+
+	cfg := e.newEvaluateConfig(opts)
+	if cfg.operatorSet != "" {
+		if _, err := e.selectRuleSet(cfg.operatorSet, &cfg); err != nil {
+			return nil, fmt.Errorf("decision tree %s: %w", tree.ID, err)
+		}
+	}
+	if cfg.validateFacts {
+		if err := e.ValidateFacts(facts); err != nil {
+			return nil, err
+		}
+	}
+
+	env := &exprEnv{facts: facts, now: cfg.now, operators: cfg.operators}
+	explanation := &TreeExplanation{}
+	node, id := tree.Root, "root"
+	for node != nil {
+		if node.ID != "" {
+			id = node.ID
+		}
+
+		if node.Condition == nil {
+			event, err := renderEvent(*node.Event, env, cfg.escape)
+			if err != nil {
+				return nil, fmt.Errorf("decision tree %s: node %s: %w", tree.ID, id, err)
+			}
+			explanation.Path = append(explanation.Path, TreeStep{NodeID: id, Result: true})
+			explanation.Event = &event
+			break
+		}
+
+		result, err := e.evaluateCondition(*node.Condition, env)
+		if err != nil {
+			return nil, fmt.Errorf("decision tree %s: node %s: %w", tree.ID, id, err)
+		}
+		explanation.Path = append(explanation.Path, TreeStep{NodeID: id, Condition: node.Condition, Result: result})
+		if result {
+			node, id = node.True, id+".true"
+		} else {
+			node, id = node.False, id+".false"
+		}
+	}
+	return explanation, nil
+}
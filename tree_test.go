@@ -0,0 +1,201 @@
+package go_json_rules_engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const eligibilityTree = `{
+	"id": "eligibility",
+	"root": {
+		"condition": {"fact": "country", "operator": "in", "value": ["VN", "TH"]},
+		"true": {
+			"condition": {"expr": "lower(plan)", "operator": "equal", "value": "pro"},
+			"true": {"id": "pro", "event": {"type": "eligible", "params": {"tier": "pro"}}},
+			"false": {
+				"condition": {"fact": "age", "operator": "greaterThanInclusive", "value": 18},
+				"true": {"event": {"type": "eligible", "params": {"tier": "basic"}}}
+			}
+		},
+		"false": {"event": {"type": "ineligible"}}
+	}
+}`
+
+func TestExplainTree(t *testing.T) {
+	tree, err := ParseDecisionTree([]byte(eligibilityTree))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		facts map[string]interface{}
+		path  []string // node IDs and results
+		event string   // tier, "ineligible" or "" for no event
+	}{
+		{map[string]interface{}{"country": "VN", "plan": "PRO"}, []string{"root true", "root.true true", "pro true"}, "pro"},
+		{map[string]interface{}{"country": "TH", "plan": "free", "age": 20}, []string{"root true", "root.true false", "root.true.false true", "root.true.false.true true"}, "basic"},
+		{map[string]interface{}{"country": "TH", "plan": "free", "age": 16}, []string{"root true", "root.true false", "root.true.false false"}, ""},
+		{map[string]interface{}{"country": "US"}, []string{"root false", "root.false true"}, "ineligible"},
+		// A missing fact fails its condition.
+		{map[string]interface{}{}, []string{"root false", "root.false true"}, "ineligible"},
+	}
+
+	eng := NewEngine()
+	for _, tt := range tests {
+		explanation, err := eng.ExplainTree(tree, tt.facts)
+		if err != nil {
+			t.Errorf("%v: %v", tt.facts, err)
+			continue
+		}
+
+		var path []string
+		for _, step := range explanation.Path {
+			path = append(path, step.NodeID+" "+map[bool]string{true: "true", false: "false"}[step.Result])
+		}
+		if !reflect.DeepEqual(path, tt.path) {
+			t.Errorf("%v: path %q, want %q", tt.facts, path, tt.path)
+		}
+
+		var event string
+		if explanation.Event != nil {
+			event = explanation.Event.Type
+			if tier, ok := explanation.Event.Params["tier"]; ok {
+				event = tier.(string)
+			}
+		}
+		if event != tt.event {
+			t.Errorf("%v: event %q, want %q", tt.facts, event, tt.event)
+		}
+
+		events, err := eng.EvaluateTree(tree, tt.facts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(events) == 1) != (tt.event != "") {
+			t.Errorf("%v: EvaluateTree = %v", tt.facts, events)
+		}
+	}
+}
+
+func TestTreeRulesMatchTree(t *testing.T) {
+	tree, err := ParseDecisionTree([]byte(eligibilityTree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := tree.Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, rule := range rules.GetRules() {
+		ids = append(ids, rule.ID)
+	}
+	want := []string{"eligibility#pro", "eligibility#root.true.false.true", "eligibility#root.false"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("rule IDs = %q, want %q", ids, want)
+	}
+
+	eng := NewEngine()
+	for _, facts := range []map[string]interface{}{
+		{"country": "VN", "plan": "Pro"},
+		{"country": "VN", "plan": "free", "age": 30},
+		{"country": "VN", "plan": "free", "age": 3},
+		{"country": "FR", "plan": "pro"},
+		{},
+	} {
+		got, err := eng.Evaluate(rules, facts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := eng.EvaluateTree(tree, facts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: rules %v, tree %v", facts, got, want)
+		}
+	}
+}
+
+func TestDecisionTreeChecks(t *testing.T) {
+	tests := []struct {
+		json string
+		want string
+	}{
+		{`{"root": {"event": {"type": "x"}}}`, "decision tree is missing an id"},
+		{`{"id": "t"}`, "decision tree t has no root"},
+		{`{"id": "t", "root": {}}`, "node root has neither a condition nor an event"},
+		{`{"id": "t", "root": {"true": {"event": {"type": "x"}}, "event": {"type": "x"}}}`, "node root has branches but no condition"},
+		{`{"id": "t", "root": {"condition": {"fact": "a", "operator": "equal", "value": 1}, "event": {"type": "x"}}}`, "node root has both a condition and an event"},
+		{`{"id": "t", "root": {"condition": {"operator": "equal", "value": 1}}}`, "node root: condition is missing a fact or expr"},
+		{`{"id": "t", "root": {"condition": {"fact": "a", "expr": "a", "operator": "equal"}}}`, "node root: condition must not set both fact and expr"},
+		{`{"id": "t", "root": {"condition": {"expr": "a > 1"}}}`, "node root: condition is missing an operator"},
+		{`{"id": "t", "root": {"id": "n", "condition": {"fact": "a", "operator": "equal"}, "true": {"id": "n", "event": {"type": "x"}}}}`, `duplicate node id "n"`},
+		{`{"id": "t", "root": `, "failed to parse decision tree"},
+	}
+	for _, tt := range tests {
+		_, err := ParseDecisionTree([]byte(tt.json))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.json, err, tt.want)
+		}
+	}
+
+	tree, err := ParseDecisionTree([]byte(`{"id": "t", "root": {"condition": {"fact": "a", "operator": "greaterThan", "value": {"expr": "upper(b)"}}, "true": {"event": {"type": "x"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Rules(); err == nil || !strings.Contains(err.Error(), "decision tree t: ") {
+		t.Errorf("Rules() of a tree with an invalid operand: error %v", err)
+	}
+}
+
+func TestTreeUsesRuleSetOperators(t *testing.T) {
+	tree, err := ParseDecisionTree([]byte(`{"id": "parity", "root": {
+		"condition": {"fact": "n", "operator": "even", "value": true},
+		"true": {"event": {"type": "even"}},
+		"false": {"event": {"type": "odd"}}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng := NewEngine()
+	even := func(a, b interface{}) bool {
+		n, ok := numberValue(a)
+		return ok && int(n)%2 == 0
+	}
+	if err := eng.RegisterRuleSet("numbers", "v1", NewRules(), WithSetOperator("even", even)); err != nil {
+		t.Fatal(err)
+	}
+	odd := func(a, b interface{}) bool { return !even(a, b) }
+	if err := eng.RegisterRuleSet("numbers", "v2", NewRules(), WithSetOperator("even", odd)); err != nil {
+		t.Fatal(err)
+	}
+
+	facts := map[string]interface{}{"n": 3}
+	tests := []struct {
+		opts []EvaluateOption
+		want string
+	}{
+		// Without the set the operator is unknown and never holds.
+		{nil, "odd"},
+		{[]EvaluateOption{WithSetOperators("numbers")}, "even"},
+		{[]EvaluateOption{WithSetOperators("numbers"), WithSetVersion("v1")}, "odd"},
+	}
+	for i, tt := range tests {
+		events, err := eng.EvaluateTree(tree, facts, tt.opts...)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if len(events) != 1 || events[0].Type != tt.want {
+			t.Errorf("%d: events %v, want %s", i, events, tt.want)
+		}
+	}
+
+	if _, err := eng.ExplainTree(tree, facts, WithSetOperators("missing")); err == nil || err.Error() != "decision tree parity: rule set missing is not registered" {
+		t.Errorf("unknown rule set: error %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package go_json_rules_engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+var builtinOperators = []Operator{
+	Equal, NotEqual, GreaterThan, LessThan, GreaterThanInc, LessThanInc,
+	In, NotIn, Regex, IsNull, IsNotNull, InBucket,
+}
+
+func isBuiltinOperator(op Operator) bool {
+	for _, builtin := range builtinOperators {
+		if op == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError reports a problem with one rule. Path locates the
+// offending condition, e.g. "conditions[1].conditions[0]".
+type ValidationError struct {
+	RuleID  string
+	Source  Source
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("rule %q", e.RuleID)
+	if e.Source.File != "" || e.Source.Line != 0 {
+		msg = fmt.Sprintf("%s: %s", e.Source, msg)
+	}
+	if e.Path != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Path)
+	}
+	return fmt.Sprintf("%s: %s", msg, e.Message)
+}
+
+// Validate checks the structure of every rule: IDs must be present and
+// unique, groups must use a known logical operator, and conditions must name
+// a fact and an operator. Conditions using built-in operators are also
+// type-checked. All problems are returned joined together.
+func (r *Rule) Validate() error {
+	return r.validate(builtinSpec, false)
+}
+
+// Validate checks rules like Rule.Validate and additionally verifies that
+// every condition uses a built-in operator or one registered on e, with a
+// value the operator accepts. When facts are declared on e, conditions must
+// also reference declared facts with operators suited to their types.
+func (e *Engine) Validate(rules *Rule) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.validateRules(rules, e.operatorSpec)
+}
+
+// LoadRules loads a rules file like Rule.LoadRulesFromFile and checks it
+// with Validate, so rules referencing undeclared facts or operators unknown
+// to e are rejected when they are loaded.
+func (e *Engine) LoadRules(filename string) (*Rule, error) {
+	rules := NewRules()
+	if err := rules.LoadRulesFromFile(filename); err != nil {
+		return nil, err
+	}
+	if err := e.Validate(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// validateRules checks rules strictly against the operators known to lookup
+// and the declared facts. e.mu must be held.
+func (e *Engine) validateRules(rules *Rule, lookup func(Operator) (OperatorSpec, bool)) error {
+	errs := []error{rules.validate(lookup, true)}
+	for _, rule := range rules.GetRules() {
+		errs = append(errs, e.checkFactUsage(rule, lookup)...)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Rule) validate(lookup func(Operator) (OperatorSpec, bool), strict bool) error {
+	var errs []error
+	seen := make(map[string]Source)
+
+	for _, rule := range r.GetRules() {
+		if rule.ID == "" {
+			errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Message: "missing id"})
+		} else if first, ok := seen[rule.ID]; ok {
+			errs = append(errs, &DuplicateRuleError{ID: rule.ID, First: first, Second: rule.Source})
+		} else {
+			seen[rule.ID] = rule.Source
+		}
+
+		walkConditions(rule.Conditions, "conditions", func(path string, cond Condition) {
+			if cond.Fact == "" && cond.Expr == "" {
+				errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: path, Message: "missing fact"})
+			} else if cond.Fact != "" && cond.Expr != "" {
+				errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: path, Message: "fact and expr must not both be set"})
+			}
+			if cond.Operator == "" {
+				errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: path, Message: "missing operator"})
+			}
+		}, func(path string, group ConditionGroup) {
+			if len(group.Conditions) > 0 && group.Operator != And && group.Operator != Or {
+				errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: path, Message: fmt.Sprintf("unknown logical operator %q", group.Operator)})
+			}
+		})
+
+		if rule.Weight != nil && *rule.Weight < 0 {
+			errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: "weight", Message: "must not be negative"})
+		}
+		errs = append(errs, checkRollout(rule)...)
+		if rule.EffectiveFrom != nil && rule.EffectiveUntil != nil && !rule.EffectiveFrom.Before(*rule.EffectiveUntil) {
+			errs = append(errs, &ValidationError{RuleID: rule.ID, Source: rule.Source, Path: "effectiveUntil", Message: "must be after effectiveFrom"})
+		}
+
+		errs = append(errs, checkOperands(rule, lookup, strict)...)
+		errs = append(errs, checkParams(rule)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// walkConditions visits every condition and group below group. Either
+// callback may be nil.
+func walkConditions(group ConditionGroup, path string, onCondition func(string, Condition), onGroup func(string, ConditionGroup)) {
+	if onGroup != nil {
+		onGroup(path, group)
+	}
+
+	for i, condition := range group.Conditions {
+		childPath := fmt.Sprintf("%s.conditions[%d]", path, i)
+		switch cond := condition.(type) {
+		case Condition:
+			if onCondition != nil {
+				onCondition(childPath, cond)
+			}
+		case ConditionGroup:
+			walkConditions(cond, childPath, onCondition, onGroup)
+		}
+	}
+}